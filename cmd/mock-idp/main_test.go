@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"user-service/config"
+	"user-service/internal/controllers"
+	"user-service/internal/services"
+	"user-service/pkg/social"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginTest runs the user service's social login routes against a mock
+// IdP. Only the parts of a login before the user is looked up are run, so
+// no database is needed.
+type loginTest struct {
+	t        *testing.T
+	router   *gin.Engine
+	service  *services.SocialAuthService
+	provider social.Provider
+	idp      *http.Client
+}
+
+// login is a login started in one browser and approved at the IdP.
+type login struct {
+	cookie *http.Cookie
+	code   string
+	state  string
+}
+
+func newLoginTest(t *testing.T) *loginTest {
+	t.Helper()
+	if err := utils.LoadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+	idp, err := newServer("", user{Sub: "mock-user-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice Example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(idp.handler())
+	t.Cleanup(srv.Close)
+	idp.issuer = srv.URL
+
+	provider, err := social.NewOAuth2Provider(config.SocialProviderConfig{
+		Name:         "mock",
+		Type:         "oidc",
+		ClientID:     "mock",
+		ClientSecret: "mock",
+		DiscoveryURL: srv.URL + "/.well-known/openid-configuration",
+		RedirectURL:  "http://app.test/auth/mock/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, _ := social.NewRegistry(nil)
+	registry.Register(provider)
+	service := services.NewSocialAuthService(registry, nil, nil, nil)
+	controller := controllers.NewSocialAuthController(service, nil, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/auth/:provider/login", controller.Login)
+	router.GET("/auth/:provider/callback", controller.Callback)
+
+	client := srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	return &loginTest{t: t, router: router, service: service, provider: provider, idp: client}
+}
+
+// start begins a login and lets the IdP approve it, stopping before the
+// browser follows the redirect back to the callback.
+func (lt *loginTest) start() login {
+	lt.t.Helper()
+	w := httptest.NewRecorder()
+	lt.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/mock/login", nil))
+	if w.Code != http.StatusTemporaryRedirect {
+		lt.t.Fatalf("login: status %d: %s", w.Code, w.Body)
+	}
+	var l login
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "oauth_state" {
+			l.cookie = cookie
+		}
+	}
+	if l.cookie == nil {
+		lt.t.Fatal("login did not set the state cookie")
+	}
+
+	authURL, _ := url.Parse(w.Header().Get("Location"))
+	if authURL.Query().Get("code_challenge") == "" || authURL.Query().Get("code_challenge_method") != "S256" || authURL.Query().Get("nonce") == "" {
+		lt.t.Fatalf("authorization URL has no PKCE challenge or nonce: %s", authURL)
+	}
+	resp, err := lt.idp.Get(authURL.String())
+	if err != nil {
+		lt.t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := resp.Location()
+	if err != nil {
+		lt.t.Fatal(err)
+	}
+	l.code, l.state = callback.Query().Get("code"), callback.Query().Get("state")
+	return l
+}
+
+// callback delivers a code and state to the callback, with the state
+// cookie when it is not nil.
+func (lt *loginTest) callback(provider, code, state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	query := url.Values{"code": {code}, "state": {state}}
+	req := httptest.NewRequest(http.MethodGet, "/auth/"+provider+"/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	lt.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCallbackRejectsForeignState(t *testing.T) {
+	lt := newLoginTest(t)
+	victim, attacker := lt.start(), lt.start()
+
+	tests := []struct {
+		name     string
+		provider string
+		code     string
+		state    string
+		cookie   *http.Cookie
+	}{
+		{"no state cookie", "mock", victim.code, victim.state, nil},
+		{"no state", "mock", victim.code, "", victim.cookie},
+		{"state of another login", "mock", attacker.code, attacker.state, victim.cookie},
+		{"tampered cookie", "mock", victim.code, victim.state, &http.Cookie{Name: "oauth_state", Value: victim.cookie.Value + "x"}},
+		{"other provider", "other", victim.code, victim.state, victim.cookie},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := lt.callback(tt.provider, tt.code, tt.state, tt.cookie); w.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestCallbackEnforcesPKCE(t *testing.T) {
+	lt := newLoginTest(t)
+	injected, own := lt.start(), lt.start()
+
+	// A code from another login is sent with this browser's matching state,
+	// so only the PKCE verifier ties it to the wrong login.
+	w := lt.callback("mock", injected.code, own.state, own.cookie)
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("status %d, want 502: %s", w.Code, w.Body)
+	}
+	var cleared bool
+	for _, cookie := range w.Result().Cookies() {
+		cleared = cleared || (cookie.Name == "oauth_state" && cookie.MaxAge < 0)
+	}
+	if !cleared {
+		t.Fatal("state cookie was not cleared after the callback")
+	}
+}
+
+func TestExchangeWithVerifiedState(t *testing.T) {
+	lt := newLoginTest(t)
+	ctx := context.Background()
+
+	l := lt.start()
+	state, err := lt.service.VerifyState("mock", l.cookie.Value, l.state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := lt.provider.Exchange(ctx, l.code, social.AuthRequest{State: state.State, Nonce: state.Nonce, CodeVerifier: state.CodeVerifier})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.ProviderID != "mock-user-1" || identity.Email != "alice@example.com" || !identity.EmailVerified {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+
+	// The ID token carries the nonce of the login it was issued for.
+	l = lt.start()
+	state, err = lt.service.VerifyState("mock", l.cookie.Value, l.state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = lt.provider.Exchange(ctx, l.code, social.AuthRequest{State: state.State, Nonce: "another-login", CodeVerifier: state.CodeVerifier})
+	if !errors.Is(err, social.ErrInvalidIDToken) {
+		t.Fatalf("want ErrInvalidIDToken, got %v", err)
+	}
+}
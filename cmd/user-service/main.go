@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -8,8 +9,12 @@ import (
 	"user-service/config"
 	_ "user-service/docs" // Import để load các docs đã tạo bởi swag
 	"user-service/internal/models"
+	"user-service/internal/repositories"
 	"user-service/internal/routes"
+	"user-service/internal/services"
 	"user-service/pkg/database"
+	"user-service/pkg/mailer"
+	"user-service/utils"
 )
 
 // @title User Service API
@@ -30,20 +35,67 @@ func main() {
 	// Load cấu hình
 	config.LoadConfig()
 
+	// Nạp khóa ký JWT
+	if err := utils.LoadSigningKeys(); err != nil {
+		log.Fatalf("failed to load signing keys: %v", err)
+	}
+
 	// Khởi tạo kết nối cơ sở dữ liệu với connection pool
 	database.InitDB()
 
 	// Tự động migrate các bảng
 	db := database.GetDB()
-	if err := db.AutoMigrate(&models.User{}, &models.AuthProvider{}); err != nil {
+	// Nếu chưa có cột email_verified_at thì các tài khoản hiện có được tạo
+	// trước khi có xác minh email và sẽ được coi là đã xác minh
+	verifyExistingEmails := !db.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+	if err := db.AutoMigrate(&models.User{}, &models.AuthProvider{}, &models.RefreshToken{}, &models.Session{}, &models.OAuthClient{}, &models.AuthorizationCode{}, &models.MFARecoveryCode{}, &models.WebAuthnCredential{}, &models.WebAuthnChallenge{}, &models.PasswordResetToken{}, &models.OutboxEmail{}, &models.EmailChangeRequest{}, &models.Permission{}, &models.Role{}, &models.Organization{}, &models.Membership{}, &models.Invitation{}, &models.SCIMToken{}, &models.DataExport{}, &models.AuditEvent{}, &models.PendingAuditEvent{}, &models.AuditChainHead{}, &models.LoginAttempt{}); err != nil {
 		log.Fatalf("failed to migrate database: %v", err)
 	}
 
+	// Bỏ chỉ mục unique cũ trên cột email, vốn tính cả tài khoản đã xóa
+	userRepo := repositories.NewUserRepository(db)
+	if err := userRepo.MigrateEmailIndex(); err != nil {
+		log.Fatalf("failed to migrate email index: %v", err)
+	}
+	if verifyExistingEmails {
+		if err := userRepo.MarkEmailsVerified(); err != nil {
+			log.Fatalf("failed to mark existing emails as verified: %v", err)
+		}
+	}
+
+	// Tạo quyền và vai trò mặc định, chuyển cột role cũ sang bảng user_roles
+	orgRepo := repositories.NewOrganizationRepository(db)
+	auditService := services.NewAuditService(repositories.NewAuditRepository(db))
+	roleService := services.NewRoleService(repositories.NewRoleRepository(db), userRepo, orgRepo, auditService)
+	if err := roleService.EnsureDefaults(); err != nil {
+		log.Fatalf("failed to seed roles: %v", err)
+	}
+
+	// Khởi động worker gửi email từ outbox
+	mail, err := mailer.New()
+	if err != nil {
+		log.Fatalf("failed to configure mailer: %v", err)
+	}
+	outboxService := services.NewOutboxService(repositories.NewOutboxRepository(db), mail)
+	go outboxService.Run(context.Background())
+
+	// Khởi động worker tạo các bản xuất dữ liệu người dùng
+	dataExportService := services.NewDataExportService(repositories.NewDataExportRepository(db), userRepo, orgRepo, repositories.NewWebAuthnRepository(db), outboxService)
+	go dataExportService.Run(context.Background())
+
+	// Khởi động worker nối các sự kiện audit ghi sau (như đăng nhập) vào chuỗi
+	go auditService.Run(context.Background())
+
+	// Khởi động worker xóa hẳn các tài khoản đã hết thời gian khôi phục
+	go services.NewAccountPurgeService(userRepo).Run(context.Background())
+
 	// Tạo router mới
 	r := gin.Default()
 
 	// Đăng ký routes
-	routes.RegisterRoutes(r)
+	if err := routes.RegisterRoutes(r, outboxService, dataExportService, auditService, roleService); err != nil {
+		log.Fatalf("failed to register routes: %v", err)
+	}
 
 	// Thêm route cho Swagger
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -2,10 +2,9 @@ package config
 
 import (
 	"log"
+	"strings"
 
 	"github.com/spf13/viper"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 )
 
 type Config struct {
@@ -17,10 +16,82 @@ type Config struct {
 	GoogleClientID     string
 	GoogleClientSecret string
 	GoogleRedirectURL  string
+	// JWTSigningKey is a PEM encoded private key; JWTSigningKeyFile points to one.
+	JWTSigningKey       string
+	JWTSigningKeyFile   string
+	JWTSigningKeyID     string
+	JWTVerificationKeys string
+	// OIDCIssuer is the public base URL of the service; OIDCLoginURL is the
+	// login page authorization requests are forwarded to.
+	OIDCIssuer   string
+	OIDCLoginURL string
+	// TOTPIssuer is the account issuer shown in authenticator apps.
+	TOTPIssuer string
+	// WebAuthnRPOrigins is a comma separated list of allowed origins.
+	WebAuthnRPID      string
+	WebAuthnRPName    string
+	WebAuthnRPOrigins string
+	// PasswordResetURL is the frontend page reset links point to.
+	PasswordResetURL string
+	// EmailVerificationURL is the page verification links point to. When
+	// RequireEmailVerification is set, unverified users cannot log in.
+	EmailVerificationURL     string
+	RequireEmailVerification bool
+	// EmailChangeConfirmURL and EmailChangeCancelURL are the pages the links
+	// in email change messages point to.
+	EmailChangeConfirmURL string
+	EmailChangeCancelURL  string
+	// InvitationURL is the page organization invitation links point to.
+	InvitationURL string
+	// MailDriver selects the mail backend: smtp, file or log.
+	MailDriver   string
+	MailFrom     string
+	MailFileDir  string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	// SocialProviders are the external login providers listed in
+	// SOCIAL_PROVIDERS, each configured with SOCIAL_<NAME>_* variables.
+	SocialProviders []SocialProviderConfig
+	// SocialReturnOrigins are the origins a social login may redirect back
+	// to with return_to; relative paths are always allowed.
+	SocialReturnOrigins []string
+}
+
+// SocialProviderConfig declares an OAuth2/OpenID Connect login provider.
+// Type is a preset (google, github, microsoft, gitlab, facebook) or the
+// generic "oidc" or "oauth2"; settings left empty fall back to the preset,
+// and OIDC endpoints are read from DiscoveryURL. The Claim* fields name the
+// user info fields to read, using dots for nested values. Audiences are
+// further client IDs accepted in ID tokens posted by apps, such as the iOS
+// and Android client IDs of the same Google project.
+type SocialProviderConfig struct {
+	Name               string
+	Type               string
+	ClientID           string
+	ClientSecret       string
+	RedirectURL        string
+	Scopes             []string
+	DiscoveryURL       string
+	Issuer             string
+	JWKSURL            string
+	Audiences          []string
+	AuthURL            string
+	TokenURL           string
+	UserInfoURL        string
+	EmailsURL          string
+	ClaimID            string
+	ClaimEmail         string
+	ClaimEmailVerified string
+	ClaimName          string
+	ClaimPicture       string
+	// TrustEmail treats the provider email as verified when there is no
+	// verification claim.
+	TrustEmail bool
 }
 
 var AppConfig Config
-var GoogleOAuthConfig *oauth2.Config
 
 func LoadConfig() {
 	viper.SetConfigFile(".env")
@@ -29,21 +100,88 @@ func LoadConfig() {
 	}
 
 	AppConfig = Config{
-		DBHost:             viper.GetString("DB_HOST"),
-		DBPort:             viper.GetString("DB_PORT"),
-		DBUser:             viper.GetString("DB_USER"),
-		DBPassword:         viper.GetString("DB_PASSWORD"),
-		DBName:             viper.GetString("DB_NAME"),
-		GoogleClientID:     viper.GetString("GOOGLE_CLIENT_ID"),
-		GoogleClientSecret: viper.GetString("GOOGLE_CLIENT_SECRET"),
-		GoogleRedirectURL:  viper.GetString("GOOGLE_REDIRECT_URL"),
+		DBHost:                   viper.GetString("DB_HOST"),
+		DBPort:                   viper.GetString("DB_PORT"),
+		DBUser:                   viper.GetString("DB_USER"),
+		DBPassword:               viper.GetString("DB_PASSWORD"),
+		DBName:                   viper.GetString("DB_NAME"),
+		GoogleClientID:           viper.GetString("GOOGLE_CLIENT_ID"),
+		GoogleClientSecret:       viper.GetString("GOOGLE_CLIENT_SECRET"),
+		GoogleRedirectURL:        viper.GetString("GOOGLE_REDIRECT_URL"),
+		JWTSigningKey:            viper.GetString("JWT_SIGNING_KEY"),
+		JWTSigningKeyFile:        viper.GetString("JWT_SIGNING_KEY_FILE"),
+		JWTSigningKeyID:          viper.GetString("JWT_SIGNING_KEY_ID"),
+		JWTVerificationKeys:      viper.GetString("JWT_VERIFICATION_KEYS"),
+		OIDCIssuer:               viper.GetString("OIDC_ISSUER"),
+		OIDCLoginURL:             viper.GetString("OIDC_LOGIN_URL"),
+		TOTPIssuer:               viper.GetString("TOTP_ISSUER"),
+		WebAuthnRPID:             viper.GetString("WEBAUTHN_RP_ID"),
+		WebAuthnRPName:           viper.GetString("WEBAUTHN_RP_NAME"),
+		WebAuthnRPOrigins:        viper.GetString("WEBAUTHN_RP_ORIGINS"),
+		PasswordResetURL:         viper.GetString("PASSWORD_RESET_URL"),
+		EmailVerificationURL:     viper.GetString("EMAIL_VERIFICATION_URL"),
+		RequireEmailVerification: viper.GetBool("REQUIRE_EMAIL_VERIFICATION"),
+		EmailChangeConfirmURL:    viper.GetString("EMAIL_CHANGE_CONFIRM_URL"),
+		EmailChangeCancelURL:     viper.GetString("EMAIL_CHANGE_CANCEL_URL"),
+		InvitationURL:            viper.GetString("INVITATION_URL"),
+		MailDriver:               viper.GetString("MAIL_DRIVER"),
+		MailFrom:                 viper.GetString("MAIL_FROM"),
+		MailFileDir:              viper.GetString("MAIL_FILE_DIR"),
+		SMTPHost:                 viper.GetString("SMTP_HOST"),
+		SMTPPort:                 viper.GetString("SMTP_PORT"),
+		SMTPUsername:             viper.GetString("SMTP_USERNAME"),
+		SMTPPassword:             viper.GetString("SMTP_PASSWORD"),
 	}
-	GoogleOAuthConfig = &oauth2.Config{
-		ClientID:     AppConfig.GoogleClientID,
-		ClientSecret: AppConfig.GoogleClientSecret,
-		RedirectURL:  AppConfig.GoogleRedirectURL,
-		Scopes:       []string{"https://www.googleapis.com/auth/userinfo.profile", "https://www.googleapis.com/auth/userinfo.email"},
-		Endpoint:     google.Endpoint,
+	AppConfig.SocialProviders = loadSocialProviders()
+	AppConfig.SocialReturnOrigins = strings.Fields(strings.ReplaceAll(viper.GetString("SOCIAL_RETURN_ORIGINS"), ",", " "))
+
+}
+
+func loadSocialProviders() []SocialProviderConfig {
+	var providers []SocialProviderConfig
+	hasGoogle := false
+	for _, name := range strings.Split(viper.GetString("SOCIAL_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "SOCIAL_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		provider := SocialProviderConfig{
+			Name:               name,
+			Type:               viper.GetString(prefix + "TYPE"),
+			ClientID:           viper.GetString(prefix + "CLIENT_ID"),
+			ClientSecret:       viper.GetString(prefix + "CLIENT_SECRET"),
+			RedirectURL:        viper.GetString(prefix + "REDIRECT_URL"),
+			Scopes:             strings.Fields(strings.ReplaceAll(viper.GetString(prefix+"SCOPES"), ",", " ")),
+			DiscoveryURL:       viper.GetString(prefix + "DISCOVERY_URL"),
+			Issuer:             viper.GetString(prefix + "ISSUER"),
+			JWKSURL:            viper.GetString(prefix + "JWKS_URL"),
+			Audiences:          strings.Fields(strings.ReplaceAll(viper.GetString(prefix+"AUDIENCES"), ",", " ")),
+			AuthURL:            viper.GetString(prefix + "AUTH_URL"),
+			TokenURL:           viper.GetString(prefix + "TOKEN_URL"),
+			UserInfoURL:        viper.GetString(prefix + "USERINFO_URL"),
+			EmailsURL:          viper.GetString(prefix + "EMAILS_URL"),
+			ClaimID:            viper.GetString(prefix + "CLAIM_ID"),
+			ClaimEmail:         viper.GetString(prefix + "CLAIM_EMAIL"),
+			ClaimEmailVerified: viper.GetString(prefix + "CLAIM_EMAIL_VERIFIED"),
+			ClaimName:          viper.GetString(prefix + "CLAIM_NAME"),
+			ClaimPicture:       viper.GetString(prefix + "CLAIM_PICTURE"),
+			TrustEmail:         viper.GetBool(prefix + "TRUST_EMAIL"),
+		}
+		if name == "google" {
+			hasGoogle = true
+		}
+		providers = append(providers, provider)
 	}
 
+	// The original GOOGLE_* settings keep working without SOCIAL_PROVIDERS.
+	if !hasGoogle && AppConfig.GoogleClientID != "" {
+		providers = append(providers, SocialProviderConfig{
+			Name:         "google",
+			ClientID:     AppConfig.GoogleClientID,
+			ClientSecret: AppConfig.GoogleClientSecret,
+			RedirectURL:  AppConfig.GoogleRedirectURL,
+		})
+	}
+	return providers
 }
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AccountDeletionController struct {
+	AccountDeletionService *services.AccountDeletionService
+}
+
+func NewAccountDeletionController(ads *services.AccountDeletionService) *AccountDeletionController {
+	return &AccountDeletionController{AccountDeletionService: ads}
+}
+
+// DeleteAccount godoc
+// @Summary Delete own account
+// @Description Delete the authenticated user's account and sign it out everywhere. Confirm with the current password, or with the account email when the account has no password. An administrator can restore the account for 30 days; after that it is removed for good.
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param input body models.DeleteAccountInput true "Confirmation"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /user [delete]
+func (adc *AccountDeletionController) DeleteAccount(c *gin.Context) {
+	userID := c.GetUint("userID")
+	var input models.DeleteAccountInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	err := adc.AccountDeletionService.DeleteAccount(userID, input, requestInfo(c))
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
+	case errors.Is(err, utils.ErrInvalidCredentials):
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "Incorrect password or email")
+	case errors.Is(err, services.ErrLastAdmin):
+		utils.SendErrorResponse(c, http.StatusConflict, "The last admin cannot delete their account")
+	case errors.Is(err, services.ErrLastOwner):
+		utils.SendErrorResponse(c, http.StatusConflict, "Transfer ownership of your organizations before deleting your account")
+	default:
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not delete account")
+	}
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AccountLinkController struct {
+	AccountLinkService *services.AccountLinkService
+}
+
+func NewAccountLinkController(als *services.AccountLinkService) *AccountLinkController {
+	return &AccountLinkController{AccountLinkService: als}
+}
+
+// ListProviders godoc
+// @Summary List linked login providers
+// @Description List the external login providers linked to the authenticated user
+// @Tags User
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Success 200 {array} models.AuthProviderResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /user/auth-providers [get]
+func (ac *AccountLinkController) ListProviders(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var providers []models.AuthProviderResponse
+	providers, err := ac.AccountLinkService.ListProviders(userID.(uint))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not list login providers")
+		return
+	}
+	c.JSON(http.StatusOK, providers)
+}
+
+// LinkProvider godoc
+// @Summary Link a login provider
+// @Description Start linking an external login provider to the authenticated user. Returns the provider's authorization URL and sets the oauth_state cookie; the browser is then sent to that URL and the provider callback links the account. With return_to the callback redirects there with the result in the URL fragment.
+// @Tags User
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param provider path string true "Provider, e.g. google"
+// @Param return_to query string false "Where to send the browser after linking"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 502 {object} utils.ErrorResponse
+// @Router /user/auth-providers/{provider} [post]
+func (ac *AccountLinkController) LinkProvider(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	authURL, stateToken, err := ac.AccountLinkService.StartLink(c.Request.Context(), userID.(uint), c.GetString("sessionID"), c.Param("provider"), c.Query("return_to"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidReturnTo) {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "return_to is not an allowed redirect target")
+			return
+		}
+		status, _, message := linkProviderError(err)
+		utils.SendErrorResponse(c, status, message)
+		return
+	}
+	setOAuthStateCookie(c, stateToken, int(services.OAuthStateExpiry.Seconds()))
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// UnlinkProvider godoc
+// @Summary Unlink a login provider
+// @Description Remove a linked login provider. The last remaining login method cannot be removed.
+// @Tags User
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param provider path string true "Provider, e.g. google"
+// @Success 200 {object} gin.H
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /user/auth-providers/{provider} [delete]
+func (ac *AccountLinkController) UnlinkProvider(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	err := ac.AccountLinkService.UnlinkProvider(userID.(uint), c.Param("provider"), requestInfo(c))
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"message": "Login provider unlinked successfully"})
+	case errors.Is(err, services.ErrProviderNotLinked):
+		utils.SendErrorResponse(c, http.StatusNotFound, "Login provider is not linked")
+	case errors.Is(err, services.ErrLastLoginMethod):
+		utils.SendErrorResponse(c, http.StatusConflict, "Cannot remove the last login method; set a password or add a passkey first")
+	default:
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not unlink login provider")
+	}
+}
+
+func linkProviderError(err error) (int, string, string) {
+	switch {
+	case errors.Is(err, services.ErrUnsupportedProvider):
+		return http.StatusNotFound, "unknown_provider", "Unsupported login provider"
+	case errors.Is(err, services.ErrProviderAlreadyLinked):
+		return http.StatusConflict, "already_linked", "This provider account or provider is already linked"
+	case errors.Is(err, services.ErrSessionNotFound), errors.Is(err, services.ErrSessionRevoked):
+		return http.StatusUnauthorized, "session_expired", "The session that started the link is no longer active"
+	case errors.Is(err, utils.ErrAccountSuspended), errors.Is(err, utils.ErrAccountBanned), errors.Is(err, utils.ErrAccountPending):
+		return http.StatusForbidden, "account_inactive", "Account is not active"
+	}
+	return http.StatusBadGateway, "link_failed", "Could not verify the provider account"
+}
@@ -0,0 +1,321 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminUserController struct {
+	AdminUserService *services.AdminUserService
+}
+
+func NewAdminUserController(aus *services.AdminUserService) *AdminUserController {
+	return &AdminUserController{AdminUserService: aus}
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Description Search and filter users with cursor pagination. Requires users:read; without organizations:manage only members of the active organization are listed.
+// @Tags admin
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param q query string false "Text to search for in names and emails"
+// @Param role query string false "Role name"
+// @Param provider query string false "Linked login provider"
+// @Param verified query bool false "Whether the email is verified"
+// @Param status query string false "active, suspended, banned, pending or deleted"
+// @Param created_after query string false "RFC 3339 time"
+// @Param created_before query string false "RFC 3339 time"
+// @Param last_login_after query string false "RFC 3339 time"
+// @Param last_login_before query string false "RFC 3339 time"
+// @Param sort query string false "created_at, email or name, prefixed with - for descending order (default -created_at)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100 (default 20)"
+// @Success 200 {object} models.UserListResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} gin.H
+// @Router /admin/users [get]
+func (auc *AdminUserController) ListUsers(c *gin.Context) {
+	var query models.ListUsersQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		utils.SendValidationErrorResponse(c, err)
+		return
+	}
+	users, err := auc.AdminUserService.ListUsers(orgScope(c), query)
+	if err != nil {
+		sendAdminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+// GetUser godoc
+// @Summary Get a user
+// @Description Requires users:read. Without organizations:manage only accounts provisioned by the active organization can be read.
+// @Tags admin
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "User ID"
+// @Success 200 {object} models.AdminUserResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /admin/users/{id} [get]
+func (auc *AdminUserController) GetUser(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	user, err := auc.AdminUserService.GetUser(orgScope(c), userID)
+	if err != nil {
+		sendAdminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// GetLoginHistory godoc
+// @Summary Get a user's login history
+// @Description List the sign-in attempts on an account, successful or not, newest first. Requires users:read; without organizations:manage only accounts provisioned by the active organization.
+// @Tags admin
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "User ID"
+// @Param success query bool false "Only successful or only failed attempts"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100 (default 20)"
+// @Success 200 {object} models.LoginHistoryResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /admin/users/{id}/login-history [get]
+func (auc *AdminUserController) GetLoginHistory(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	var query models.LoginHistoryQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		utils.SendValidationErrorResponse(c, err)
+		return
+	}
+	history, err := auc.AdminUserService.LoginHistory(orgScope(c), userID, query)
+	if err != nil {
+		sendAdminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+// ResetMFA godoc
+// @Summary Reset a user's MFA
+// @Description Remove the TOTP secret, recovery codes and security keys of a user. Requires users:write; without organizations:manage only accounts provisioned by the active organization.
+// @Tags admin
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "User ID"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /admin/users/{id}/mfa [delete]
+func (auc *AdminUserController) ResetMFA(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	if err := auc.AdminUserService.ResetMFA(orgScope(c), requestInfo(c), userID); err != nil {
+		sendAdminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "MFA reset successfully"})
+}
+
+// UpdateUser godoc
+// @Summary Update a user
+// @Description Requires users:write. Without organizations:manage only accounts provisioned by the active organization can be changed.
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "User ID"
+// @Param input body models.AdminUpdateUserInput true "Changes"
+// @Success 200 {object} models.AdminUserResponse
+// @Failure 400 {object} utils.ValidationErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /admin/users/{id} [patch]
+func (auc *AdminUserController) UpdateUser(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	var input models.AdminUpdateUserInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendValidationErrorResponse(c, err)
+		return
+	}
+	user, err := auc.AdminUserService.UpdateUser(orgScope(c), requestInfo(c), userID, input)
+	if err != nil {
+		sendAdminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteUser godoc
+// @Summary Delete a user
+// @Description Soft-delete the account and revoke its sessions. The account can be restored for 30 days; after that it is removed for good. Requires users:write. The last admin and the last owner of an organization cannot be deleted.
+// @Tags admin
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "User ID"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /admin/users/{id} [delete]
+func (auc *AdminUserController) DeleteUser(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	if err := auc.AdminUserService.DeleteUser(orgScope(c), requestInfo(c), userID); err != nil {
+		sendAdminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
+
+// RestoreUser godoc
+// @Summary Restore a deleted user
+// @Description Undo the deletion of an account within 30 days of it. Sessions revoked by the deletion stay revoked. Requires users:write.
+// @Tags admin
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "User ID"
+// @Success 200 {object} models.AdminUserResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 410 {object} utils.ErrorResponse
+// @Router /admin/users/{id}/restore [post]
+func (auc *AdminUserController) RestoreUser(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	user, err := auc.AdminUserService.RestoreUser(orgScope(c), requestInfo(c), userID)
+	if err != nil {
+		sendAdminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// EraseUser godoc
+// @Summary Erase a user
+// @Description Anonymize an account for good to answer an erasure request: personal fields are cleared, the email is replaced, and logins, sessions, tokens, memberships and exports are removed. The account row is kept so records referring to it stay valid. Works on deleted accounts that have not been purged yet. Requires users:write.
+// @Tags admin
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "User ID"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /admin/users/{id}/erase [post]
+func (auc *AdminUserController) EraseUser(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	if err := auc.AdminUserService.EraseUser(orgScope(c), requestInfo(c), userID); err != nil {
+		sendAdminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User erased successfully"})
+}
+
+// SetUserStatus godoc
+// @Summary Suspend, ban or reinstate a user
+// @Description Set the account status to active, suspended, banned or pending. Disabling an account requires a reason and signs it out everywhere; suspensions may carry an expiry after which they lift by themselves. Requires users:write.
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "User ID"
+// @Param input body models.SetUserStatusInput true "Status"
+// @Success 200 {object} models.AdminUserResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /admin/users/{id}/status [put]
+func (auc *AdminUserController) SetUserStatus(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	var input models.SetUserStatusInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendValidationErrorResponse(c, err)
+		return
+	}
+	user, err := auc.AdminUserService.SetStatus(orgScope(c), requestInfo(c), userID, input)
+	if err != nil {
+		sendAdminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// adminUserID reads the :id path parameter, answering 400 when it is not a
+// number.
+func adminUserID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func sendAdminUserError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.SendErrorResponse(c, http.StatusNotFound, "User not found")
+	case errors.Is(err, services.ErrRoleNotFound):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Unknown role")
+	case errors.Is(err, services.ErrInvalidCursor):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid cursor")
+	case errors.Is(err, services.ErrNoActiveOrganization):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "No active organization")
+	case errors.Is(err, services.ErrAccountNotManaged):
+		utils.SendErrorResponse(c, http.StatusForbidden, "The account is not managed by your organization")
+	case errors.Is(err, services.ErrCannotDisableSelf):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "You cannot delete or disable your own account here")
+	case errors.Is(err, services.ErrStatusReasonRequired):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "A reason is required")
+	case errors.Is(err, services.ErrInvalidStatusExpiry):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Only suspensions can expire, and only in the future")
+	case errors.Is(err, services.ErrRestoreWindowExpired):
+		utils.SendErrorResponse(c, http.StatusGone, "The account can no longer be restored")
+	case errors.Is(err, services.ErrEmailTaken):
+		utils.SendErrorResponse(c, http.StatusConflict, "Email already exists")
+	case errors.Is(err, services.ErrLastAdmin):
+		utils.SendErrorResponse(c, http.StatusConflict, "Cannot delete or disable the last admin")
+	case errors.Is(err, services.ErrLastOwner):
+		utils.SendErrorResponse(c, http.StatusConflict, "Cannot delete or disable the last owner of an organization")
+	default:
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not process user request")
+	}
+}
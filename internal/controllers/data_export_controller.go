@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DataExportController struct {
+	DataExportService *services.DataExportService
+}
+
+func NewDataExportController(des *services.DataExportService) *DataExportController {
+	return &DataExportController{DataExportService: des}
+}
+
+// RequestExport godoc
+// @Summary Export own data
+// @Description Start building an archive of everything stored about the authenticated user: profile, login providers, sessions, organizations, passkeys and invitations. The archive is built in the background; poll GET /user/export/{id} or wait for the email with the download link. A ZIP export holds one JSON file per section.
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param input body models.DataExportInput false "Format, json (default) or zip"
+// @Success 202 {object} models.DataExportResponse
+// @Failure 400 {object} utils.ValidationErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /user/export [post]
+func (dec *DataExportController) RequestExport(c *gin.Context) {
+	var input models.DataExportInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			utils.SendValidationErrorResponse(c, err)
+			return
+		}
+	}
+	export, err := dec.DataExportService.RequestExport(c.GetUint("userID"), input.Format)
+	if err != nil {
+		sendDataExportError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, export)
+}
+
+// GetExport godoc
+// @Summary Get a data export
+// @Description Get the state of an export. Once it is ready the response has a signed download link that works without authentication until the export expires.
+// @Tags user
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "Export ID"
+// @Success 200 {object} models.DataExportResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /user/export/{id} [get]
+func (dec *DataExportController) GetExport(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusNotFound, "Export not found")
+		return
+	}
+	export, err := dec.DataExportService.GetExport(c.GetUint("userID"), uint(id))
+	if err != nil {
+		sendDataExportError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, export)
+}
+
+// DownloadExport godoc
+// @Summary Download a data export
+// @Description Download a finished export through the signed link from GET /user/export/{id} or the notification email.
+// @Tags user
+// @Produce  application/json
+// @Produce  application/zip
+// @Param id path int true "Export ID"
+// @Param token query string true "Signed token from the download link"
+// @Success 200 {file} file
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /exports/{id}/download [get]
+func (dec *DataExportController) DownloadExport(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusNotFound, "Export not found")
+		return
+	}
+	export, err := dec.DataExportService.Download(uint(id), c.Query("token"))
+	if err != nil {
+		sendDataExportError(c, err)
+		return
+	}
+	contentType := "application/json"
+	if export.Format == models.DataExportFormatZIP {
+		contentType = "application/zip"
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="user-data-%d.%s"`, export.ID, export.Format))
+	c.Data(http.StatusOK, contentType, export.Data)
+}
+
+func sendDataExportError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrExportNotFound), errors.Is(err, services.ErrUserNotFound):
+		utils.SendErrorResponse(c, http.StatusNotFound, "Export not found")
+	case errors.Is(err, services.ErrExportInProgress):
+		utils.SendErrorResponse(c, http.StatusConflict, "An export is already being prepared")
+	case errors.Is(err, services.ErrExportNotReady):
+		utils.SendErrorResponse(c, http.StatusConflict, "The export is not ready yet")
+	case errors.Is(err, utils.ErrInvalidActionToken):
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "Invalid or expired download link")
+	default:
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not process export request")
+	}
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EmailChangeController struct {
+	EmailChangeService *services.EmailChangeService
+}
+
+func NewEmailChangeController(ecs *services.EmailChangeService) *EmailChangeController {
+	return &EmailChangeController{EmailChangeService: ecs}
+}
+
+// RequestEmailChange godoc
+// @Summary Change email address
+// @Description Request a change of the login email. A confirmation link is sent to the new address and a notice with a cancel link to the current one; the email only changes once confirmed.
+// @Tags email
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param input body models.ChangeEmailInput true "Current password, or current email for accounts without one, and new email"
+// @Success 202 {object} gin.H
+// @Failure 400 {object} utils.ValidationErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /user/email/change [post]
+func (ec *EmailChangeController) RequestEmailChange(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var input models.ChangeEmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendValidationErrorResponse(c, err)
+		return
+	}
+	err := ec.EmailChangeService.RequestEmailChange(userID.(uint), input)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusAccepted, gin.H{"message": "A confirmation link has been sent to the new email address"})
+	case errors.Is(err, utils.ErrInvalidCredentials):
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "Incorrect password or email")
+	case errors.Is(err, services.ErrSameEmail):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "New email is the same as the current one")
+	case errors.Is(err, services.ErrEmailTaken):
+		utils.SendErrorResponse(c, http.StatusConflict, "Email already exists")
+	default:
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not request email change")
+	}
+}
+
+// ConfirmEmailChange godoc
+// @Summary Confirm email change
+// @Description Switch the account to the new email with the token from the confirmation link. Accepts the token as a query parameter or JSON body.
+// @Tags email
+// @Accept  json
+// @Produce  json
+// @Param token query string false "Confirmation token"
+// @Param input body models.EmailChangeTokenInput false "Confirmation token"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /email/change/confirm [post]
+// @Router /email/change/confirm [get]
+func (ec *EmailChangeController) ConfirmEmailChange(c *gin.Context) {
+	var input models.EmailChangeTokenInput
+	if err := c.ShouldBind(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	if err := ec.EmailChangeService.ConfirmEmailChange(input.Token, requestInfo(c)); err != nil {
+		sendEmailChangeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email address changed successfully"})
+}
+
+// CancelEmailChange godoc
+// @Summary Cancel email change
+// @Description Cancel a pending email change, or roll back a confirmed one and sign out every session, with the token sent to the previous address.
+// @Tags email
+// @Accept  json
+// @Produce  json
+// @Param token query string false "Cancel token"
+// @Param input body models.EmailChangeTokenInput false "Cancel token"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /email/change/cancel [post]
+// @Router /email/change/cancel [get]
+func (ec *EmailChangeController) CancelEmailChange(c *gin.Context) {
+	var input models.EmailChangeTokenInput
+	if err := c.ShouldBind(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	if err := ec.EmailChangeService.CancelEmailChange(input.Token, requestInfo(c)); err != nil {
+		sendEmailChangeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email change cancelled"})
+}
+
+func sendEmailChangeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidEmailChangeToken):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid or expired token")
+	case errors.Is(err, services.ErrEmailTaken):
+		utils.SendErrorResponse(c, http.StatusConflict, "Email already exists")
+	default:
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not update email address")
+	}
+}
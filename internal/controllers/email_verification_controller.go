@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"net/http"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EmailVerificationController struct {
+	EmailVerificationService *services.EmailVerificationService
+}
+
+func NewEmailVerificationController(es *services.EmailVerificationService) *EmailVerificationController {
+	return &EmailVerificationController{EmailVerificationService: es}
+}
+
+// VerifyEmail godoc
+// @Summary Verify email address
+// @Description Confirm an email address with the token from the verification link. Accepts the token as a query parameter or JSON body.
+// @Tags email
+// @Accept  json
+// @Produce  json
+// @Param token query string false "Verification token"
+// @Param input body models.VerifyEmailInput false "Verification token"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ErrorResponse
+// @Router /email/verify [post]
+// @Router /email/verify [get]
+func (ec *EmailVerificationController) VerifyEmail(c *gin.Context) {
+	var input models.VerifyEmailInput
+	if err := c.ShouldBind(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	if err := ec.EmailVerificationService.VerifyEmail(input.Token); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid or expired verification token")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerification godoc
+// @Summary Resend verification email
+// @Description Send a new verification link. Always succeeds; repeated requests are throttled.
+// @Tags email
+// @Accept  json
+// @Produce  json
+// @Param input body models.ResendVerificationInput true "Email"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ErrorResponse
+// @Router /email/verification/resend [post]
+func (ec *EmailVerificationController) ResendVerification(c *gin.Context) {
+	var input models.ResendVerificationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	if err := ec.EmailVerificationService.ResendVerification(input.Email); err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not send verification email")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If the email needs verification, a new link has been sent"})
+}
@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type InvitationController struct {
+	InvitationService *services.InvitationService
+}
+
+func NewInvitationController(is *services.InvitationService) *InvitationController {
+	return &InvitationController{InvitationService: is}
+}
+
+// CreateInvitation godoc
+// @Summary Invite someone to an organization
+// @Description Email a single-use invitation link to the address. Requires members:write in the active organization; inviting with a role other than member also requires roles:write.
+// @Tags organizations
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "Organization ID"
+// @Param input body models.CreateInvitationInput true "Invitation"
+// @Success 201 {object} models.InvitationResponse
+// @Failure 400 {object} utils.ValidationErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /orgs/{id}/invitations [post]
+func (ic *InvitationController) CreateInvitation(c *gin.Context) {
+	orgID, ok := organizationID(c)
+	if !ok {
+		return
+	}
+	var input models.CreateInvitationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendValidationErrorResponse(c, err)
+		return
+	}
+	userID, _ := c.Get("userID")
+	invitation, err := ic.InvitationService.CreateInvitation(orgID, userID.(uint), input, hasPermission(c, models.PermRolesWrite), requestInfo(c))
+	if err != nil {
+		sendInvitationError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// ListInvitations godoc
+// @Summary List invitations
+// @Description List the invitations of the active organization, newest first
+// @Tags organizations
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "Organization ID"
+// @Success 200 {array} models.InvitationResponse
+// @Failure 403 {object} gin.H
+// @Router /orgs/{id}/invitations [get]
+func (ic *InvitationController) ListInvitations(c *gin.Context) {
+	orgID, ok := organizationID(c)
+	if !ok {
+		return
+	}
+	invitations, err := ic.InvitationService.ListInvitations(orgID)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not list invitations")
+		return
+	}
+	c.JSON(http.StatusOK, invitations)
+}
+
+// ResendInvitation godoc
+// @Summary Resend an invitation
+// @Description Email a new link with a new expiry. The previous link stops working.
+// @Tags organizations
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "Organization ID"
+// @Param invitation_id path int true "Invitation ID"
+// @Success 200 {object} models.InvitationResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /orgs/{id}/invitations/{invitation_id}/resend [post]
+func (ic *InvitationController) ResendInvitation(c *gin.Context) {
+	orgID, ok := organizationID(c)
+	if !ok {
+		return
+	}
+	invitationID, err := strconv.ParseUint(c.Param("invitation_id"), 10, 64)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid invitation ID")
+		return
+	}
+	invitation, err := ic.InvitationService.ResendInvitation(orgID, uint(invitationID))
+	if err != nil {
+		sendInvitationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, invitation)
+}
+
+// RevokeInvitation godoc
+// @Summary Revoke an invitation
+// @Tags organizations
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "Organization ID"
+// @Param invitation_id path int true "Invitation ID"
+// @Success 200 {object} gin.H
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /orgs/{id}/invitations/{invitation_id} [delete]
+func (ic *InvitationController) RevokeInvitation(c *gin.Context) {
+	orgID, ok := organizationID(c)
+	if !ok {
+		return
+	}
+	invitationID, err := strconv.ParseUint(c.Param("invitation_id"), 10, 64)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid invitation ID")
+		return
+	}
+	if err := ic.InvitationService.RevokeInvitation(orgID, uint(invitationID)); err != nil {
+		sendInvitationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked successfully"})
+}
+
+// PreviewInvitation godoc
+// @Summary Show an invitation
+// @Description Describe the invitation behind a link, including whether an account already exists for the invited email
+// @Tags organizations
+// @Produce  json
+// @Param token query string true "Invitation token"
+// @Success 200 {object} models.InvitationPreviewResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Router /invitations [get]
+func (ic *InvitationController) PreviewInvitation(c *gin.Context) {
+	var input models.InvitationTokenInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	preview, err := ic.InvitationService.PreviewInvitation(input.Token)
+	if err != nil {
+		sendInvitationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, preview)
+}
+
+// AcceptInvitation godoc
+// @Summary Accept an invitation
+// @Description Join the organization with the signed in account, whose email must be the invited address
+// @Tags organizations
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param input body models.InvitationTokenInput true "Invitation token"
+// @Success 200 {object} models.OrganizationResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Router /invitations/accept [post]
+func (ic *InvitationController) AcceptInvitation(c *gin.Context) {
+	var input models.InvitationTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	userID, _ := c.Get("userID")
+	org, err := ic.InvitationService.AcceptInvitation(input.Token, userID.(uint), requestInfo(c))
+	if err != nil {
+		sendInvitationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, org)
+}
+
+// RegisterWithInvitation godoc
+// @Summary Register with an invitation
+// @Description Create an account for the invited email and join the organization. The email is verified by the invitation link.
+// @Tags organizations
+// @Accept  json
+// @Produce  json
+// @Param input body models.AcceptInvitationRegisterInput true "Invitation token and account details"
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} utils.ValidationErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /invitations/register [post]
+func (ic *InvitationController) RegisterWithInvitation(c *gin.Context) {
+	var input models.AcceptInvitationRegisterInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendValidationErrorResponse(c, err)
+		return
+	}
+	user, err := ic.InvitationService.RegisterWithInvitation(input, requestInfo(c))
+	if err != nil {
+		sendInvitationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, services.NewUserResponse(user))
+}
+
+func sendInvitationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvitationNotFound):
+		utils.SendErrorResponse(c, http.StatusNotFound, "Invitation not found")
+	case errors.Is(err, services.ErrInvalidInvitation):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid or expired invitation")
+	case errors.Is(err, services.ErrInvitationNotPending):
+		utils.SendErrorResponse(c, http.StatusConflict, "The invitation was already accepted or revoked")
+	case errors.Is(err, services.ErrInvitationEmailMismatch):
+		utils.SendErrorResponse(c, http.StatusForbidden, "The invitation was sent to another email address")
+	case errors.Is(err, services.ErrInvitationRoleNotAllowed):
+		utils.SendErrorResponse(c, http.StatusForbidden, "Inviting with this role requires the roles:write permission")
+	case errors.Is(err, services.ErrAlreadyMember):
+		utils.SendErrorResponse(c, http.StatusConflict, "The user is already a member of the organization")
+	case errors.Is(err, services.ErrRoleNotFound):
+		utils.SendErrorResponse(c, http.StatusNotFound, "Role not found")
+	case errors.Is(err, services.ErrEmailTaken):
+		utils.SendErrorResponse(c, http.StatusConflict, "An account already exists for this email; sign in to accept the invitation")
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.SendErrorResponse(c, http.StatusNotFound, "User not found")
+	default:
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not process invitation request")
+	}
+}
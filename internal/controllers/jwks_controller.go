@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"net/http"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSController struct{}
+
+func NewJWKSController() *JWKSController {
+	return &JWKSController{}
+}
+
+// GetJWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys that verify tokens issued by this service
+// @Tags token
+// @Produce  json
+// @Success 200 {object} utils.JWKSet
+// @Router /.well-known/jwks.json [get]
+func (jc *JWKSController) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.GetJWKS())
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LoginHistoryController struct {
+	LoginHistoryService *services.LoginHistoryService
+}
+
+func NewLoginHistoryController(lhs *services.LoginHistoryService) *LoginHistoryController {
+	return &LoginHistoryController{LoginHistoryService: lhs}
+}
+
+// GetLoginHistory godoc
+// @Summary Get login history
+// @Description List the sign-in attempts on the authenticated user's account, successful or not, newest first
+// @Tags session
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param success query bool false "Only successful or only failed attempts"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, at most 100 (default 20)"
+// @Success 200 {object} models.LoginHistoryResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} gin.H
+// @Router /user/login-history [get]
+func (lhc *LoginHistoryController) GetLoginHistory(c *gin.Context) {
+	var query models.LoginHistoryQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		utils.SendValidationErrorResponse(c, err)
+		return
+	}
+	history, err := lhc.LoginHistoryService.ListAttempts(c.GetUint("userID"), query)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUserNotFound):
+			utils.SendErrorResponse(c, http.StatusNotFound, "User not found")
+		case errors.Is(err, services.ErrInvalidCursor):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid cursor")
+		default:
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not list login history")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MFAController struct {
+	MFAService   *services.MFAService
+	TokenService *services.TokenService
+}
+
+func NewMFAController(ms *services.MFAService, ts *services.TokenService) *MFAController {
+	return &MFAController{MFAService: ms, TokenService: ts}
+}
+
+// SetupTOTP godoc
+// @Summary Start TOTP enrollment
+// @Description Generate a TOTP secret and otpauth:// URI for the authenticated user. The secret becomes a second factor once a code is confirmed.
+// @Tags mfa
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Success 200 {object} models.TOTPSetupResponse
+// @Failure 401 {object} gin.H
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /user/mfa/totp/setup [post]
+func (mc *MFAController) SetupTOTP(c *gin.Context) {
+	setup, err := mc.MFAService.BeginTOTPEnrollment(c.GetUint("userID"))
+	if err != nil {
+		sendMFAError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, setup)
+}
+
+// ConfirmTOTP godoc
+// @Summary Confirm TOTP enrollment
+// @Description Confirm the TOTP secret with a code from the authenticator app. When this enables MFA, recovery codes are returned that are only shown once. Adding TOTP while MFA is on requires reauthentication with an existing second factor.
+// @Tags mfa
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param input body models.TOTPConfirmInput true "TOTP Code"
+// @Success 200 {object} models.RecoveryCodesResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Router /user/mfa/totp/confirm [post]
+func (mc *MFAController) ConfirmTOTP(c *gin.Context) {
+	var input models.TOTPConfirmInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	codes, err := mc.MFAService.ConfirmTOTPEnrollment(c.GetUint("userID"), input, requestInfo(c))
+	if err != nil {
+		sendMFAError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Regenerate recovery codes
+// @Description Replace the MFA recovery codes of the authenticated user after checking a TOTP code, a recovery code or a security key assertion
+// @Tags mfa
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param input body models.SecondFactorInput true "Second factor"
+// @Success 200 {object} models.RecoveryCodesResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} gin.H
+// @Failure 429 {object} utils.ErrorResponse
+// @Router /user/mfa/recovery-codes [post]
+func (mc *MFAController) RegenerateRecoveryCodes(c *gin.Context) {
+	var input models.SecondFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	codes, err := mc.MFAService.RegenerateRecoveryCodes(c.GetUint("userID"), input)
+	if err != nil {
+		sendMFAError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableMFA godoc
+// @Summary Disable MFA
+// @Description Turn off two-factor authentication for the authenticated user. Requires the password, or the account email for accounts without one, and a TOTP code, recovery code or security key assertion.
+// @Tags mfa
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param input body models.ReauthenticationInput true "Password or account email, and a second factor"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Router /user/mfa/disable [post]
+func (mc *MFAController) DisableMFA(c *gin.Context) {
+	var input models.ReauthenticationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	if err := mc.MFAService.DisableMFA(c.GetUint("userID"), input, requestInfo(c)); err != nil {
+		sendMFAError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// LoginMFA godoc
+// @Summary Complete an MFA login
+// @Description Exchange the MFA token returned by login plus a TOTP or recovery code for tokens
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param input body models.MFALoginInput true "MFA Login Data"
+// @Success 200 {object} utils.TokenResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Router /login/mfa [post]
+func (mc *MFAController) LoginMFA(c *gin.Context) {
+	var input models.MFALoginInput
+	if err := c.ShouldBindJSON(&input); err != nil || (input.Code == "" && input.RecoveryCode == "") {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	user, err := mc.MFAService.VerifyLoginChallenge(input.MFAToken, input.Code, input.RecoveryCode, requestInfo(c))
+	if err != nil {
+		sendMFAError(c, err)
+		return
+	}
+	accessToken, refreshToken, err := mc.TokenService.IssueTokens(user, services.SecondFactorMethod(input.RecoveryCode), requestInfo(c))
+	if err != nil {
+		sendIssueTokensError(c, err)
+		return
+	}
+	utils.SendTokenResponse(c, accessToken, refreshToken)
+}
+
+func sendMFAError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrMFAAlreadyEnabled):
+		utils.SendErrorResponse(c, http.StatusConflict, "Two-factor authentication is already enabled")
+	case errors.Is(err, services.ErrMFANotEnabled):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Two-factor authentication is not enabled")
+	case errors.Is(err, services.ErrMFANotStarted):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Two-factor enrollment has not been started")
+	case errors.Is(err, services.ErrInvalidMFACode):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid verification code")
+	case errors.Is(err, services.ErrInvalidMFAToken):
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "Invalid or expired MFA token")
+	case errors.Is(err, services.ErrMFALocked):
+		utils.SendErrorResponse(c, http.StatusTooManyRequests, "Too many invalid codes, try again later")
+	case errors.Is(err, utils.ErrInvalidCredentials):
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "Incorrect password or email")
+	default:
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not process two-factor request")
+	}
+}
@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"user-service/config"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OAuthController struct {
+	OAuthService *services.OAuthService
+}
+
+func NewOAuthController(os *services.OAuthService) *OAuthController {
+	return &OAuthController{OAuthService: os}
+}
+
+// Discovery godoc
+// @Summary OpenID Connect discovery
+// @Description OpenID Provider metadata
+// @Tags oauth2
+// @Produce  json
+// @Success 200 {object} gin.H
+// @Router /.well-known/openid-configuration [get]
+func (oc *OAuthController) Discovery(c *gin.Context) {
+	issuer := issuerURL(c)
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth2/authorize",
+		"token_endpoint":                        issuer + "/oauth2/token",
+		"userinfo_endpoint":                     issuer + "/oauth2/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"response_types_supported":              services.SupportedResponseTypes,
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{utils.SigningAlgorithm()},
+		"scopes_supported":                      services.SupportedOAuthScopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      services.SupportedPKCEMethods,
+		"claims_supported":                      []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "email"},
+	})
+}
+
+// StartAuthorize godoc
+// @Summary Start an authorization request
+// @Description Validate an OAuth 2.0 authorization request and forward the user to the login page
+// @Tags oauth2
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "Registered redirect URI"
+// @Param scope query string false "Space separated scopes"
+// @Param state query string false "Opaque client state"
+// @Param nonce query string false "ID token nonce"
+// @Param code_challenge query string false "PKCE challenge"
+// @Param code_challenge_method query string false "Must be S256"
+// @Success 302
+// @Failure 400 {object} utils.ErrorResponse
+// @Router /oauth2/authorize [get]
+func (oc *OAuthController) StartAuthorize(c *gin.Context) {
+	var input models.AuthorizeInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid authorization request")
+		return
+	}
+
+	if _, err := oc.OAuthService.ValidateAuthorizeRequest(input); err != nil {
+		oc.sendAuthorizeError(c, input, err)
+		return
+	}
+
+	loginURL := config.AppConfig.OIDCLoginURL
+	if loginURL == "" {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Login page is not configured")
+		return
+	}
+	c.Redirect(http.StatusFound, loginURL+"?"+c.Request.URL.RawQuery)
+}
+
+// Authorize godoc
+// @Summary Complete an authorization request
+// @Description Issue an authorization code for the authenticated user. Called by the login page with the parameters it received from GET /oauth2/authorize.
+// @Tags oauth2
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param request body models.AuthorizeInput true "Authorization Request"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} gin.H
+// @Router /oauth2/authorize [post]
+func (oc *OAuthController) Authorize(c *gin.Context) {
+	var input models.AuthorizeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid authorization request")
+		return
+	}
+
+	redirectTo, err := oc.OAuthService.Authorize(c.GetUint("userID"), input)
+	if err != nil {
+		var oauthErr *services.OAuthError
+		if errors.As(err, &oauthErr) {
+			c.JSON(http.StatusOK, gin.H{"redirect_to": services.AuthorizeRedirectURL(input.RedirectURI, url.Values{
+				"error":             {oauthErr.Code},
+				"error_description": {oauthErr.Description},
+				"state":             {input.State},
+			})})
+			return
+		}
+		oc.sendAuthorizeError(c, input, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"redirect_to": redirectTo})
+}
+
+// Token godoc
+// @Summary Token endpoint
+// @Description Exchange an authorization code or refresh token for tokens
+// @Tags oauth2
+// @Accept  x-www-form-urlencoded
+// @Produce  json
+// @Param grant_type formData string true "authorization_code or refresh_token"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI used in the authorization request"
+// @Param code_verifier formData string false "PKCE verifier"
+// @Param refresh_token formData string false "Refresh token"
+// @Param client_id formData string false "Client ID"
+// @Param client_secret formData string false "Client secret"
+// @Success 200 {object} models.OAuthTokenResponse
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Router /oauth2/token [post]
+func (oc *OAuthController) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var input models.OAuthTokenInput
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "grant_type is required"})
+		return
+	}
+	if clientID, clientSecret, ok := c.Request.BasicAuth(); ok {
+		input.ClientID, _ = url.QueryUnescape(clientID)
+		input.ClientSecret, _ = url.QueryUnescape(clientSecret)
+	}
+
+	response, err := oc.OAuthService.Exchange(input, issuerURL(c), c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		var oauthErr *services.OAuthError
+		if !errors.As(err, &oauthErr) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		status := http.StatusBadRequest
+		if oauthErr.Code == "invalid_client" {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UserInfo godoc
+// @Summary UserInfo endpoint
+// @Description Claims about the authenticated user. For a token issued to an OAuth client, only the claims its scopes allow.
+// @Tags oauth2
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Success 200 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Router /oauth2/userinfo [get]
+func (oc *OAuthController) UserInfo(c *gin.Context) {
+	scopes := services.SupportedOAuthScopes
+	if c.GetString("clientID") != "" {
+		scopes = strings.Fields(c.GetString("scope"))
+	}
+	claims, err := oc.OAuthService.GetUserInfo(c.GetUint("userID"), scopes)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusNotFound, "User not found")
+		return
+	}
+	c.JSON(http.StatusOK, claims)
+}
+
+// CreateClient godoc
+// @Summary Register an OAuth client
+// @Description Register an application that signs users in through this service. The client secret is only returned once.
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param client body models.CreateOAuthClientInput true "Client Data"
+// @Success 201 {object} models.OAuthClientResponse
+// @Failure 400 {object} gin.H
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /admin/oauth-clients [post]
+func (oc *OAuthController) CreateClient(c *gin.Context) {
+	var input models.CreateOAuthClientInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	client, err := oc.OAuthService.RegisterClient(orgScope(c), input, requestInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrGlobalClientsNotAllowed):
+			utils.SendErrorResponse(c, http.StatusForbidden, "Global clients require the organizations:manage permission")
+		case errors.Is(err, services.ErrNoActiveOrganization):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "No active organization")
+		default:
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not create client")
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, client)
+}
+
+// ListClients godoc
+// @Summary List OAuth clients
+// @Tags admin
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Success 200 {array} models.OAuthClientResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /admin/oauth-clients [get]
+func (oc *OAuthController) ListClients(c *gin.Context) {
+	clients, err := oc.OAuthService.ListClients(orgScope(c))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not list clients")
+		return
+	}
+	c.JSON(http.StatusOK, clients)
+}
+
+// DeleteClient godoc
+// @Summary Delete an OAuth client
+// @Tags admin
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param client_id path string true "Client ID"
+// @Success 200 {object} gin.H
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /admin/oauth-clients/{client_id} [delete]
+func (oc *OAuthController) DeleteClient(c *gin.Context) {
+	if err := oc.OAuthService.DeleteClient(orgScope(c), c.Param("client_id"), requestInfo(c)); err != nil {
+		if errors.Is(err, services.ErrUnknownClient) {
+			utils.SendErrorResponse(c, http.StatusNotFound, "Client not found")
+			return
+		}
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not delete client")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Client deleted successfully"})
+}
+
+// sendAuthorizeError reports an authorization error. Errors about the client
+// or redirect URI are shown directly, everything else goes back to the client.
+func (oc *OAuthController) sendAuthorizeError(c *gin.Context, input models.AuthorizeInput, err error) {
+	switch {
+	case errors.Is(err, services.ErrUnknownClient):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Unknown client")
+		return
+	case errors.Is(err, services.ErrInvalidRedirectURI):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid redirect URI")
+		return
+	}
+
+	var oauthErr *services.OAuthError
+	if errors.As(err, &oauthErr) {
+		c.Redirect(http.StatusFound, services.AuthorizeRedirectURL(input.RedirectURI, url.Values{
+			"error":             {oauthErr.Code},
+			"error_description": {oauthErr.Description},
+			"state":             {input.State},
+		}))
+		return
+	}
+	utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not authorize request")
+}
+
+// issuerURL returns the configured issuer, falling back to the request's own
+// scheme and host.
+func issuerURL(c *gin.Context) string {
+	if config.AppConfig.OIDCIssuer != "" {
+		return strings.TrimSuffix(config.AppConfig.OIDCIssuer, "/")
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
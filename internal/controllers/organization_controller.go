@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OrganizationController struct {
+	OrganizationService *services.OrganizationService
+}
+
+func NewOrganizationController(ogs *services.OrganizationService) *OrganizationController {
+	return &OrganizationController{OrganizationService: ogs}
+}
+
+// ListOrganizations godoc
+// @Summary List my organizations
+// @Description List the organizations the user belongs to with their roles in each
+// @Tags organizations
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Success 200 {array} models.OrganizationResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /orgs [get]
+func (oc *OrganizationController) ListOrganizations(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	orgs, err := oc.OrganizationService.ListOrganizations(userID.(uint), orgScope(c).OrganizationID)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not list organizations")
+		return
+	}
+	c.JSON(http.StatusOK, orgs)
+}
+
+// CreateOrganization godoc
+// @Summary Create an organization
+// @Description Create an organization owned by the user. Switch to it to act in it.
+// @Tags organizations
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param input body models.CreateOrganizationInput true "Organization"
+// @Success 201 {object} models.OrganizationResponse
+// @Failure 400 {object} utils.ValidationErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /orgs [post]
+func (oc *OrganizationController) CreateOrganization(c *gin.Context) {
+	var input models.CreateOrganizationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendValidationErrorResponse(c, err)
+		return
+	}
+	userID, _ := c.Get("userID")
+	org, err := oc.OrganizationService.CreateOrganization(userID.(uint), input)
+	if err != nil {
+		sendOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, org)
+}
+
+// GetOrganization godoc
+// @Summary Get an organization
+// @Tags organizations
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "Organization ID"
+// @Success 200 {object} models.OrganizationResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /orgs/{id} [get]
+func (oc *OrganizationController) GetOrganization(c *gin.Context) {
+	orgID, ok := organizationID(c)
+	if !ok {
+		return
+	}
+	userID, _ := c.Get("userID")
+	org, err := oc.OrganizationService.GetOrganization(orgScope(c), userID.(uint), orgID)
+	if err != nil {
+		sendOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, org)
+}
+
+// UpdateOrganization godoc
+// @Summary Rename an organization
+// @Description Requires organization:write in the organization, which must be the active one
+// @Tags organizations
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "Organization ID"
+// @Param input body models.UpdateOrganizationInput true "Changes"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ValidationErrorResponse
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /orgs/{id} [patch]
+func (oc *OrganizationController) UpdateOrganization(c *gin.Context) {
+	orgID, ok := organizationID(c)
+	if !ok {
+		return
+	}
+	var input models.UpdateOrganizationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendValidationErrorResponse(c, err)
+		return
+	}
+	if err := oc.OrganizationService.UpdateOrganization(orgID, input); err != nil {
+		sendOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Organization updated successfully"})
+}
+
+// SwitchOrganization godoc
+// @Summary Switch the active organization
+// @Description Make the organization active for the current session and return tokens carrying its roles and permissions
+// @Tags organizations
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "Organization ID"
+// @Success 200 {object} utils.TokenResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /orgs/{id}/switch [post]
+func (oc *OrganizationController) SwitchOrganization(c *gin.Context) {
+	orgID, ok := organizationID(c)
+	if !ok {
+		return
+	}
+	userID, _ := c.Get("userID")
+	sessionID, _ := c.Get("sessionID")
+	accessToken, refreshToken, err := oc.OrganizationService.SwitchOrganization(orgScope(c), userID.(uint), sessionID.(string), orgID)
+	if err != nil {
+		sendOrganizationError(c, err)
+		return
+	}
+	utils.SendTokenResponse(c, accessToken, refreshToken)
+}
+
+// ListMembers godoc
+// @Summary List organization members
+// @Description Requires members:read in the organization, which must be the active one
+// @Tags organizations
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "Organization ID"
+// @Success 200 {array} models.MemberResponse
+// @Failure 403 {object} gin.H
+// @Router /orgs/{id}/members [get]
+func (oc *OrganizationController) ListMembers(c *gin.Context) {
+	orgID, ok := organizationID(c)
+	if !ok {
+		return
+	}
+	members, err := oc.OrganizationService.ListMembers(orgID)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not list members")
+		return
+	}
+	c.JSON(http.StatusOK, members)
+}
+
+// RemoveMember godoc
+// @Summary Remove a member
+// @Description Requires members:write in the organization, which must be the active one. The last owner cannot be removed.
+// @Tags organizations
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "Organization ID"
+// @Param user_id path int true "User ID"
+// @Success 200 {object} gin.H
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /orgs/{id}/members/{user_id} [delete]
+func (oc *OrganizationController) RemoveMember(c *gin.Context) {
+	orgID, ok := organizationID(c)
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if err := oc.OrganizationService.RemoveMember(orgID, uint(userID), requestInfo(c)); err != nil {
+		sendOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+// LeaveOrganization godoc
+// @Summary Leave an organization
+// @Description The last owner cannot leave
+// @Tags organizations
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "Organization ID"
+// @Success 200 {object} gin.H
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /orgs/{id}/leave [post]
+func (oc *OrganizationController) LeaveOrganization(c *gin.Context) {
+	orgID, ok := organizationID(c)
+	if !ok {
+		return
+	}
+	userID, _ := c.Get("userID")
+	if err := oc.OrganizationService.RemoveMember(orgID, userID.(uint), requestInfo(c)); err != nil {
+		sendOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Left the organization"})
+}
+
+// organizationID reads the :id path parameter, answering 400 when it is not
+// a number.
+func organizationID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid organization ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// orgScope returns the organization scope AuthMiddleware derived from the
+// access token.
+func orgScope(c *gin.Context) services.OrgScope {
+	scope, _ := c.Get("orgScope")
+	return scope.(services.OrgScope)
+}
+
+// hasPermission reports whether the access token grants the permission.
+func hasPermission(c *gin.Context, permission string) bool {
+	permissions, _ := c.Get("userPermissions")
+	granted, _ := permissions.([]string)
+	for _, p := range granted {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func sendOrganizationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrOrganizationNotFound):
+		utils.SendErrorResponse(c, http.StatusNotFound, "Organization not found")
+	case errors.Is(err, services.ErrNotMember):
+		utils.SendErrorResponse(c, http.StatusNotFound, "The user is not a member of the organization")
+	case errors.Is(err, services.ErrInvalidSlug):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Slugs may only contain lowercase letters, digits and single dashes")
+	case errors.Is(err, services.ErrSlugTaken):
+		utils.SendErrorResponse(c, http.StatusConflict, "This slug is already taken")
+	case errors.Is(err, services.ErrLastOwner):
+		utils.SendErrorResponse(c, http.StatusConflict, "Cannot remove the last owner")
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.SendErrorResponse(c, http.StatusNotFound, "User not found")
+	default:
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not process organization request")
+	}
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PasswordController struct {
+	PasswordService *services.PasswordService
+}
+
+func NewPasswordController(ps *services.PasswordService) *PasswordController {
+	return &PasswordController{PasswordService: ps}
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Email a password reset link. Always succeeds so registered addresses cannot be discovered.
+// @Tags password
+// @Accept  json
+// @Produce  json
+// @Param input body models.ForgotPasswordInput true "Email"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ErrorResponse
+// @Router /password/forgot [post]
+func (pc *PasswordController) ForgotPassword(c *gin.Context) {
+	var input models.ForgotPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	if err := pc.PasswordService.ForgotPassword(input.Email); err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not process request")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If the email is registered, a reset link has been sent"})
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password with the token from the reset email. All sessions are signed out.
+// @Tags password
+// @Accept  json
+// @Produce  json
+// @Param input body models.ResetPasswordInput true "Reset Data"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /password/reset [post]
+func (pc *PasswordController) ResetPassword(c *gin.Context) {
+	var input models.ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	if err := pc.PasswordService.ResetPassword(input.Token, input.NewPassword, requestInfo(c)); err != nil {
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid or expired reset token")
+		} else {
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not reset password")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleController struct {
+	RoleService *services.RoleService
+}
+
+func NewRoleController(rs *services.RoleService) *RoleController {
+	return &RoleController{RoleService: rs}
+}
+
+// ListRoles godoc
+// @Summary List roles
+// @Description List the roles of the active organization, and the global roles for callers with organizations:manage
+// @Tags admin
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Success 200 {array} models.RoleResponse
+// @Failure 403 {object} gin.H
+// @Router /admin/roles [get]
+func (rc *RoleController) ListRoles(c *gin.Context) {
+	roles, err := rc.RoleService.ListRoles(orgScope(c))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not list roles")
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+// ListPermissions godoc
+// @Summary List permissions
+// @Description List every permission that can be granted to a role
+// @Tags admin
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Success 200 {array} models.Permission
+// @Failure 403 {object} gin.H
+// @Router /admin/permissions [get]
+func (rc *RoleController) ListPermissions(c *gin.Context) {
+	permissions, err := rc.RoleService.ListPermissions()
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not list permissions")
+		return
+	}
+	c.JSON(http.StatusOK, permissions)
+}
+
+// CreateRole godoc
+// @Summary Create a role
+// @Description Create a role granting the given permissions in the active organization, or a global role when global is set
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param input body models.CreateRoleInput true "Role"
+// @Success 201 {object} models.RoleResponse
+// @Failure 400 {object} utils.ValidationErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /admin/roles [post]
+func (rc *RoleController) CreateRole(c *gin.Context) {
+	var input models.CreateRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendValidationErrorResponse(c, err)
+		return
+	}
+	role, err := rc.RoleService.CreateRole(orgScope(c), input, requestInfo(c))
+	if err != nil {
+		sendRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole godoc
+// @Summary Update a role
+// @Description Change a role's description and, when given, replace its permissions. The admin and owner roles cannot be changed.
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param role path string true "Role name"
+// @Param input body models.UpdateRoleInput true "Changes"
+// @Success 200 {object} models.RoleResponse
+// @Failure 400 {object} utils.ValidationErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /admin/roles/{role} [patch]
+func (rc *RoleController) UpdateRole(c *gin.Context) {
+	var input models.UpdateRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendValidationErrorResponse(c, err)
+		return
+	}
+	role, err := rc.RoleService.UpdateRole(orgScope(c), c.Param("role"), input, requestInfo(c))
+	if err != nil {
+		sendRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole godoc
+// @Summary Delete a role
+// @Description Delete a role and take it from every user holding it. Built-in roles cannot be deleted.
+// @Tags admin
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param role path string true "Role name"
+// @Success 200 {object} gin.H
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /admin/roles/{role} [delete]
+func (rc *RoleController) DeleteRole(c *gin.Context) {
+	if err := rc.RoleService.DeleteRole(orgScope(c), c.Param("role"), requestInfo(c)); err != nil {
+		sendRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
+
+// ListUserRoles godoc
+// @Summary List a user's roles
+// @Tags admin
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "User ID"
+// @Success 200 {array} models.RoleResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /admin/users/{id}/roles [get]
+func (rc *RoleController) ListUserRoles(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	roles, err := rc.RoleService.ListUserRoles(orgScope(c), uint(userID))
+	if err != nil {
+		sendRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+// AssignRole godoc
+// @Summary Assign a role to a user
+// @Description Organization roles can only be given to members. Takes effect when the user's access token is next refreshed.
+// @Tags admin
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "User ID"
+// @Param role path string true "Role name"
+// @Success 200 {object} gin.H
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /admin/users/{id}/roles/{role} [put]
+func (rc *RoleController) AssignRole(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if err := rc.RoleService.AssignRole(orgScope(c), requestInfo(c), uint(userID), c.Param("role")); err != nil {
+		sendRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role assigned successfully"})
+}
+
+// RemoveRole godoc
+// @Summary Remove a role from a user
+// @Description Takes effect when the user's access token is next refreshed. The last admin cannot lose the admin role, nor the last owner the owner role.
+// @Tags admin
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "User ID"
+// @Param role path string true "Role name"
+// @Success 200 {object} gin.H
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /admin/users/{id}/roles/{role} [delete]
+func (rc *RoleController) RemoveRole(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if err := rc.RoleService.RemoveRole(orgScope(c), requestInfo(c), uint(userID), c.Param("role")); err != nil {
+		sendRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role removed successfully"})
+}
+
+func sendRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrRoleNotFound):
+		utils.SendErrorResponse(c, http.StatusNotFound, "Role not found")
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.SendErrorResponse(c, http.StatusNotFound, "User not found")
+	case errors.Is(err, services.ErrRoleNotAssigned):
+		utils.SendErrorResponse(c, http.StatusNotFound, "The user does not have this role")
+	case errors.Is(err, services.ErrRoleExists):
+		utils.SendErrorResponse(c, http.StatusConflict, "A role with this name already exists")
+	case errors.Is(err, services.ErrSystemRole):
+		utils.SendErrorResponse(c, http.StatusConflict, "Built-in roles cannot be changed or deleted")
+	case errors.Is(err, services.ErrLastAdmin):
+		utils.SendErrorResponse(c, http.StatusConflict, "Cannot remove the admin role from the last admin")
+	case errors.Is(err, services.ErrLastOwner):
+		utils.SendErrorResponse(c, http.StatusConflict, "Cannot remove the owner role from the last owner")
+	case errors.Is(err, services.ErrNotMember):
+		utils.SendErrorResponse(c, http.StatusConflict, "The user is not a member of the organization")
+	case errors.Is(err, services.ErrUnknownPermission):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Unknown permission")
+	case errors.Is(err, services.ErrPermissionNotAllowed):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "organizations:manage can only be granted by a global role")
+	case errors.Is(err, services.ErrNoActiveOrganization):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "No active organization")
+	case errors.Is(err, services.ErrGlobalRolesNotAllowed):
+		utils.SendErrorResponse(c, http.StatusForbidden, "Global roles require the organizations:manage permission")
+	default:
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not process role request")
+	}
+}
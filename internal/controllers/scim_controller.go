@@ -0,0 +1,508 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SCIMController struct {
+	SCIMService *services.SCIMService
+}
+
+func NewSCIMController(scs *services.SCIMService) *SCIMController {
+	return &SCIMController{SCIMService: scs}
+}
+
+// CreateSCIMToken godoc
+// @Summary Create a SCIM token
+// @Description Create a bearer token for the organization's identity provider. Requires organization:write, roles:write and members:write in the active organization. The token is only shown once.
+// @Tags scim
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "Organization ID"
+// @Param input body models.CreateSCIMTokenInput true "Token"
+// @Success 201 {object} models.SCIMTokenResponse
+// @Failure 400 {object} utils.ValidationErrorResponse
+// @Failure 403 {object} gin.H
+// @Router /orgs/{id}/scim-tokens [post]
+func (sc *SCIMController) CreateToken(c *gin.Context) {
+	orgID, ok := organizationID(c)
+	if !ok {
+		return
+	}
+	var input models.CreateSCIMTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendValidationErrorResponse(c, err)
+		return
+	}
+	token, err := sc.SCIMService.CreateToken(orgID, input.Name, requestInfo(c))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not create SCIM token")
+		return
+	}
+	c.JSON(http.StatusCreated, token)
+}
+
+// ListSCIMTokens godoc
+// @Summary List SCIM tokens
+// @Description Requires organization:write, roles:write and members:write in the active organization
+// @Tags scim
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "Organization ID"
+// @Success 200 {array} models.SCIMTokenResponse
+// @Failure 403 {object} gin.H
+// @Router /orgs/{id}/scim-tokens [get]
+func (sc *SCIMController) ListTokens(c *gin.Context) {
+	orgID, ok := organizationID(c)
+	if !ok {
+		return
+	}
+	tokens, err := sc.SCIMService.ListTokens(orgID)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not list SCIM tokens")
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// DeleteSCIMToken godoc
+// @Summary Delete a SCIM token
+// @Description Requires organization:write, roles:write and members:write in the active organization
+// @Tags scim
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "Organization ID"
+// @Param token_id path int true "Token ID"
+// @Success 200 {object} gin.H
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /orgs/{id}/scim-tokens/{token_id} [delete]
+func (sc *SCIMController) DeleteToken(c *gin.Context) {
+	orgID, ok := organizationID(c)
+	if !ok {
+		return
+	}
+	tokenID, err := strconv.ParseUint(c.Param("token_id"), 10, 64)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid token ID")
+		return
+	}
+	if err := sc.SCIMService.DeleteToken(orgID, uint(tokenID), requestInfo(c)); err != nil {
+		if errors.Is(err, services.ErrSCIMTokenNotFound) {
+			utils.SendErrorResponse(c, http.StatusNotFound, "SCIM token not found")
+			return
+		}
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not delete SCIM token")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "SCIM token deleted successfully"})
+}
+
+// ServiceProviderConfig godoc
+// @Summary SCIM service provider configuration
+// @Tags scim
+// @Produce  json
+// @Success 200 {object} map[string]interface{}
+// @Router /scim/v2/ServiceProviderConfig [get]
+func (sc *SCIMController) ServiceProviderConfig(c *gin.Context) {
+	sendSCIM(c, http.StatusOK, services.SCIMServiceProviderConfig(issuerURL(c)))
+}
+
+// ResourceTypes godoc
+// @Summary SCIM resource types
+// @Tags scim
+// @Produce  json
+// @Param id path string false "Resource type"
+// @Success 200 {object} models.SCIMListResponse
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Router /scim/v2/ResourceTypes [get]
+// @Router /scim/v2/ResourceTypes/{id} [get]
+func (sc *SCIMController) ResourceTypes(c *gin.Context) {
+	sendSCIMDefinitions(c, services.SCIMResourceTypes(issuerURL(c)), "Resource type not found")
+}
+
+// Schemas godoc
+// @Summary SCIM schemas
+// @Tags scim
+// @Produce  json
+// @Param id path string false "Schema URN"
+// @Success 200 {object} models.SCIMListResponse
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Router /scim/v2/Schemas [get]
+// @Router /scim/v2/Schemas/{id} [get]
+func (sc *SCIMController) Schemas(c *gin.Context) {
+	sendSCIMDefinitions(c, services.SCIMSchemas(issuerURL(c)), "Schema not found")
+}
+
+// ListUsers godoc
+// @Summary List SCIM users
+// @Description List the members of the token's organization. Supports filters of the form attribute eq "value" on userName, emails.value, externalId and id.
+// @Tags scim
+// @Produce  json
+// @Param Authorization header string true "SCIM token"
+// @Param filter query string false "Filter"
+// @Param startIndex query int false "1-based index of the first result"
+// @Param count query int false "Page size"
+// @Success 200 {object} models.SCIMListResponse
+// @Failure 400 {object} models.SCIMErrorResponse
+// @Failure 401 {object} models.SCIMErrorResponse
+// @Router /scim/v2/Users [get]
+func (sc *SCIMController) ListUsers(c *gin.Context) {
+	startIndex, count, ok := scimPageParams(c)
+	if !ok {
+		return
+	}
+	list, err := sc.SCIMService.ListUsers(scimOrgID(c), c.Query("filter"), startIndex, count)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	for i := range list.Resources.([]models.SCIMUser) {
+		setSCIMUserLocation(c, &list.Resources.([]models.SCIMUser)[i])
+	}
+	sendSCIM(c, http.StatusOK, list)
+}
+
+// GetUser godoc
+// @Summary Get a SCIM user
+// @Tags scim
+// @Produce  json
+// @Param Authorization header string true "SCIM token"
+// @Param id path string true "User ID"
+// @Success 200 {object} models.SCIMUser
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Router /scim/v2/Users/{id} [get]
+func (sc *SCIMController) GetUser(c *gin.Context) {
+	user, err := sc.SCIMService.GetUser(scimOrgID(c), c.Param("id"))
+	sendSCIMUser(c, http.StatusOK, user, err)
+}
+
+// CreateUser godoc
+// @Summary Provision a SCIM user
+// @Description Add a member to the token's organization. An account is created unless one already exists for the email.
+// @Tags scim
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "SCIM token"
+// @Param input body models.SCIMUser true "User"
+// @Success 201 {object} models.SCIMUser
+// @Failure 400 {object} models.SCIMErrorResponse
+// @Failure 409 {object} models.SCIMErrorResponse
+// @Router /scim/v2/Users [post]
+func (sc *SCIMController) CreateUser(c *gin.Context) {
+	var input models.SCIMUser
+	if !bindSCIM(c, &input) {
+		return
+	}
+	user, err := sc.SCIMService.CreateUser(scimOrgID(c), input, scimRequestInfo(c))
+	sendSCIMUser(c, http.StatusCreated, user, err)
+}
+
+// ReplaceUser godoc
+// @Summary Replace a SCIM user
+// @Description Name, email and password can only be changed for accounts the organization provisioned
+// @Tags scim
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "SCIM token"
+// @Param id path string true "User ID"
+// @Param input body models.SCIMUser true "User"
+// @Success 200 {object} models.SCIMUser
+// @Failure 400 {object} models.SCIMErrorResponse
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Failure 409 {object} models.SCIMErrorResponse
+// @Router /scim/v2/Users/{id} [put]
+func (sc *SCIMController) ReplaceUser(c *gin.Context) {
+	var input models.SCIMUser
+	if !bindSCIM(c, &input) {
+		return
+	}
+	user, err := sc.SCIMService.ReplaceUser(scimOrgID(c), c.Param("id"), input, scimRequestInfo(c))
+	sendSCIMUser(c, http.StatusOK, user, err)
+}
+
+// PatchUser godoc
+// @Summary Patch a SCIM user
+// @Tags scim
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "SCIM token"
+// @Param id path string true "User ID"
+// @Param input body models.SCIMPatchRequest true "Operations"
+// @Success 200 {object} models.SCIMUser
+// @Failure 400 {object} models.SCIMErrorResponse
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Router /scim/v2/Users/{id} [patch]
+func (sc *SCIMController) PatchUser(c *gin.Context) {
+	var input models.SCIMPatchRequest
+	if !bindSCIM(c, &input) {
+		return
+	}
+	user, err := sc.SCIMService.PatchUser(scimOrgID(c), c.Param("id"), input, scimRequestInfo(c))
+	sendSCIMUser(c, http.StatusOK, user, err)
+}
+
+// DeleteUser godoc
+// @Summary Deprovision a SCIM user
+// @Description Remove the user from the token's organization. The account itself is kept.
+// @Tags scim
+// @Param Authorization header string true "SCIM token"
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 400 {object} models.SCIMErrorResponse
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Router /scim/v2/Users/{id} [delete]
+func (sc *SCIMController) DeleteUser(c *gin.Context) {
+	if err := sc.SCIMService.DeleteUser(scimOrgID(c), c.Param("id"), scimRequestInfo(c)); err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListGroups godoc
+// @Summary List SCIM groups
+// @Description List the roles of the token's organization. Supports filters of the form attribute eq "value" on displayName and id.
+// @Tags scim
+// @Produce  json
+// @Param Authorization header string true "SCIM token"
+// @Param filter query string false "Filter"
+// @Param startIndex query int false "1-based index of the first result"
+// @Param count query int false "Page size"
+// @Success 200 {object} models.SCIMListResponse
+// @Failure 400 {object} models.SCIMErrorResponse
+// @Router /scim/v2/Groups [get]
+func (sc *SCIMController) ListGroups(c *gin.Context) {
+	startIndex, count, ok := scimPageParams(c)
+	if !ok {
+		return
+	}
+	list, err := sc.SCIMService.ListGroups(scimOrgID(c), c.Query("filter"), startIndex, count)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	for i := range list.Resources.([]models.SCIMGroup) {
+		setSCIMGroupLocation(c, &list.Resources.([]models.SCIMGroup)[i])
+	}
+	sendSCIM(c, http.StatusOK, list)
+}
+
+// GetGroup godoc
+// @Summary Get a SCIM group
+// @Tags scim
+// @Produce  json
+// @Param Authorization header string true "SCIM token"
+// @Param id path string true "Group ID"
+// @Success 200 {object} models.SCIMGroup
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Router /scim/v2/Groups/{id} [get]
+func (sc *SCIMController) GetGroup(c *gin.Context) {
+	group, err := sc.SCIMService.GetGroup(scimOrgID(c), c.Param("id"))
+	sendSCIMGroup(c, http.StatusOK, group, err)
+}
+
+// CreateGroup godoc
+// @Summary Create a SCIM group
+// @Description Create an organization role without permissions and give it to the members
+// @Tags scim
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "SCIM token"
+// @Param input body models.SCIMGroup true "Group"
+// @Success 201 {object} models.SCIMGroup
+// @Failure 400 {object} models.SCIMErrorResponse
+// @Failure 409 {object} models.SCIMErrorResponse
+// @Router /scim/v2/Groups [post]
+func (sc *SCIMController) CreateGroup(c *gin.Context) {
+	var input models.SCIMGroup
+	if !bindSCIM(c, &input) {
+		return
+	}
+	group, err := sc.SCIMService.CreateGroup(scimOrgID(c), input, scimRequestInfo(c))
+	sendSCIMGroup(c, http.StatusCreated, group, err)
+}
+
+// ReplaceGroup godoc
+// @Summary Replace a SCIM group
+// @Description Rename the role and replace its members. Built-in roles cannot be renamed.
+// @Tags scim
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "SCIM token"
+// @Param id path string true "Group ID"
+// @Param input body models.SCIMGroup true "Group"
+// @Success 200 {object} models.SCIMGroup
+// @Failure 400 {object} models.SCIMErrorResponse
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Failure 409 {object} models.SCIMErrorResponse
+// @Router /scim/v2/Groups/{id} [put]
+func (sc *SCIMController) ReplaceGroup(c *gin.Context) {
+	var input models.SCIMGroup
+	if !bindSCIM(c, &input) {
+		return
+	}
+	group, err := sc.SCIMService.ReplaceGroup(scimOrgID(c), c.Param("id"), input, scimRequestInfo(c))
+	sendSCIMGroup(c, http.StatusOK, group, err)
+}
+
+// PatchGroup godoc
+// @Summary Patch a SCIM group
+// @Tags scim
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "SCIM token"
+// @Param id path string true "Group ID"
+// @Param input body models.SCIMPatchRequest true "Operations"
+// @Success 200 {object} models.SCIMGroup
+// @Failure 400 {object} models.SCIMErrorResponse
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Router /scim/v2/Groups/{id} [patch]
+func (sc *SCIMController) PatchGroup(c *gin.Context) {
+	var input models.SCIMPatchRequest
+	if !bindSCIM(c, &input) {
+		return
+	}
+	group, err := sc.SCIMService.PatchGroup(scimOrgID(c), c.Param("id"), input, scimRequestInfo(c))
+	sendSCIMGroup(c, http.StatusOK, group, err)
+}
+
+// DeleteGroup godoc
+// @Summary Delete a SCIM group
+// @Description Built-in roles cannot be deleted
+// @Tags scim
+// @Param Authorization header string true "SCIM token"
+// @Param id path string true "Group ID"
+// @Success 204
+// @Failure 400 {object} models.SCIMErrorResponse
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Router /scim/v2/Groups/{id} [delete]
+func (sc *SCIMController) DeleteGroup(c *gin.Context) {
+	if err := sc.SCIMService.DeleteGroup(scimOrgID(c), c.Param("id"), scimRequestInfo(c)); err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// scimOrgID returns the organization SCIMAuth authenticated.
+func scimOrgID(c *gin.Context) uint {
+	orgID, _ := c.Get("scimOrgID")
+	return orgID.(uint)
+}
+
+// scimRequestInfo describes a SCIM request for the audit log. It has no
+// actor; the organization whose token was used is recorded instead.
+func scimRequestInfo(c *gin.Context) services.RequestInfo {
+	info := requestInfo(c)
+	info.OrganizationID = scimOrgID(c)
+	return info
+}
+
+// scimPageParams reads startIndex and count, defaulting to the first page
+// of SCIMDefaultCount results.
+func scimPageParams(c *gin.Context) (int, int, bool) {
+	startIndex, err := strconv.Atoi(c.DefaultQuery("startIndex", "1"))
+	if err != nil {
+		sendSCIMError(c, &services.SCIMError{Status: http.StatusBadRequest, Type: "invalidValue", Detail: "startIndex must be a number"})
+		return 0, 0, false
+	}
+	count, err := strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(services.SCIMDefaultCount)))
+	if err != nil {
+		sendSCIMError(c, &services.SCIMError{Status: http.StatusBadRequest, Type: "invalidValue", Detail: "count must be a number"})
+		return 0, 0, false
+	}
+	return startIndex, count, true
+}
+
+func bindSCIM(c *gin.Context, input interface{}) bool {
+	if err := c.ShouldBindJSON(input); err != nil {
+		sendSCIMError(c, &services.SCIMError{Status: http.StatusBadRequest, Type: "invalidSyntax", Detail: "Request body is not valid JSON"})
+		return false
+	}
+	return true
+}
+
+func sendSCIMUser(c *gin.Context, status int, user *models.SCIMUser, err error) {
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	setSCIMUserLocation(c, user)
+	c.Header("Location", user.Meta.Location)
+	sendSCIM(c, status, user)
+}
+
+func sendSCIMGroup(c *gin.Context, status int, group *models.SCIMGroup, err error) {
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	setSCIMGroupLocation(c, group)
+	c.Header("Location", group.Meta.Location)
+	sendSCIM(c, status, group)
+}
+
+func setSCIMUserLocation(c *gin.Context, user *models.SCIMUser) {
+	base := issuerURL(c) + "/scim/v2/"
+	user.Meta.Location = base + "Users/" + user.ID
+	for i := range user.Groups {
+		user.Groups[i].Ref = base + "Groups/" + user.Groups[i].Value
+	}
+}
+
+func setSCIMGroupLocation(c *gin.Context, group *models.SCIMGroup) {
+	base := issuerURL(c) + "/scim/v2/"
+	group.Meta.Location = base + "Groups/" + group.ID
+	for i := range group.Members {
+		group.Members[i].Ref = base + "Users/" + group.Members[i].Value
+	}
+}
+
+// sendSCIMDefinitions answers with every discovery document, or with the
+// one named by the :id path parameter.
+func sendSCIMDefinitions(c *gin.Context, definitions []map[string]interface{}, notFound string) {
+	id := c.Param("id")
+	if id == "" {
+		sendSCIM(c, http.StatusOK, models.SCIMListResponse{
+			Schemas:      []string{models.SCIMListResponseSchema},
+			TotalResults: int64(len(definitions)),
+			StartIndex:   1,
+			ItemsPerPage: len(definitions),
+			Resources:    definitions,
+		})
+		return
+	}
+	for _, definition := range definitions {
+		if definition["id"] == id {
+			sendSCIM(c, http.StatusOK, definition)
+			return
+		}
+	}
+	sendSCIMError(c, &services.SCIMError{Status: http.StatusNotFound, Detail: notFound})
+}
+
+func sendSCIM(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", models.SCIMContentType)
+	c.JSON(status, body)
+}
+
+func sendSCIMError(c *gin.Context, err error) {
+	var scimErr *services.SCIMError
+	if !errors.As(err, &scimErr) {
+		scimErr = &services.SCIMError{Status: http.StatusInternalServerError, Detail: "Could not process SCIM request"}
+	}
+	sendSCIM(c, scimErr.Status, models.SCIMErrorResponse{
+		Schemas:  []string{models.SCIMErrorSchema},
+		Status:   strconv.Itoa(scimErr.Status),
+		SCIMType: scimErr.Type,
+		Detail:   scimErr.Detail,
+	})
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionController struct {
+	SessionService *services.SessionService
+}
+
+func NewSessionController(ss *services.SessionService) *SessionController {
+	return &SessionController{SessionService: ss}
+}
+
+// ListSessions godoc
+// @Summary List sessions
+// @Description List the active sessions (devices) of the authenticated user
+// @Tags session
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Success 200 {array} models.SessionResponse
+// @Failure 401 {object} gin.H
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /user/sessions [get]
+func (sc *SessionController) ListSessions(c *gin.Context) {
+	userID := c.GetUint("userID")
+	var sessions []models.SessionResponse
+	sessions, err := sc.SessionService.ListSessions(userID, c.GetString("sessionID"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not list sessions")
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession godoc
+// @Summary Revoke a session
+// @Description Revoke one of the authenticated user's sessions
+// @Tags session
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path string true "Session ID"
+// @Success 200 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /user/sessions/{id} [delete]
+func (sc *SessionController) RevokeSession(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if err := sc.SessionService.RevokeSession(userID, c.Param("id")); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			utils.SendErrorResponse(c, http.StatusNotFound, "Session not found")
+		} else {
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not revoke session")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// RevokeOtherSessions godoc
+// @Summary Revoke other sessions
+// @Description Revoke every session of the authenticated user except the current one
+// @Tags session
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Success 200 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /user/sessions [delete]
+func (sc *SessionController) RevokeOtherSessions(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if err := sc.SessionService.RevokeAllSessions(userID, c.GetString("sessionID")); err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not revoke sessions")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Other sessions revoked successfully"})
+}
+
+// Logout godoc
+// @Summary Logout
+// @Description Revoke the current session and its refresh tokens
+// @Tags session
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Success 200 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /user/logout [post]
+func (sc *SessionController) Logout(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if err := sc.SessionService.RevokeSession(userID, c.GetString("sessionID")); err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not logout")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// LogoutAll godoc
+// @Summary Logout everywhere
+// @Description Revoke every session of the authenticated user, including the current one
+// @Tags session
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Success 200 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /user/logout-all [post]
+func (sc *SessionController) LogoutAll(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if err := sc.SessionService.RevokeAllSessions(userID, ""); err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not logout")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all sessions successfully"})
+}
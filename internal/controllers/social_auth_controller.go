@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"user-service/config"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/pkg/social"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oauthStateCookie holds the signed state of a social login in progress.
+const oauthStateCookie = "oauth_state"
+
+type SocialAuthController struct {
+	SocialAuthService  *services.SocialAuthService
+	AccountLinkService *services.AccountLinkService
+	TokenService       *services.TokenService
+}
+
+func NewSocialAuthController(sas *services.SocialAuthService, als *services.AccountLinkService, ts *services.TokenService) *SocialAuthController {
+	return &SocialAuthController{SocialAuthService: sas, AccountLinkService: als, TokenService: ts}
+}
+
+// ListProviders godoc
+// @Summary List login providers
+// @Description List the names of the configured external login providers
+// @Tags auth
+// @Produce  json
+// @Success 200 {object} gin.H
+// @Router /auth/providers [get]
+func (sc *SocialAuthController) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": sc.SocialAuthService.ListProviders()})
+}
+
+// Login godoc
+// @Summary Login with an external provider
+// @Description Redirect to the login page of a configured provider such as google or github. With return_to (a relative path or a URL on an allowed origin) the callback redirects there and passes tokens, or error, in the URL fragment.
+// @Tags auth
+// @Param provider path string true "Provider name"
+// @Param return_to query string false "Where to send the browser after login"
+// @Success 307
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 502 {object} utils.ErrorResponse
+// @Router /auth/{provider}/login [get]
+func (sc *SocialAuthController) Login(c *gin.Context) {
+	sc.login(c, c.Param("provider"))
+}
+
+// Callback godoc
+// @Summary External provider callback
+// @Description Finish a provider login and return tokens, or an MFA challenge when MFA is enabled
+// @Tags auth
+// @Produce  json
+// @Param provider path string true "Provider name"
+// @Param code query string true "Authorization code"
+// @Param state query string true "OAuth state, checked against the oauth_state cookie"
+// @Success 200 {object} utils.TokenResponse
+// @Success 302 "Redirect to return_to with the result in the fragment"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /auth/{provider}/callback [get]
+func (sc *SocialAuthController) Callback(c *gin.Context) {
+	sc.callback(c, c.Param("provider"))
+}
+
+// TokenLogin godoc
+// @Summary Login with a provider ID token
+// @Description Sign in with an ID token obtained by a mobile or single-page app from the provider's SDK, such as Google Sign-In. Returns tokens, or an MFA challenge when MFA is enabled.
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param provider path string true "Provider name"
+// @Param input body models.IDTokenLoginInput true "ID token"
+// @Success 200 {object} utils.TokenResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /auth/{provider}/token [post]
+func (sc *SocialAuthController) TokenLogin(c *gin.Context) {
+	var input models.IDTokenLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	user, err := sc.SocialAuthService.LoginWithIDToken(c.Request.Context(), c.Param("provider"), input.IDToken, input.Nonce, requestInfo(c))
+	if err != nil {
+		sendSocialAuthError(c, err)
+		return
+	}
+	if user.MFAEnabled {
+		sendMFAChallenge(c, user)
+		return
+	}
+	accessToken, refreshToken, err := sc.TokenService.IssueTokens(user, c.Param("provider"), requestInfo(c))
+	if err != nil {
+		sendIssueTokensError(c, err)
+		return
+	}
+	utils.SendTokenResponse(c, accessToken, refreshToken)
+}
+
+// GoogleLogin godoc
+// @Summary Login with Google
+// @Description Login a user with Google OAuth2. Same as /auth/google/login.
+// @Tags User
+// @Success 307
+// @Router /google-login [get]
+func (sc *SocialAuthController) GoogleLogin(c *gin.Context) {
+	sc.login(c, services.GoogleProvider)
+}
+
+// GoogleCallback godoc
+// @Summary Google OAuth2 callback
+// @Description Callback for Google OAuth2 login. Same as /auth/google/callback.
+// @Tags User
+// @Success 200 {object} utils.TokenResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /google-callback [get]
+func (sc *SocialAuthController) GoogleCallback(c *gin.Context) {
+	sc.callback(c, services.GoogleProvider)
+}
+
+func (sc *SocialAuthController) login(c *gin.Context, provider string) {
+	authURL, stateToken, err := sc.SocialAuthService.StartLogin(c.Request.Context(), provider, c.Query("return_to"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidReturnTo) {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "return_to is not an allowed redirect target")
+			return
+		}
+		sendSocialAuthError(c, err)
+		return
+	}
+	setOAuthStateCookie(c, stateToken, int(services.OAuthStateExpiry.Seconds()))
+	c.Redirect(http.StatusTemporaryRedirect, authURL)
+}
+
+func (sc *SocialAuthController) callback(c *gin.Context, provider string) {
+	stateToken, _ := c.Cookie(oauthStateCookie)
+	// The state cookie is single use, whatever the outcome.
+	setOAuthStateCookie(c, "", -1)
+	state, err := sc.SocialAuthService.VerifyState(provider, stateToken, c.Query("state"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid or expired login state")
+		return
+	}
+	if providerError := c.Query("error"); providerError != "" {
+		if state.ReturnTo != "" {
+			redirectWithFragment(c, state.ReturnTo, url.Values{
+				"error":             {"access_denied"},
+				"error_description": {"Login was cancelled at the provider"},
+			})
+			return
+		}
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "Login was cancelled at the provider")
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Missing authorization code")
+		return
+	}
+	if state.LinkUserID != 0 {
+		sc.finishLink(c, code, state)
+		return
+	}
+
+	user, err := sc.SocialAuthService.Login(c.Request.Context(), code, state, requestInfo(c))
+	if err != nil {
+		if state.ReturnTo != "" {
+			_, errorCode, message := socialAuthError(err)
+			redirectWithFragment(c, state.ReturnTo, url.Values{"error": {errorCode}, "error_description": {message}})
+			return
+		}
+		sendSocialAuthError(c, err)
+		return
+	}
+	if user.MFAEnabled {
+		if state.ReturnTo == "" {
+			sendMFAChallenge(c, user)
+			return
+		}
+		mfaToken, err := utils.GenerateMFAToken(user.ID)
+		if err != nil {
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to generate MFA token")
+			return
+		}
+		redirectWithFragment(c, state.ReturnTo, url.Values{"mfa_required": {"true"}, "mfa_token": {mfaToken}})
+		return
+	}
+	accessToken, refreshToken, err := sc.TokenService.IssueTokens(user, provider, requestInfo(c))
+	if err != nil {
+		sendIssueTokensError(c, err)
+		return
+	}
+	if state.ReturnTo == "" {
+		utils.SendTokenResponse(c, accessToken, refreshToken)
+		return
+	}
+	redirectWithFragment(c, state.ReturnTo, url.Values{
+		"access_token":  {accessToken},
+		"refresh_token": {refreshToken},
+		"token_type":    {"Bearer"},
+	})
+}
+
+// finishLink links the provider account to the user who started the link
+// from their account settings.
+func (sc *SocialAuthController) finishLink(c *gin.Context, code string, state *utils.OAuthStateClaims) {
+	if err := sc.AccountLinkService.LinkProvider(c.Request.Context(), code, state, requestInfo(c)); err != nil {
+		status, errorCode, message := linkProviderError(err)
+		if state.ReturnTo != "" {
+			redirectWithFragment(c, state.ReturnTo, url.Values{"error": {errorCode}, "error_description": {message}})
+			return
+		}
+		utils.SendErrorResponse(c, status, message)
+		return
+	}
+	if state.ReturnTo != "" {
+		redirectWithFragment(c, state.ReturnTo, url.Values{"linked": {state.Provider}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Login provider linked successfully"})
+}
+
+// redirectWithFragment sends the browser back to the validated return_to
+// with the login result in the URL fragment, which browsers do not send to
+// servers.
+func redirectWithFragment(c *gin.Context, returnTo string, result url.Values) {
+	target, _ := url.Parse(returnTo)
+	target.Fragment = ""
+	target.RawFragment = ""
+	c.Redirect(http.StatusFound, target.String()+"#"+result.Encode())
+}
+
+// setOAuthStateCookie stores the signed login state. SameSite=Lax lets the
+// cookie come back on the provider's top-level redirect to the callback.
+func setOAuthStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || strings.HasPrefix(config.AppConfig.OIDCIssuer, "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, value, maxAge, "/", "", secure, true)
+}
+
+func socialAuthError(err error) (int, string, string) {
+	switch {
+	case errors.Is(err, social.ErrUnknownProvider):
+		return http.StatusNotFound, "unknown_provider", "Unknown login provider"
+	case errors.Is(err, services.ErrEmailNotVerified):
+		return http.StatusForbidden, "email_not_verified", "Email address has not been verified"
+	case errors.Is(err, utils.ErrAccountSuspended):
+		return http.StatusForbidden, "account_suspended", "Account is suspended"
+	case errors.Is(err, utils.ErrAccountBanned):
+		return http.StatusForbidden, "account_banned", "Account is banned"
+	case errors.Is(err, utils.ErrAccountPending):
+		return http.StatusForbidden, "account_pending", "Account is pending activation"
+	case errors.Is(err, services.ErrAccountLinkRequired):
+		return http.StatusConflict, "account_link_required", "An account with this email already exists; log in and link the provider from your account settings"
+	case errors.Is(err, social.ErrIDTokenNotSupported):
+		return http.StatusBadRequest, "id_token_not_supported", "This provider does not support ID token sign-in"
+	case errors.Is(err, social.ErrInvalidIDToken):
+		return http.StatusUnauthorized, "invalid_id_token", "The provider's ID token could not be verified"
+	}
+	return http.StatusBadGateway, "login_failed", "Login with the provider failed"
+}
+
+func sendSocialAuthError(c *gin.Context, err error) {
+	status, _, message := socialAuthError(err)
+	utils.SendErrorResponse(c, status, message)
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TokenController struct {
+	TokenService *services.TokenService
+}
+
+func NewTokenController(ts *services.TokenService) *TokenController {
+	return &TokenController{TokenService: ts}
+}
+
+// RefreshToken godoc
+// @Summary Refresh tokens
+// @Description Exchange a refresh token for a new access/refresh token pair. Each refresh token can only be used once.
+// @Tags token
+// @Accept  json
+// @Produce  json
+// @Param token body models.RefreshTokenInput true "Refresh Token"
+// @Success 200 {object} utils.TokenResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /token/refresh [post]
+func (tc *TokenController) RefreshToken(c *gin.Context) {
+	var input models.RefreshTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+
+	accessToken, refreshToken, err := tc.TokenService.RefreshTokens(input.RefreshToken, "")
+	if err != nil {
+		if message, ok := utils.AccountStatusMessage(err); ok {
+			utils.SendErrorResponse(c, http.StatusForbidden, message)
+			return
+		}
+		switch {
+		case errors.Is(err, services.ErrRefreshTokenReused):
+			utils.SendErrorResponse(c, http.StatusUnauthorized, "Refresh token has already been used")
+		case errors.Is(err, services.ErrInvalidRefreshToken):
+			utils.SendErrorResponse(c, http.StatusUnauthorized, "Invalid refresh token")
+		default:
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not refresh token")
+		}
+		return
+	}
+
+	utils.SendTokenResponse(c, accessToken, refreshToken)
+}
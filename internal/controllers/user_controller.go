@@ -1,9 +1,9 @@
 package controllers
 
 import (
-	"fmt"
+	"errors"
+	"log"
 	"net/http"
-	"user-service/config"
 	"user-service/internal/models"
 	"user-service/internal/services"
 	"user-service/utils"
@@ -12,11 +12,13 @@ import (
 )
 
 type UserController struct {
-	UserService *services.UserService
+	UserService              *services.UserService
+	TokenService             *services.TokenService
+	EmailVerificationService *services.EmailVerificationService
 }
 
-func NewUserController(us *services.UserService) *UserController {
-	return &UserController{UserService: us}
+func NewUserController(us *services.UserService, ts *services.TokenService, es *services.EmailVerificationService) *UserController {
+	return &UserController{UserService: us, TokenService: ts, EmailVerificationService: es}
 }
 
 // Register godoc
@@ -26,15 +28,15 @@ func NewUserController(us *services.UserService) *UserController {
 // @Accept  json
 // @Produce  json
 // @Param user body models.RegisterInput true "User Registration Data"
-// @Success 200 {object} models.User
-// @Failure 400 {object} utils.ErrorResponse
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} utils.ValidationErrorResponse
 // @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /register [post]
 func (uc *UserController) Register(c *gin.Context) {
 	var input models.RegisterInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		utils.SendValidationErrorResponse(c, err)
 		return
 	}
 	hashPassword, err := utils.HashPassword(input.Password)
@@ -49,7 +51,7 @@ func (uc *UserController) Register(c *gin.Context) {
 		Password: hashPassword,
 	}
 
-	err = uc.UserService.RegisterUser(&user)
+	err = uc.UserService.RegisterUser(&user, requestInfo(c))
 	if err != nil {
 		if err.Error() == "email already exists" {
 			utils.SendErrorResponse(c, http.StatusBadRequest, "Email already exists")
@@ -58,7 +60,10 @@ func (uc *UserController) Register(c *gin.Context) {
 		}
 		return
 	}
-	c.JSON(http.StatusOK, user)
+	if err := uc.EmailVerificationService.SendVerification(&user); err != nil {
+		log.Printf("failed to send verification email: %v", err)
+	}
+	c.JSON(http.StatusOK, services.NewUserResponse(&user))
 }
 
 // Login godoc
@@ -68,9 +73,10 @@ func (uc *UserController) Register(c *gin.Context) {
 // @Accept  json
 // @Produce  json
 // @Param user body models.LoginInput true "User Login Data"
-// @Success 200 {object} utils.TokenResponse
+// @Success 200 {object} utils.TokenResponse "Tokens, or models.MFAChallengeResponse when MFA is enabled"
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
 // @Router /login [post]
 func (uc *UserController) Login(c *gin.Context) {
 	var input models.LoginInput
@@ -79,69 +85,49 @@ func (uc *UserController) Login(c *gin.Context) {
 		return
 	}
 
-	user, err := uc.UserService.AuthenticateUser(input.Email, input.Password)
+	user, err := uc.UserService.AuthenticateUser(input.Email, input.Password, requestInfo(c))
 	if err != nil {
-		utils.SendErrorResponse(c, http.StatusUnauthorized, "Incorrect email or password")
+		if message, ok := utils.AccountStatusMessage(err); ok {
+			utils.SendErrorResponse(c, http.StatusForbidden, message)
+		} else if errors.Is(err, services.ErrEmailNotVerified) {
+			utils.SendErrorResponse(c, http.StatusForbidden, "Email address has not been verified")
+		} else {
+			utils.SendErrorResponse(c, http.StatusUnauthorized, "Incorrect email or password")
+		}
 		return
 	}
-	accessToken, err := utils.GenerateToken(user.ID, user.Role, false)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
+	if user.MFAEnabled {
+		sendMFAChallenge(c, user)
 		return
 	}
-
-	refreshToken, err := utils.GenerateToken(user.ID, user.Role, true)
+	accessToken, refreshToken, err := uc.TokenService.IssueTokens(user, models.LoginMethodPassword, requestInfo(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+		sendIssueTokensError(c, err)
 		return
 	}
 
 	utils.SendTokenResponse(c, accessToken, refreshToken)
 }
 
-// GoogleLogin godoc
-// @Summary Login with Google
-// @Description Login a user with Google OAuth2
-// @Tags User
-// @Success 302
-// @Router /google-login [get]
-func (uc *UserController) GoogleLogin(c *gin.Context) {
-	authURL := config.GoogleOAuthConfig.AuthCodeURL("randomstate")
-	fmt.Println(authURL)
-	c.Redirect(http.StatusTemporaryRedirect, authURL)
-}
-
-// GoogleCallback godoc
-// @Summary Google OAuth2 callback
-// @Description Callback for Google OAuth2 login
-// @Tags User
-// @Success 200 {string} string "data"
-// @Failure 500 {object} gin.H
-// @Router /google-callback [get]
-func (uc *UserController) GoogleCallback(c *gin.Context) {
-	code := c.Query("code")
-	user, err := uc.UserService.HandleGoogleCallback(code)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to handle Google callback"})
-		return
-	}
-
-	accessToken, err := utils.GenerateToken(user.ID, user.Role, false)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
+// sendIssueTokensError answers a failed TokenService.IssueTokens, which
+// refuses accounts that are not active.
+func sendIssueTokensError(c *gin.Context, err error) {
+	if message, ok := utils.AccountStatusMessage(err); ok {
+		utils.SendErrorResponse(c, http.StatusForbidden, message)
 		return
 	}
+	utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to generate tokens")
+}
 
-	refreshToken, err := utils.GenerateToken(user.ID, user.Role, true)
+// sendMFAChallenge answers a successful first-factor login of a user with MFA
+// enabled. The client finishes the login through POST /login/mfa.
+func sendMFAChallenge(c *gin.Context, user *models.User) {
+	mfaToken, err := utils.GenerateMFAToken(user.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate MFA token"})
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
-	})
+	c.JSON(http.StatusOK, models.MFAChallengeResponse{MFARequired: true, MFAToken: mfaToken})
 }
 
 func (uc *UserController) CreateSuperUser(c *gin.Context) {
@@ -156,7 +142,7 @@ func (uc *UserController) CreateSuperUser(c *gin.Context) {
 		return
 	}
 
-	if err := uc.UserService.CreateSuperUser(input.Email, input.Password, input.Name); err != nil {
+	if err := uc.UserService.CreateSuperUser(input.Email, input.Password, input.Name, requestInfo(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -185,28 +171,97 @@ func (uc *UserController) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	user, err := uc.UserService.GetUserByID(userID.(uint))
+	err := uc.UserService.ChangePassword(userID.(uint), input.OldPassword, input.NewPassword, requestInfo(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not find user"})
+		switch {
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not find user"})
+		case errors.Is(err, utils.ErrInvalidCredentials):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect old password"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update user"})
+		}
 		return
 	}
 
-	if !utils.CheckPasswordHash(input.OldPassword, user.Password) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect old password"})
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
+}
+
+// GetProfile godoc
+// @Summary Get profile
+// @Description Get the profile of the authenticated user
+// @Tags User
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Success 200 {object} models.UserResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /user/profile [get]
+func (uc *UserController) GetProfile(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	profile, err := uc.UserService.GetProfile(userID.(uint))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusNotFound, "User not found")
 		return
 	}
+	c.JSON(http.StatusOK, profile)
+}
 
-	hashedPassword, err := utils.HashPassword(input.NewPassword)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not hash password"})
+// ReplaceProfile godoc
+// @Summary Replace profile
+// @Description Replace all profile fields of the authenticated user; omitted optional fields are cleared
+// @Tags User
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param profile body models.ReplaceProfileInput true "Profile"
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} utils.ValidationErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /user/profile [put]
+func (uc *UserController) ReplaceProfile(c *gin.Context) {
+	var input models.ReplaceProfileInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendValidationErrorResponse(c, err)
 		return
 	}
+	uc.updateProfile(c, models.UpdateProfileInput{
+		Name:      &input.Name,
+		AvatarURL: &input.AvatarURL,
+		Locale:    &input.Locale,
+		Timezone:  &input.Timezone,
+	})
+}
 
-	user.Password = hashedPassword
-	if err := uc.UserService.UpdateUser(user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update user"})
+// UpdateProfile godoc
+// @Summary Update profile
+// @Description Update the given profile fields of the authenticated user
+// @Tags User
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param profile body models.UpdateProfileInput true "Profile fields to change"
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} utils.ValidationErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /user/profile [patch]
+func (uc *UserController) UpdateProfile(c *gin.Context) {
+	var input models.UpdateProfileInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendValidationErrorResponse(c, err)
 		return
 	}
+	uc.updateProfile(c, input)
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
+func (uc *UserController) updateProfile(c *gin.Context, input models.UpdateProfileInput) {
+	userID, _ := c.Get("userID")
+	profile, err := uc.UserService.UpdateProfile(userID.(uint), input)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not update profile")
+		return
+	}
+	c.JSON(http.StatusOK, profile)
 }
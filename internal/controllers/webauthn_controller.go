@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"user-service/internal/models"
+	"user-service/internal/services"
+	"user-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebAuthnController struct {
+	WebAuthnService *services.WebAuthnService
+	TokenService    *services.TokenService
+}
+
+func NewWebAuthnController(ws *services.WebAuthnService, ts *services.TokenService) *WebAuthnController {
+	return &WebAuthnController{WebAuthnService: ws, TokenService: ts}
+}
+
+// BeginRegistration godoc
+// @Summary Start passkey registration
+// @Description Re-authenticate and return the PublicKeyCredentialCreationOptions for navigator.credentials.create(). A second factor is required when MFA is on.
+// @Tags webauthn
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param input body models.ReauthenticationInput true "Password or account email, and a second factor when MFA is on"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /user/webauthn/register/begin [post]
+func (wc *WebAuthnController) BeginRegistration(c *gin.Context) {
+	var input models.ReauthenticationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	options, err := wc.WebAuthnService.BeginRegistration(c.GetUint("userID"), input)
+	if err != nil {
+		sendWebAuthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, options)
+}
+
+// BeginReauthentication godoc
+// @Summary Start a security key re-authentication
+// @Description Return assertion options whose answer can be sent as the webauthn second factor of a sensitive account change
+// @Tags webauthn
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} gin.H
+// @Router /user/webauthn/reauth/begin [post]
+func (wc *WebAuthnController) BeginReauthentication(c *gin.Context) {
+	options, err := wc.WebAuthnService.BeginReauthentication(c.GetUint("userID"))
+	if err != nil {
+		sendWebAuthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, options)
+}
+
+// FinishRegistration godoc
+// @Summary Finish passkey registration
+// @Description Verify the credential returned by navigator.credentials.create() and store it. Recovery codes are returned when this enables MFA.
+// @Tags webauthn
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param name query string false "Credential name"
+// @Param credential body object true "PublicKeyCredential"
+// @Success 200 {object} models.WebAuthnRegistrationResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} gin.H
+// @Router /user/webauthn/register/finish [post]
+func (wc *WebAuthnController) FinishRegistration(c *gin.Context) {
+	response, err := wc.WebAuthnService.FinishRegistration(c.GetUint("userID"), c.Query("name"), c.Request.Body, requestInfo(c))
+	if err != nil {
+		sendWebAuthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ListCredentials godoc
+// @Summary List passkeys
+// @Tags webauthn
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Success 200 {array} models.WebAuthnCredentialResponse
+// @Failure 401 {object} gin.H
+// @Router /user/webauthn/credentials [get]
+func (wc *WebAuthnController) ListCredentials(c *gin.Context) {
+	credentials, err := wc.WebAuthnService.ListCredentials(c.GetUint("userID"))
+	if err != nil {
+		sendWebAuthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, credentials)
+}
+
+// DeleteCredential godoc
+// @Summary Delete a passkey
+// @Description Re-authenticate and delete a passkey. A second factor is required when MFA is on.
+// @Tags webauthn
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Authorization"
+// @Param id path int true "Credential ID"
+// @Param input body models.ReauthenticationInput true "Password or account email, and a second factor when MFA is on"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Router /user/webauthn/credentials/{id} [delete]
+func (wc *WebAuthnController) DeleteCredential(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid credential ID")
+		return
+	}
+	var input models.ReauthenticationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	if err := wc.WebAuthnService.DeleteCredential(c.GetUint("userID"), uint(id), input, requestInfo(c)); err != nil {
+		sendWebAuthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Credential deleted successfully"})
+}
+
+// BeginMFALogin godoc
+// @Summary Start a security key MFA login
+// @Description Return assertion options for a login that answered with an MFA challenge
+// @Tags webauthn
+// @Accept  json
+// @Produce  json
+// @Param input body models.WebAuthnMFAInput true "MFA Token"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Router /login/mfa/webauthn/begin [post]
+func (wc *WebAuthnController) BeginMFALogin(c *gin.Context) {
+	var input models.WebAuthnMFAInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	options, err := wc.WebAuthnService.BeginMFALogin(input.MFAToken)
+	if err != nil {
+		sendWebAuthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, options)
+}
+
+// FinishMFALogin godoc
+// @Summary Finish a security key MFA login
+// @Description Verify the assertion returned by navigator.credentials.get() and issue tokens
+// @Tags webauthn
+// @Accept  json
+// @Produce  json
+// @Param credential body object true "PublicKeyCredential"
+// @Success 200 {object} utils.TokenResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Router /login/mfa/webauthn/finish [post]
+func (wc *WebAuthnController) FinishMFALogin(c *gin.Context) {
+	user, err := wc.WebAuthnService.FinishMFALogin(c.Request.Body, requestInfo(c))
+	if err != nil {
+		sendWebAuthnError(c, err)
+		return
+	}
+	wc.sendTokens(c, user, models.LoginMethodSecurityKey)
+}
+
+// BeginPasskeyLogin godoc
+// @Summary Start a passkey login
+// @Description Return assertion options for a passwordless login with a discoverable credential
+// @Tags webauthn
+// @Produce  json
+// @Success 200 {object} gin.H
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /login/passkey/begin [post]
+func (wc *WebAuthnController) BeginPasskeyLogin(c *gin.Context) {
+	options, err := wc.WebAuthnService.BeginPasskeyLogin()
+	if err != nil {
+		sendWebAuthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, options)
+}
+
+// FinishPasskeyLogin godoc
+// @Summary Finish a passkey login
+// @Description Verify the assertion returned by navigator.credentials.get() and issue tokens
+// @Tags webauthn
+// @Accept  json
+// @Produce  json
+// @Param credential body object true "PublicKeyCredential"
+// @Success 200 {object} utils.TokenResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Router /login/passkey/finish [post]
+func (wc *WebAuthnController) FinishPasskeyLogin(c *gin.Context) {
+	user, err := wc.WebAuthnService.FinishPasskeyLogin(c.Request.Body, requestInfo(c))
+	if err != nil {
+		sendWebAuthnError(c, err)
+		return
+	}
+	wc.sendTokens(c, user, models.LoginMethodPasskey)
+}
+
+func (wc *WebAuthnController) sendTokens(c *gin.Context, user *models.User, method string) {
+	accessToken, refreshToken, err := wc.TokenService.IssueTokens(user, method, requestInfo(c))
+	if err != nil {
+		sendIssueTokensError(c, err)
+		return
+	}
+	utils.SendTokenResponse(c, accessToken, refreshToken)
+}
+
+func sendWebAuthnError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrWebAuthnVerification):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "WebAuthn verification failed")
+	case errors.Is(err, services.ErrWebAuthnNoCredentials):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "No security keys registered")
+	case errors.Is(err, services.ErrWebAuthnCredentialNotFound):
+		utils.SendErrorResponse(c, http.StatusNotFound, "Credential not found")
+	case errors.Is(err, services.ErrInvalidMFAToken):
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "Invalid or expired MFA token")
+	case errors.Is(err, utils.ErrInvalidCredentials):
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "Incorrect password or email")
+	case errors.Is(err, services.ErrInvalidMFACode):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid verification code")
+	case errors.Is(err, services.ErrMFALocked):
+		utils.SendErrorResponse(c, http.StatusTooManyRequests, "Too many invalid codes, try again later")
+	default:
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not process WebAuthn request")
+	}
+}
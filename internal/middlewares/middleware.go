@@ -4,12 +4,65 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strconv"
+	"strings"
+	"user-service/internal/models"
+	"user-service/internal/services"
 	"user-service/utils"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// maxRequestIDLength bounds the request IDs accepted from clients.
+const maxRequestIDLength = 64
+
+// RequestID tags the request with an ID, set as "requestID" and echoed in
+// the X-Request-ID response header. A well-formed ID sent by the client or a
+// proxy is kept so requests can be traced across services.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader("X-Request-ID")
+		if !validRequestID(requestID) {
+			var err error
+			if requestID, err = utils.GenerateRandomString(16); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate request ID"})
+				c.Abort()
+				return
+			}
+		}
+		c.Set("requestID", requestID)
+		c.Header("X-Request-ID", requestID)
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// AuthMiddleware authenticates first-party access tokens. Tokens issued to
+// OAuth clients are refused, since they do not carry the user's roles and
+// must not act as the user on this API.
+func AuthMiddleware(sessionService *services.SessionService) gin.HandlerFunc {
+	return authenticate(sessionService, false)
+}
+
+// ClientAuthMiddleware also accepts access tokens issued to OAuth clients,
+// setting "clientID" and "scope" for them. It is only for endpoints that
+// serve OAuth clients, such as userinfo.
+func ClientAuthMiddleware(sessionService *services.SessionService) gin.HandlerFunc {
+	return authenticate(sessionService, true)
+}
+
+func authenticate(sessionService *services.SessionService, allowClients bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenString := c.GetHeader("Authorization")
+		tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
 
 		if tokenString == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
@@ -31,22 +84,163 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if tokenType, _ := claims["token_type"].(string); tokenType != utils.AccessTokenType {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token type"})
+			c.Abort()
+			return
+		}
+
+		clientID, _ := claims["client_id"].(string)
+		if clientID != "" && !allowClients {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token was issued to an OAuth client"})
+			c.Abort()
+			return
+		}
+
 		userID := claims["user_id"].(float64)
+		sessionID, _ := claims["sid"].(string)
+		if err := sessionService.ValidateSession(sessionID, uint(userID)); err != nil {
+			if message, ok := utils.AccountStatusMessage(err); ok {
+				c.JSON(http.StatusForbidden, gin.H{"error": message})
+				c.Abort()
+				return
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session is no longer valid"})
+			c.Abort()
+			return
+		}
+
+		orgID, _ := claims["org_id"].(float64)
+		permissions := stringList(claims["permissions"])
 		c.Set("userID", uint(userID))
-		c.Set("userRole", claims["role"].(string))
+		c.Set("orgID", uint(orgID))
+		c.Set("userRoles", stringList(claims["roles"]))
+		c.Set("userPermissions", permissions)
+		c.Set("orgScope", services.OrgScope{
+			OrganizationID: uint(orgID),
+			All:            contains(permissions, models.PermOrganizationsManage),
+		})
+		c.Set("sessionID", sessionID)
+		if clientID != "" {
+			scope, _ := claims["scope"].(string)
+			c.Set("clientID", clientID)
+			c.Set("scope", scope)
+		}
 
 		c.Next()
 	}
 }
 
-func AdminMiddleware() gin.HandlerFunc {
+// RequirePermission allows the request when the access token grants every
+// given permission. It must run after AuthMiddleware.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, exists := c.Get("userRole")
-		if !exists || role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		granted := map[string]bool{}
+		if values, ok := c.Get("userPermissions"); ok {
+			for _, permission := range values.([]string) {
+				granted[permission] = true
+			}
+		}
+		for _, permission := range permissions {
+			if !granted[permission] {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Missing permission: " + permission})
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequireActiveOrg allows the request when the organization in the given
+// path parameter is the caller's active organization, or when the caller
+// manages all organizations. It must run after AuthMiddleware.
+func RequireActiveOrg(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := c.MustGet("orgScope").(services.OrgScope)
+		orgID, err := strconv.ParseUint(c.Param(param), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+			c.Abort()
+			return
+		}
+		if !scope.All && uint(orgID) != scope.OrganizationID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Organization is not active for this session"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireUserInScope allows the request when the user in the given path
+// parameter belongs to the caller's active organization, or when the caller
+// manages all organizations. Users outside the scope are reported as not
+// found. It must run after AuthMiddleware.
+func RequireUserInScope(organizationService *services.OrganizationService, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := c.MustGet("orgScope").(services.OrgScope)
+		userID, err := strconv.ParseUint(c.Param(param), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			c.Abort()
+			return
+		}
+		inScope, err := organizationService.UserInScope(scope, uint(userID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not check user"})
+			c.Abort()
+			return
+		}
+		if !inScope {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// SCIMAuth authenticates an identity provider with an organization's SCIM
+// bearer token and sets the organization as "scimOrgID". Failures are
+// answered in the SCIM error format.
+func SCIMAuth(scimService *services.SCIMService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		orgID, err := scimService.Authenticate(tokenString)
+		if tokenString == "" || err != nil {
+			c.Header("Content-Type", models.SCIMContentType)
+			c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			c.JSON(http.StatusUnauthorized, models.SCIMErrorResponse{
+				Schemas: []string{models.SCIMErrorSchema},
+				Status:  strconv.Itoa(http.StatusUnauthorized),
+				Detail:  "Invalid SCIM token",
+			})
 			c.Abort()
 			return
 		}
+		c.Set("scimOrgID", orgID)
 		c.Next()
 	}
 }
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// stringList reads a JSON array claim.
+func stringList(value interface{}) []string {
+	items, _ := value.([]interface{})
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
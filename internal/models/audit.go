@@ -0,0 +1,186 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Audited actions.
+const (
+	AuditLogin              = "auth.login"
+	AuditLoginFailed        = "auth.login_failed"
+	AuditRegister           = "user.register"
+	AuditSocialSignUp       = "user.social_sign_up"
+	AuditSuperUserCreated   = "user.superuser_created"
+	AuditPasswordChanged    = "user.password_changed"
+	AuditPasswordReset      = "user.password_reset"
+	AuditEmailChanged       = "user.email_changed"
+	AuditEmailChangeUndone  = "user.email_change_undone"
+	AuditMFAEnabled         = "user.mfa_enabled"
+	AuditMFADisabled        = "user.mfa_disabled"
+	AuditTOTPAdded          = "user.totp_added"
+	AuditPasskeyAdded       = "user.passkey_added"
+	AuditPasskeyRemoved     = "user.passkey_removed"
+	AuditProviderLinked     = "user.provider_linked"
+	AuditProviderUnlinked   = "user.provider_unlinked"
+	AuditAccountDeleted     = "user.deleted"
+	AuditUserUpdated        = "admin.user_updated"
+	AuditUserDeleted        = "admin.user_deleted"
+	AuditUserRestored       = "admin.user_restored"
+	AuditUserErased         = "admin.user_erased"
+	AuditUserStatusChanged  = "admin.user_status_changed"
+	AuditMFAReset           = "admin.mfa_reset"
+	AuditRoleAssigned       = "admin.role_assigned"
+	AuditRoleRemoved        = "admin.role_removed"
+	AuditRoleCreated        = "admin.role_created"
+	AuditRoleUpdated        = "admin.role_updated"
+	AuditRoleDeleted        = "admin.role_deleted"
+	AuditMemberRemoved      = "org.member_removed"
+	AuditInvitationCreated  = "org.invitation_created"
+	AuditInvitationAccepted = "org.invitation_accepted"
+	AuditSCIMTokenCreated   = "org.scim_token_created"
+	AuditSCIMTokenDeleted   = "org.scim_token_deleted"
+	AuditOAuthClientCreated = "org.oauth_client_created"
+	AuditOAuthClientDeleted = "org.oauth_client_deleted"
+	AuditSCIMUserCreated    = "scim.user_created"
+	AuditSCIMUserUpdated    = "scim.user_updated"
+	AuditSCIMUserRemoved    = "scim.user_removed"
+	AuditSCIMGroupCreated   = "scim.group_created"
+	AuditSCIMGroupUpdated   = "scim.group_updated"
+	AuditSCIMGroupDeleted   = "scim.group_deleted"
+)
+
+// Audit target types.
+const (
+	AuditTargetUser        = "user"
+	AuditTargetRole        = "role"
+	AuditTargetInvitation  = "invitation"
+	AuditTargetSCIMToken   = "scim_token"
+	AuditTargetOAuthClient = "oauth_client"
+)
+
+// AuditEvent is an append-only record of a security-relevant action.
+// ActorID is the user who acted, if any; OrganizationID is the organization
+// the actor was working in. Changes holds the before/after values of the
+// fields the action changed.
+//
+// Events form a hash chain: Hash covers PrevHash, the event's own fields and
+// PIIDigest, a digest of IP, UserAgent and Changes. Editing or removing an
+// event breaks the chain. Erasing a user clears the personal fields of the
+// events about them and sets RedactedAt; the chain still verifies because
+// it only depends on the digest of those fields.
+type AuditEvent struct {
+	ID             uint            `gorm:"primaryKey"`
+	CreatedAt      time.Time       `gorm:"not null;index"`
+	ActorID        *uint           `gorm:"default:null;index"`
+	OrganizationID *uint           `gorm:"default:null;index"`
+	Action         string          `gorm:"not null;size:64;index"`
+	TargetType     string          `gorm:"size:32;index:idx_audit_target"`
+	TargetID       *uint           `gorm:"default:null;index:idx_audit_target"`
+	IP             string          `gorm:"size:64"`
+	UserAgent      string          `gorm:"size:512"`
+	RequestID      string          `gorm:"size:64;index"`
+	Changes        json.RawMessage `gorm:"type:text"`
+	PIIDigest      string          `gorm:"not null;size:64"`
+	PrevHash       string          `gorm:"not null;size:64"`
+	Hash           string          `gorm:"not null;size:64;uniqueIndex"`
+	RedactedAt     *time.Time      `gorm:"default:null"`
+}
+
+// PendingAuditEvent is an event waiting to be chained into the log. Events
+// recorded too often to each take the chain head lock, such as logins, are
+// stored here and chained in batches; they keep the time they were
+// recorded, so their IDs in the log may be slightly out of time order.
+type PendingAuditEvent struct {
+	ID             uint            `gorm:"primaryKey"`
+	CreatedAt      time.Time       `gorm:"not null"`
+	ActorID        *uint           `gorm:"default:null;index"`
+	OrganizationID *uint           `gorm:"default:null"`
+	Action         string          `gorm:"not null;size:64"`
+	TargetType     string          `gorm:"size:32;index:idx_pending_audit_target"`
+	TargetID       *uint           `gorm:"default:null;index:idx_pending_audit_target"`
+	IP             string          `gorm:"size:64"`
+	UserAgent      string          `gorm:"size:512"`
+	RequestID      string          `gorm:"size:64"`
+	Changes        json.RawMessage `gorm:"type:text"`
+}
+
+// AuditChainHead holds the hash of the newest audit event. Appending an
+// event locks this single row so events are chained one at a time.
+type AuditChainHead struct {
+	ID   uint   `gorm:"primaryKey"`
+	Hash string `gorm:"not null;size:64"`
+}
+
+// AuditChange is the value of a field before and after an action.
+type AuditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type AuditEventResponse struct {
+	ID             uint            `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	ActorID        *uint           `json:"actor_id,omitempty"`
+	OrganizationID *uint           `json:"organization_id,omitempty"`
+	Action         string          `json:"action"`
+	TargetType     string          `json:"target_type,omitempty"`
+	TargetID       *uint           `json:"target_id,omitempty"`
+	IP             string          `json:"ip,omitempty"`
+	UserAgent      string          `json:"user_agent,omitempty"`
+	RequestID      string          `json:"request_id,omitempty"`
+	Changes        json.RawMessage `json:"changes,omitempty" swaggertype:"object"`
+	Hash           string          `json:"hash"`
+	Redacted       bool            `json:"redacted"`
+}
+
+// ListAuditEventsQuery holds the query parameters of GET
+// /admin/audit-events. Times are RFC 3339; Cursor is the next_cursor of the
+// previous page.
+type ListAuditEventsQuery struct {
+	ActorID    uint       `form:"actor_id"`
+	Action     string     `form:"action" binding:"max=64"`
+	TargetType string     `form:"target_type" binding:"max=32"`
+	TargetID   uint       `form:"target_id"`
+	RequestID  string     `form:"request_id" binding:"max=64"`
+	From       *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To         *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Cursor     string     `form:"cursor"`
+	Limit      int        `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// AuditEventListResponse is a page of audit events, newest first.
+// NextCursor is empty on the last page.
+type AuditEventListResponse struct {
+	Events     []AuditEventResponse `json:"events"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+// AuditVerifyResponse is the result of checking the hash chain. When the
+// chain is broken, BrokenAt is the first event that does not verify.
+type AuditVerifyResponse struct {
+	Valid    bool  `json:"valid"`
+	Checked  int   `json:"checked"`
+	BrokenAt *uint `json:"broken_at,omitempty"`
+}
+
+// ComputePIIDigest returns the digest of the event's personal fields.
+func (e *AuditEvent) ComputePIIDigest() string {
+	return auditDigest(e.IP, e.UserAgent, string(e.Changes))
+}
+
+// ComputeHash returns the chain hash of the event from PrevHash, its fields
+// and PIIDigest. CreatedAt counts to the millisecond, the precision it is
+// stored with.
+func (e *AuditEvent) ComputeHash() string {
+	return auditDigest(e.PrevHash, e.CreatedAt.UnixMilli(), e.ActorID, e.OrganizationID, e.Action,
+		e.TargetType, e.TargetID, e.RequestID, e.PIIDigest)
+}
+
+func auditDigest(values ...interface{}) string {
+	data, _ := json.Marshal(values)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Data export statuses.
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// Data export formats. A JSON export is a single document; a ZIP export
+// holds one JSON file per section.
+const (
+	DataExportFormatJSON = "json"
+	DataExportFormatZIP  = "zip"
+)
+
+// DataExport is an archive of everything stored about a user, built in the
+// background after the user asks for it. ClaimedUntil leases a pending
+// export to one worker. The archive is deleted once ExpiresAt passes.
+type DataExport struct {
+	ID           uint `gorm:"primaryKey"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	UserID       uint       `gorm:"not null;index"`
+	Format       string     `gorm:"not null;size:8"`
+	Status       string     `gorm:"not null;size:16;index"`
+	ClaimedUntil *time.Time `gorm:"default:null"`
+	Data         []byte
+	CompletedAt  *time.Time `gorm:"default:null"`
+	ExpiresAt    *time.Time `gorm:"default:null;index"`
+}
+
+type DataExportInput struct {
+	Format string `json:"format" binding:"omitempty,oneof=json zip"`
+}
+
+// DataExportResponse describes an export. DownloadURL is a signed link that
+// works without authentication until ExpiresAt; it is only set once the
+// export is ready.
+type DataExportResponse struct {
+	ID          uint       `json:"id"`
+	Format      string     `json:"format"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+// DataExportArchive is the content of an export.
+type DataExportArchive struct {
+	ExportedAt          time.Time                    `json:"exported_at"`
+	Profile             UserResponse                 `json:"profile"`
+	AuthProviders       []ExportedAuthProvider       `json:"auth_providers"`
+	Sessions            []ExportedSession            `json:"sessions"`
+	Organizations       []ExportedMembership         `json:"organizations"`
+	WebAuthnCredentials []WebAuthnCredentialResponse `json:"webauthn_credentials"`
+	Invitations         []ExportedInvitation         `json:"invitations"`
+	LoginHistory        []LoginAttemptResponse       `json:"login_history"`
+	AuditEvents         []ExportedAuditEvent         `json:"audit_events"`
+}
+
+type ExportedAuthProvider struct {
+	Provider   string    `json:"provider"`
+	ProviderID string    `json:"provider_id"`
+	Email      string    `json:"email"`
+	LinkedAt   time.Time `json:"linked_at"`
+}
+
+type ExportedSession struct {
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type ExportedMembership struct {
+	OrganizationID   uint      `json:"organization_id"`
+	OrganizationName string    `json:"organization_name"`
+	Roles            []string  `json:"roles"`
+	ExternalID       string    `json:"external_id,omitempty"`
+	Provisioned      bool      `json:"provisioned"`
+	JoinedAt         time.Time `json:"joined_at"`
+}
+
+// ExportedAuditEvent is an audit event the user took part in. The IP and
+// user agent are only included when the user acted, and Changes only when
+// the event was about the user; the rest belongs to other people.
+type ExportedAuditEvent struct {
+	CreatedAt   time.Time       `json:"created_at"`
+	Action      string          `json:"action"`
+	ActedBySelf bool            `json:"acted_by_self"`
+	AboutSelf   bool            `json:"about_self"`
+	IP          string          `json:"ip,omitempty"`
+	UserAgent   string          `json:"user_agent,omitempty"`
+	Changes     json.RawMessage `json:"changes,omitempty"`
+}
+
+type ExportedInvitation struct {
+	OrganizationID uint       `json:"organization_id"`
+	Email          string     `json:"email"`
+	CreatedAt      time.Time  `json:"created_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// EmailChangeRequest is a pending change of a user's login email. The new
+// address receives the confirm token; the old address receives the cancel
+// token, which can also roll back a change that was already confirmed.
+type EmailChangeRequest struct {
+	gorm.Model
+	UserID           uint       `gorm:"not null;index"`
+	OldEmail         string     `gorm:"not null;size:255"`
+	NewEmail         string     `gorm:"not null;size:255"`
+	ConfirmTokenHash string     `gorm:"not null;size:64;uniqueIndex"`
+	CancelTokenHash  string     `gorm:"not null;size:64;uniqueIndex"`
+	ExpiresAt        time.Time  `gorm:"not null"`
+	ConfirmedAt      *time.Time `gorm:"default:null"`
+	CancelledAt      *time.Time `gorm:"default:null"`
+}
+
+// ChangeEmailInput requests an email change, confirmed with the current
+// password, or with the current email when the account has no password.
+type ChangeEmailInput struct {
+	Password string `json:"password"`
+	Email    string `json:"email"`
+	NewEmail string `json:"new_email" binding:"required,email,max=255"`
+}
+
+type EmailChangeTokenInput struct {
+	Token string `form:"token" json:"token" binding:"required"`
+}
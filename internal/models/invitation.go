@@ -0,0 +1,88 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Invitation statuses reported in InvitationResponse.
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// Invitation asks the owner of Email to join an organization with a role.
+// The emailed token is single use: accepting or revoking the invitation,
+// or sending it again, invalidates it.
+type Invitation struct {
+	gorm.Model
+	OrganizationID uint         `gorm:"not null;index"`
+	Email          string       `gorm:"not null;size:255;index"`
+	RoleID         uint         `gorm:"not null"`
+	InvitedByID    uint         `gorm:"not null"`
+	TokenHash      string       `gorm:"not null;size:64;uniqueIndex"`
+	ExpiresAt      time.Time    `gorm:"not null"`
+	AcceptedAt     *time.Time   `gorm:"default:null"`
+	AcceptedByID   *uint        `gorm:"default:null"`
+	RevokedAt      *time.Time   `gorm:"default:null"`
+	Organization   Organization `gorm:"foreignKey:OrganizationID"`
+	Role           Role         `gorm:"foreignKey:RoleID"`
+}
+
+// Status tells whether the invitation can still be accepted.
+func (i *Invitation) Status() string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case time.Now().After(i.ExpiresAt):
+		return InvitationExpired
+	default:
+		return InvitationPending
+	}
+}
+
+// CreateInvitationInput invites an email address. Role names a role of the
+// organization and defaults to member.
+type CreateInvitationInput struct {
+	Email string `json:"email" binding:"required,email,max=255"`
+	Role  string `json:"role" binding:"max=64"`
+}
+
+type InvitationResponse struct {
+	ID             uint      `json:"id"`
+	OrganizationID uint      `json:"organization_id"`
+	Email          string    `json:"email"`
+	Role           string    `json:"role"`
+	InvitedByID    uint      `json:"invited_by_id"`
+	Status         string    `json:"status"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// InvitationPreviewResponse describes an invitation to the person opening
+// the link. AccountExists tells the page whether to ask them to sign in and
+// accept, or to register.
+type InvitationPreviewResponse struct {
+	Organization  string    `json:"organization"`
+	Email         string    `json:"email"`
+	Role          string    `json:"role"`
+	AccountExists bool      `json:"account_exists"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+type InvitationTokenInput struct {
+	Token string `form:"token" json:"token" binding:"required"`
+}
+
+// AcceptInvitationRegisterInput registers an account for the invited email
+// and accepts the invitation with it.
+type AcceptInvitationRegisterInput struct {
+	Token           string `json:"token" binding:"required"`
+	Name            string `json:"name" binding:"required"`
+	Password        string `json:"password" binding:"required,min=8"`
+	ConfirmPassword string `json:"confirm_password" binding:"required"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// Login methods. Logins through an external provider use the provider name
+// as their method.
+const (
+	LoginMethodPassword     = "password"
+	LoginMethodTOTP         = "totp"
+	LoginMethodRecoveryCode = "recovery_code"
+	LoginMethodSecurityKey  = "security_key"
+	LoginMethodPasskey      = "passkey"
+)
+
+// LoginAttempt records one attempt to sign in, successful or not. UserID is
+// nil when the attempt named an email no account uses. A login with MFA is
+// recorded by the method of its final step.
+type LoginAttempt struct {
+	ID            uint      `gorm:"primaryKey"`
+	CreatedAt     time.Time `gorm:"index"`
+	UserID        *uint     `gorm:"default:null;index"`
+	Email         string    `gorm:"size:191;index"`
+	Method        string    `gorm:"not null;size:32"`
+	Success       bool      `gorm:"not null"`
+	FailureReason string    `gorm:"size:32"`
+	IP            string    `gorm:"size:64"`
+	UserAgent     string    `gorm:"size:512"`
+}
+
+type LoginAttemptResponse struct {
+	ID            uint      `json:"id"`
+	Method        string    `json:"method"`
+	Success       bool      `json:"success"`
+	FailureReason string    `json:"failure_reason,omitempty"`
+	IP            string    `json:"ip"`
+	UserAgent     string    `json:"user_agent"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// LoginHistoryQuery holds the query parameters of the login history
+// endpoints. Cursor is the next_cursor of the previous page.
+type LoginHistoryQuery struct {
+	Success *bool  `form:"success"`
+	Cursor  string `form:"cursor"`
+	Limit   int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// LoginHistoryResponse is a page of login attempts, newest first.
+// NextCursor is empty on the last page.
+type LoginHistoryResponse struct {
+	Attempts   []LoginAttemptResponse `json:"attempts"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
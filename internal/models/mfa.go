@@ -0,0 +1,64 @@
+package models
+
+import (
+	"encoding/json"
+	"gorm.io/gorm"
+	"time"
+)
+
+// MFARecoveryCode is a hashed one-time code that can replace a TOTP code
+// when the user has lost their authenticator.
+type MFARecoveryCode struct {
+	gorm.Model
+	UserID   uint       `gorm:"not null;index"`
+	CodeHash string     `gorm:"not null;size:64"`
+	UsedAt   *time.Time `gorm:"default:null"`
+}
+
+// TOTPConfirmInput confirms a TOTP enrollment with a code from the new
+// authenticator. Adding TOTP while MFA is already on also takes a
+// re-authentication with an existing second factor.
+type TOTPConfirmInput struct {
+	Code             string                `json:"code" binding:"required"`
+	Reauthentication ReauthenticationInput `json:"reauthentication"`
+}
+
+// SecondFactorInput proves a second factor of a signed-in user: a TOTP
+// code, an unused recovery code, or a WebAuthn assertion answering a
+// challenge from POST /user/webauthn/reauth/begin.
+type SecondFactorInput struct {
+	Code         string          `json:"code"`
+	RecoveryCode string          `json:"recovery_code"`
+	WebAuthn     json.RawMessage `json:"webauthn,omitempty" swaggertype:"object"`
+}
+
+// ReauthenticationInput confirms a sensitive change to one's own account
+// with the current password, or the account email when the account has no
+// password, plus a second factor when MFA is on.
+type ReauthenticationInput struct {
+	Password string `json:"password"`
+	Email    string `json:"email"`
+	SecondFactorInput
+}
+
+// MFALoginInput completes a login that returned an MFA challenge. Either a
+// TOTP code or a recovery code must be given.
+type MFALoginInput struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type TOTPSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
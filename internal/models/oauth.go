@@ -0,0 +1,88 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// OAuthClient is an application allowed to sign users in through the
+// service's OpenID Connect provider. Public clients have no secret and must
+// use PKCE. Clients registered by an organization are managed by it; global
+// clients have no OrganizationID.
+type OAuthClient struct {
+	gorm.Model
+	OrganizationID   *uint  `gorm:"index"`
+	ClientID         string `gorm:"not null;size:64;uniqueIndex"`
+	ClientSecretHash string `gorm:"size:64"`
+	Name             string `gorm:"not null"`
+	RedirectURIs     string `gorm:"type:text;not null"` // space separated
+	Public           bool   `gorm:"not null;default:false"`
+}
+
+// AuthorizationCode is a single-use code handed to a client after the user
+// approved an authorization request. SessionID is filled in once the code has
+// been exchanged so a replayed code can revoke what it issued.
+type AuthorizationCode struct {
+	gorm.Model
+	CodeHash            string     `gorm:"not null;size:64;uniqueIndex"`
+	ClientID            string     `gorm:"not null;size:64"`
+	UserID              uint       `gorm:"not null"`
+	RedirectURI         string     `gorm:"type:text;not null"`
+	Scope               string     `gorm:"not null"`
+	Nonce               string     `gorm:"type:text"`
+	CodeChallenge       string     `gorm:"size:128"`
+	CodeChallengeMethod string     `gorm:"size:16"`
+	AuthTime            time.Time  `gorm:"not null"`
+	ExpiresAt           time.Time  `gorm:"not null"`
+	UsedAt              *time.Time `gorm:"default:null"`
+	SessionID           string     `gorm:"size:64"`
+}
+
+type AuthorizeInput struct {
+	ResponseType        string `form:"response_type" json:"response_type" binding:"required"`
+	ClientID            string `form:"client_id" json:"client_id" binding:"required"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri" binding:"required"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	Nonce               string `form:"nonce" json:"nonce"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+type OAuthTokenInput struct {
+	GrantType    string `form:"grant_type" binding:"required"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// CreateOAuthClientInput registers a client for the caller's active
+// organization, or a global client when Global is set. Callers managing all
+// organizations register global clients while no organization is active.
+type CreateOAuthClientInput struct {
+	Name         string   `json:"name" binding:"required"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1,dive,url"`
+	Public       bool     `json:"public"`
+	Global       bool     `json:"global"`
+}
+
+type OAuthClientResponse struct {
+	OrganizationID *uint    `json:"organization_id"`
+	ClientID       string   `json:"client_id"`
+	ClientSecret   string   `json:"client_secret,omitempty"`
+	Name           string   `json:"name"`
+	RedirectURIs   []string `json:"redirect_uris"`
+	Public         bool     `json:"public"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Built-in roles created in every organization. The owner holds every
+// organization permission; members can see who else belongs to it.
+const (
+	OrgOwnerRole  = "owner"
+	OrgMemberRole = "member"
+)
+
+// Organization is a customer company. Users belong to organizations through
+// memberships, and roles defined in an organization only apply inside it.
+type Organization struct {
+	gorm.Model
+	Name string `gorm:"not null;size:100"`
+	Slug string `gorm:"not null;size:64;uniqueIndex"`
+}
+
+// Membership makes a user part of an organization with the given org roles.
+// Members provisioned through SCIM carry the identity provider's ExternalID;
+// Provisioned is set when SCIM created the account itself, which is what
+// allows the organization to change its name, email and password. A
+// deactivated membership keeps its roles but grants nothing.
+type Membership struct {
+	ID             uint `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	OrganizationID uint         `gorm:"not null;uniqueIndex:idx_membership"`
+	UserID         uint         `gorm:"not null;uniqueIndex:idx_membership;index"`
+	ExternalID     string       `gorm:"size:255"`
+	Provisioned    bool         `gorm:"not null;default:false"`
+	DeactivatedAt  *time.Time   `gorm:"default:null"`
+	Roles          []Role       `gorm:"many2many:membership_roles"`
+	Organization   Organization `gorm:"foreignKey:OrganizationID"`
+	User           User         `gorm:"foreignKey:UserID"`
+}
+
+type OrganizationResponse struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	Roles     []string  `json:"roles,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MemberResponse struct {
+	UserID   uint      `json:"user_id"`
+	Email    string    `json:"email"`
+	Name     string    `json:"name"`
+	Roles    []string  `json:"roles"`
+	Active   bool      `json:"active"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type CreateOrganizationInput struct {
+	Name string `json:"name" binding:"required,min=1,max=100"`
+	Slug string `json:"slug" binding:"omitempty,min=2,max=64"`
+}
+
+type UpdateOrganizationInput struct {
+	Name string `json:"name" binding:"required,min=1,max=100"`
+}
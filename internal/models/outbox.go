@@ -0,0 +1,29 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSent    = "sent"
+	OutboxStatusFailed  = "failed"
+)
+
+// OutboxEmail is a rendered email waiting to be delivered. Requests only
+// write rows here; a background worker sends them and retries failures.
+// The bodies carry single-use links, so they are cleared once the email is
+// sent or given up on, and finished rows are deleted after a while.
+type OutboxEmail struct {
+	gorm.Model
+	Recipient     string     `gorm:"not null;size:255"`
+	Subject       string     `gorm:"not null;size:255"`
+	TextBody      string     `gorm:"type:text"`
+	HTMLBody      string     `gorm:"type:text"`
+	Status        string     `gorm:"not null;size:16;index:idx_outbox_due"`
+	Attempts      int        `gorm:"not null;default:0"`
+	NextAttemptAt time.Time  `gorm:"not null;index:idx_outbox_due"`
+	LastError     string     `gorm:"type:text"`
+	SentAt        *time.Time `gorm:"default:null"`
+}
@@ -0,0 +1,93 @@
+package models
+
+import "time"
+
+// Permissions checked by the API. They are seeded into the permissions table
+// on startup; roles can only be granted permissions from this list.
+// Permissions granted by an organization role only apply inside that
+// organization; PermOrganizationsManage lifts that limit and is never part
+// of an organization role.
+const (
+	PermUsersRead           = "users:read"
+	PermUsersWrite          = "users:write"
+	PermRolesRead           = "roles:read"
+	PermRolesWrite          = "roles:write"
+	PermOAuthClientsRead    = "oauth_clients:read"
+	PermOAuthClientsWrite   = "oauth_clients:write"
+	PermOrganizationWrite   = "organization:write"
+	PermMembersRead         = "members:read"
+	PermMembersWrite        = "members:write"
+	PermAuditRead           = "audit:read"
+	PermOrganizationsManage = "organizations:manage"
+)
+
+// PermissionCatalog describes every permission the API knows about.
+var PermissionCatalog = []Permission{
+	{Name: PermUsersRead, Description: "View user accounts"},
+	{Name: PermUsersWrite, Description: "Manage user accounts"},
+	{Name: PermRolesRead, Description: "View roles and role assignments"},
+	{Name: PermRolesWrite, Description: "Manage roles and assign them to users"},
+	{Name: PermOAuthClientsRead, Description: "View OAuth clients"},
+	{Name: PermOAuthClientsWrite, Description: "Manage OAuth clients"},
+	{Name: PermOrganizationWrite, Description: "Edit the organization"},
+	{Name: PermMembersRead, Description: "View the members of the organization"},
+	{Name: PermMembersWrite, Description: "Manage the members of the organization"},
+	{Name: PermAuditRead, Description: "View the audit log"},
+	{Name: PermOrganizationsManage, Description: "Access every organization and manage global roles"},
+}
+
+// Built-in roles. AdminRole always holds every permission; DefaultRole is
+// given to new users.
+const (
+	AdminRole   = "admin"
+	DefaultRole = "user"
+)
+
+// Permission is a named right such as "users:write".
+type Permission struct {
+	ID          uint   `json:"-" gorm:"primaryKey"`
+	Name        string `json:"name" gorm:"not null;size:64;uniqueIndex"`
+	Description string `json:"description" gorm:"size:255"`
+}
+
+// Role groups permissions. A user can hold several roles and has the union
+// of their permissions. Global roles (no OrganizationID) are assigned to
+// users directly; organization roles are assigned to memberships of their
+// organization. System roles cannot be renamed or deleted. Roles are
+// deleted for good so their name can be reused.
+type Role struct {
+	ID             uint `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	OrganizationID *uint        `gorm:"uniqueIndex:idx_role_org_name"`
+	Name           string       `gorm:"not null;size:64;uniqueIndex:idx_role_org_name"`
+	Description    string       `gorm:"size:255"`
+	System         bool         `gorm:"not null;default:false"`
+	Permissions    []Permission `gorm:"many2many:role_permissions"`
+}
+
+type RoleResponse struct {
+	ID             uint      `json:"id"`
+	OrganizationID *uint     `json:"organization_id"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	System         bool      `json:"system"`
+	Permissions    []string  `json:"permissions"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// CreateRoleInput creates a role in the caller's active organization, or a
+// global role when Global is set. Callers managing all organizations create
+// global roles while no organization is active.
+type CreateRoleInput struct {
+	Name        string   `json:"name" binding:"required,min=1,max=64,excludesall=/ "`
+	Description string   `json:"description" binding:"max=255"`
+	Permissions []string `json:"permissions"`
+	Global      bool     `json:"global"`
+}
+
+type UpdateRoleInput struct {
+	Description *string  `json:"description" binding:"omitnil,max=255"`
+	Permissions []string `json:"permissions"`
+}
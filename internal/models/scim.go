@@ -0,0 +1,123 @@
+package models
+
+import (
+	"encoding/json"
+	"gorm.io/gorm"
+	"time"
+)
+
+// SCIM 2.0 schema and message URNs (RFC 7643, RFC 7644).
+const (
+	SCIMUserSchema          = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMGroupSchema         = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIMListResponseSchema  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMPatchOpSchema       = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMErrorSchema         = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SCIMServiceConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SCIMResourceTypeSchema  = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	SCIMSchemaDefinitionURN = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+	SCIMContentType         = "application/scim+json"
+)
+
+// SCIMToken authenticates an organization's identity provider on the SCIM
+// endpoints. Only the hash of the token is stored.
+type SCIMToken struct {
+	gorm.Model
+	OrganizationID uint       `gorm:"not null;index"`
+	Name           string     `gorm:"not null;size:100"`
+	TokenHash      string     `gorm:"not null;size:64;uniqueIndex"`
+	LastUsedAt     *time.Time `gorm:"default:null"`
+}
+
+type CreateSCIMTokenInput struct {
+	Name string `json:"name" binding:"required,min=1,max=100"`
+}
+
+// SCIMTokenResponse describes a SCIM token. Token is only set when the token
+// is created.
+type SCIMTokenResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type SCIMMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location,omitempty"`
+}
+
+type SCIMName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// SCIMReference points from a group to a member or from a user to a group.
+type SCIMReference struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// SCIMUser is the SCIM representation of an organization member. Password
+// is write-only and never returned.
+type SCIMUser struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id,omitempty"`
+	ExternalID  string          `json:"externalId,omitempty"`
+	UserName    string          `json:"userName"`
+	Name        *SCIMName       `json:"name,omitempty"`
+	DisplayName string          `json:"displayName,omitempty"`
+	Emails      []SCIMEmail     `json:"emails,omitempty"`
+	Active      *bool           `json:"active,omitempty"`
+	Password    string          `json:"password,omitempty"`
+	Groups      []SCIMReference `json:"groups,omitempty"`
+	Meta        *SCIMMeta       `json:"meta,omitempty"`
+}
+
+// SCIMGroup is the SCIM representation of an organization role.
+type SCIMGroup struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id,omitempty"`
+	DisplayName string          `json:"displayName"`
+	Members     []SCIMReference `json:"members"`
+	Meta        *SCIMMeta       `json:"meta,omitempty"`
+}
+
+type SCIMListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int64       `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+type SCIMPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations"`
+}
+
+// SCIMPatchOperation is one PATCH operation. Value is kept raw because its
+// type depends on the path.
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type SCIMErrorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	SCIMType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
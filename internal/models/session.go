@@ -0,0 +1,37 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Session is a server-side record of a login. Its SessionID is carried in the
+// "sid" claim of every token issued for it and doubles as the refresh token
+// family, so revoking a session also invalidates its refresh tokens.
+// OrganizationID is the organization the session is working in; it is put
+// in the "org_id" claim of the session's access tokens. ClientID is set on
+// sessions started by an OAuth client, whose refresh tokens only that client
+// may redeem; their access tokens only grant Scope, the scopes the user
+// consented to.
+type Session struct {
+	gorm.Model
+	SessionID      string     `gorm:"not null;size:64;uniqueIndex"`
+	UserID         uint       `gorm:"not null;index"`
+	OrganizationID *uint      `gorm:"default:null"`
+	ClientID       string     `gorm:"size:64"`
+	Scope          string     `gorm:"size:255"`
+	UserAgent      string     `gorm:"size:512"`
+	IP             string     `gorm:"size:64"`
+	LastSeenAt     time.Time  `gorm:"not null"`
+	ExpiresAt      time.Time  `gorm:"not null"`
+	RevokedAt      *time.Time `gorm:"default:null"`
+}
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
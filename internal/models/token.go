@@ -0,0 +1,41 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// RefreshToken stores the hash of an issued refresh token. Tokens rotated from
+// the same login share a FamilyID so the whole chain can be revoked at once.
+type RefreshToken struct {
+	gorm.Model
+	UserID    uint       `gorm:"not null;index"`
+	FamilyID  string     `gorm:"not null;size:64;index"`
+	TokenHash string     `gorm:"not null;size:64;uniqueIndex"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time `gorm:"default:null"`
+	RevokedAt *time.Time `gorm:"default:null"`
+}
+
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// PasswordResetToken is a hashed single-use token emailed to a user who
+// forgot their password.
+type PasswordResetToken struct {
+	gorm.Model
+	UserID    uint       `gorm:"not null;index"`
+	TokenHash string     `gorm:"not null;size:64;uniqueIndex"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time `gorm:"default:null"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordInput struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+}
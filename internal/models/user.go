@@ -7,18 +7,105 @@ import (
 
 type User struct {
 	gorm.Model
-	Email     string    `json:"email" gorm:"unique"`
+	Email     string    `json:"email" gorm:"size:191;index"`
 	Password  string    `gorm:"not null"`
 	Name      string    `gorm:"not null"`
 	LastLogin time.Time `json:"last_login" gorm:"default:null"`
-	Role      string    `gorm:"not null"`
+	Roles     []Role    `gorm:"many2many:user_roles"`
+	// Profile fields editable by the user; Locale also selects the language
+	// of emails sent to them.
+	AvatarURL string `json:"avatar_url" gorm:"size:512"`
+	Locale    string `json:"locale" gorm:"size:35"`
+	Timezone  string `json:"timezone" gorm:"size:64"`
+	// PendingTOTPSecret is set when TOTP enrollment starts and becomes
+	// TOTPSecret once a code from it is confirmed, which also enables MFA.
+	MFAEnabled        bool   `json:"mfa_enabled" gorm:"not null;default:false"`
+	TOTPSecret        string `json:"-"`
+	PendingTOTPSecret string `json:"-"`
+	TOTPLastStep      int64  `json:"-" gorm:"not null;default:0"`
+	// MFAFailedAttempts counts wrong codes at the MFA login step since the
+	// last lockout or success; too many lock the step until MFALockedUntil.
+	MFAFailedAttempts int        `json:"-" gorm:"not null;default:0"`
+	MFALockedUntil    *time.Time `json:"-" gorm:"default:null"`
+	// VerificationSentAt throttles resending the verification email.
+	EmailVerifiedAt    *time.Time `json:"email_verified_at" gorm:"default:null"`
+	VerificationSentAt *time.Time `json:"-" gorm:"default:null"`
+	// Status is set by administrators; only active accounts can sign in.
+	// A status with StatusExpiresAt set lifts by itself at that time.
+	Status          string     `json:"status" gorm:"not null;size:16;default:active;index"`
+	StatusReason    string     `json:"status_reason" gorm:"size:500"`
+	StatusChangedBy *uint      `json:"-" gorm:"default:null"`
+	StatusChangedAt *time.Time `json:"-" gorm:"default:null"`
+	StatusExpiresAt *time.Time `json:"status_expires_at" gorm:"default:null"`
+	// ErasedAt is set once the account's personal data has been anonymized.
+	// Erased accounts are kept, so records that refer to them stay valid.
+	ErasedAt *time.Time `json:"-" gorm:"default:null"`
+	// ActiveEmail is generated from Email while the account is not deleted.
+	// Its unique index keeps addresses unique among live accounts only, so
+	// the address of a deleted account can be registered again.
+	ActiveEmail *string `json:"-" gorm:"->;size:191;type:varchar(191) GENERATED ALWAYS AS (CASE WHEN deleted_at IS NULL THEN email END) VIRTUAL;uniqueIndex"`
 }
 
+// Account statuses.
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusBanned    = "banned"
+	UserStatusPending   = "pending"
+)
+
+// CurrentStatus returns the account's status, treating a status whose
+// expiry has passed as active.
+func (u *User) CurrentStatus() string {
+	if u.Status == "" || (u.StatusExpiresAt != nil && !time.Now().Before(*u.StatusExpiresAt)) {
+		return UserStatusActive
+	}
+	return u.Status
+}
+
+// UserResponse is the public representation of a user. It deliberately has
+// no password or MFA secret fields.
+type UserResponse struct {
+	ID            uint       `json:"id"`
+	Email         string     `json:"email"`
+	Name          string     `json:"name"`
+	AvatarURL     string     `json:"avatar_url"`
+	Locale        string     `json:"locale"`
+	Timezone      string     `json:"timezone"`
+	Roles         []string   `json:"roles"`
+	MFAEnabled    bool       `json:"mfa_enabled"`
+	EmailVerified bool       `json:"email_verified"`
+	HasPassword   bool       `json:"has_password"`
+	Status        string     `json:"status"`
+	LastLogin     *time.Time `json:"last_login,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	// DeletedAt is set on deleted accounts, which are purged once the
+	// deletion grace period has passed.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// AuthProvider links a user to an external login. A provider account can
+// only be linked to one user, and a user has at most one link per provider.
 type AuthProvider struct {
 	gorm.Model
-	UserID     uint   `gorm:"not null"`
-	Provider   string `gorm:"not null"` // e.g., 'google', 'facebook'
-	ProviderID string `gorm:"not null"` // e.g., Google ID, Facebook ID
+	UserID     uint   `gorm:"not null;uniqueIndex:idx_auth_provider_user"`
+	Provider   string `gorm:"not null;size:32;uniqueIndex:idx_auth_provider_identity;uniqueIndex:idx_auth_provider_user"` // e.g., 'google', 'facebook'
+	ProviderID string `gorm:"not null;size:255;uniqueIndex:idx_auth_provider_identity"`                                   // e.g., Google ID, Facebook ID
+	Email      string `gorm:"size:255"`                                                                                   // provider account email, for display
+}
+
+type AuthProviderResponse struct {
+	Provider string    `json:"provider"`
+	Email    string    `json:"email"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+// IDTokenLoginInput is an ID token an app got from the provider's own SDK.
+// Nonce is the value the app passed to the SDK, if any.
+type IDTokenLoginInput struct {
+	IDToken string `json:"id_token" binding:"required"`
+	Nonce   string `json:"nonce"`
 }
 
 type RegisterInput struct {
@@ -37,3 +124,89 @@ type ChangePasswordInput struct {
 	OldPassword string `json:"old_password" binding:"required"`
 	NewPassword string `json:"new_password" binding:"required,min=8"`
 }
+
+// DeleteAccountInput confirms deleting one's own account with the current
+// password, or with the account email when the account has no password.
+type DeleteAccountInput struct {
+	Password string `json:"password"`
+	Email    string `json:"email"`
+}
+
+type VerifyEmailInput struct {
+	Token string `form:"token" json:"token" binding:"required"`
+}
+
+type ResendVerificationInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ReplaceProfileInput is the body of PUT /user/profile; omitted optional
+// fields are cleared.
+type ReplaceProfileInput struct {
+	Name      string `json:"name" binding:"required,min=1,max=100"`
+	AvatarURL string `json:"avatar_url" binding:"omitempty,url,max=512"`
+	Locale    string `json:"locale" binding:"omitempty,bcp47_language_tag,max=35"`
+	Timezone  string `json:"timezone" binding:"omitempty,timezone,max=64"`
+}
+
+// UpdateProfileInput is the body of PATCH /user/profile; only the fields
+// present in the request are changed.
+type UpdateProfileInput struct {
+	Name      *string `json:"name" binding:"omitnil,min=1,max=100"`
+	AvatarURL *string `json:"avatar_url" binding:"omitnil,len=0|url,max=512"`
+	Locale    *string `json:"locale" binding:"omitnil,len=0|bcp47_language_tag,max=35"`
+	Timezone  *string `json:"timezone" binding:"omitnil,len=0|timezone,max=64"`
+}
+
+// ListUsersQuery holds the query parameters of GET /admin/users. Times are
+// RFC 3339. Sort is created_at, email or name, prefixed with "-" for
+// descending order; Cursor is the next_cursor of the previous page.
+type ListUsersQuery struct {
+	Q               string     `form:"q" binding:"max=100"`
+	Role            string     `form:"role"`
+	Provider        string     `form:"provider"`
+	Verified        *bool      `form:"verified"`
+	Status          string     `form:"status" binding:"omitempty,oneof=active suspended banned pending deleted"`
+	CreatedAfter    *time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore   *time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	LastLoginAfter  *time.Time `form:"last_login_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	LastLoginBefore *time.Time `form:"last_login_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	Sort            string     `form:"sort" binding:"omitempty,oneof=created_at -created_at email -email name -name"`
+	Cursor          string     `form:"cursor"`
+	Limit           int        `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// UserListResponse is a page of users. NextCursor is empty on the last page.
+type UserListResponse struct {
+	Users      []UserResponse `json:"users"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// AdminUserResponse is the view of a user given to administrators. The
+// status details are only set while the account is not active.
+type AdminUserResponse struct {
+	UserResponse
+	StatusReason    string     `json:"status_reason,omitempty"`
+	StatusChangedBy *uint      `json:"status_changed_by,omitempty"`
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+	StatusExpiresAt *time.Time `json:"status_expires_at,omitempty"`
+	Providers       []string   `json:"providers"`
+}
+
+// SetUserStatusInput is the body of PUT /admin/users/{id}/status. A reason
+// is required for every status but active; only suspensions can expire.
+type SetUserStatusInput struct {
+	Status    string     `json:"status" binding:"required,oneof=active suspended banned pending"`
+	Reason    string     `json:"reason" binding:"max=500"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// AdminUpdateUserInput is the body of PATCH /admin/users/{id}; only the
+// fields present in the request are changed.
+type AdminUpdateUserInput struct {
+	Name          *string `json:"name" binding:"omitnil,min=1,max=100"`
+	Email         *string `json:"email" binding:"omitnil,email"`
+	EmailVerified *bool   `json:"email_verified"`
+	Locale        *string `json:"locale" binding:"omitnil,len=0|bcp47_language_tag,max=35"`
+	Timezone      *string `json:"timezone" binding:"omitnil,len=0|timezone,max=64"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// WebAuthnCredential is a passkey or security key registered by a user.
+// CredentialID is the base64url encoded credential ID from the authenticator.
+type WebAuthnCredential struct {
+	gorm.Model
+	UserID          uint       `gorm:"not null;index"`
+	CredentialID    string     `gorm:"not null;size:255;uniqueIndex"`
+	PublicKey       []byte     `gorm:"not null"`
+	AttestationType string     `gorm:"size:32"`
+	AAGUID          []byte     `gorm:"size:16"`
+	SignCount       uint32     `gorm:"not null;default:0"`
+	Transports      string     `gorm:"size:255"` // comma separated
+	BackupEligible  bool       `gorm:"not null;default:false"`
+	BackupState     bool       `gorm:"not null;default:false"`
+	Name            string     `gorm:"size:255"`
+	LastUsedAt      *time.Time `gorm:"default:null"`
+}
+
+// WebAuthnChallenge keeps the session data of a started ceremony until the
+// browser answers it. Challenges are looked up by value and used once.
+type WebAuthnChallenge struct {
+	gorm.Model
+	Challenge   string    `gorm:"not null;size:128;uniqueIndex"`
+	UserID      uint      `gorm:"not null;default:0"`
+	Ceremony    string    `gorm:"not null;size:16"`
+	SessionData string    `gorm:"type:text;not null"`
+	ExpiresAt   time.Time `gorm:"not null"`
+}
+
+type WebAuthnMFAInput struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+type WebAuthnCredentialResponse struct {
+	ID             uint       `json:"id"`
+	Name           string     `json:"name"`
+	Transports     []string   `json:"transports"`
+	BackupEligible bool       `json:"backup_eligible"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+}
+
+// WebAuthnRegistrationResponse describes a newly registered credential.
+// RecoveryCodes is only set when the registration turned MFA on.
+type WebAuthnRegistrationResponse struct {
+	Credential    WebAuthnCredentialResponse `json:"credential"`
+	RecoveryCodes []string                   `json:"recovery_codes,omitempty"`
+}
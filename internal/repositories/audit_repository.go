@@ -0,0 +1,206 @@
+package repositories
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+	"user-service/internal/models"
+)
+
+// auditChainHeadID is the ID of the only AuditChainHead row.
+const auditChainHeadID = 1
+
+// AuditRepository stores the audit log. Events can only be appended; the
+// only change ever made to a stored event is the redaction of its personal
+// fields when a user is erased.
+type AuditRepository struct {
+	DB *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) *AuditRepository {
+	return &AuditRepository{DB: db}
+}
+
+// Append chains the event to the newest one and stores it. The chain head
+// is locked for the duration so concurrent appends are chained in turn.
+func (ar *AuditRepository) Append(event *models.AuditEvent) error {
+	return ar.DB.Transaction(func(tx *gorm.DB) error {
+		head, err := lockChainHead(tx)
+		if err != nil {
+			return err
+		}
+		event.CreatedAt = time.Now()
+		if err := chainEvent(tx, head, event); err != nil {
+			return err
+		}
+		return tx.Model(head).Update("hash", head.Hash).Error
+	})
+}
+
+// Enqueue stores an event to be chained by a later ChainPending. It does
+// not touch the chain head.
+func (ar *AuditRepository) Enqueue(event *models.PendingAuditEvent) error {
+	event.CreatedAt = time.Now()
+	return ar.DB.Create(event).Error
+}
+
+// ChainPending appends up to limit pending events to the log, oldest first,
+// under a single lock of the chain head, and returns how many it appended.
+func (ar *AuditRepository) ChainPending(limit int) (int, error) {
+	var count int
+	var first []models.PendingAuditEvent
+	if err := ar.DB.Select("id").Limit(1).Find(&first).Error; err != nil || len(first) == 0 {
+		return 0, err
+	}
+	err := ar.DB.Transaction(func(tx *gorm.DB) error {
+		head, err := lockChainHead(tx)
+		if err != nil {
+			return err
+		}
+		var pending []models.PendingAuditEvent
+		if err := tx.Order("id").Limit(limit).Find(&pending).Error; err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		ids := make([]uint, 0, len(pending))
+		for _, p := range pending {
+			event := models.AuditEvent{
+				CreatedAt:      p.CreatedAt,
+				ActorID:        p.ActorID,
+				OrganizationID: p.OrganizationID,
+				Action:         p.Action,
+				TargetType:     p.TargetType,
+				TargetID:       p.TargetID,
+				IP:             p.IP,
+				UserAgent:      p.UserAgent,
+				RequestID:      p.RequestID,
+				Changes:        p.Changes,
+			}
+			if err := chainEvent(tx, head, &event); err != nil {
+				return err
+			}
+			ids = append(ids, p.ID)
+		}
+		if err := tx.Delete(&models.PendingAuditEvent{}, ids).Error; err != nil {
+			return err
+		}
+		count = len(pending)
+		return tx.Model(head).Update("hash", head.Hash).Error
+	})
+	return count, err
+}
+
+// chainEvent links the event to the head, stores it and moves the head to
+// it. The caller holds the head's lock and saves it.
+func chainEvent(tx *gorm.DB, head *models.AuditChainHead, event *models.AuditEvent) error {
+	event.CreatedAt = event.CreatedAt.Truncate(time.Millisecond)
+	event.PIIDigest = event.ComputePIIDigest()
+	event.PrevHash = head.Hash
+	event.Hash = event.ComputeHash()
+	if err := tx.Create(event).Error; err != nil {
+		return err
+	}
+	head.Hash = event.Hash
+	return nil
+}
+
+// lockChainHead returns the chain head locked for update, creating it for
+// the first event.
+func lockChainHead(tx *gorm.DB) (*models.AuditChainHead, error) {
+	var head models.AuditChainHead
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&head, auditChainHeadID).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return &head, err
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.AuditChainHead{ID: auditChainHeadID}).Error; err != nil {
+		return nil, err
+	}
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&head, auditChainHeadID).Error
+	return &head, err
+}
+
+// Head returns the hash of the newest event, or "" when the log is empty.
+func (ar *AuditRepository) Head() (string, error) {
+	var head models.AuditChainHead
+	err := ar.DB.Limit(1).Find(&head, auditChainHeadID).Error
+	return head.Hash, err
+}
+
+type AuditFilter struct {
+	ActorID        uint
+	OrganizationID uint
+	Action         string
+	TargetType     string
+	TargetID       uint
+	RequestID      string
+	From           *time.Time
+	To             *time.Time
+	// BeforeID continues a listing after the event with this ID.
+	BeforeID uint
+}
+
+// List returns up to limit events matching the filter, newest first.
+func (ar *AuditRepository) List(filter AuditFilter, limit int) ([]models.AuditEvent, error) {
+	query := ar.DB.Model(&models.AuditEvent{})
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.OrganizationID != 0 {
+		query = query.Where("organization_id = ?", filter.OrganizationID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != 0 {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	if filter.BeforeID != 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+	var events []models.AuditEvent
+	err := query.Order("id DESC").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// Walk calls fn with every event in the order they were appended, in
+// batches of the given size, until fn fails.
+func (ar *AuditRepository) Walk(batchSize int, fn func([]models.AuditEvent) error) error {
+	var events []models.AuditEvent
+	return ar.DB.FindInBatches(&events, batchSize, func(tx *gorm.DB, batch int) error {
+		return fn(events)
+	}).Error
+}
+
+// redactAuditEvents clears the personal fields of the events the given
+// users took part in, as actor or as target. Events not chained yet are
+// cleared too, so they enter the log without them.
+func redactAuditEvents(tx *gorm.DB, userIDs []uint) error {
+	if err := tx.Model(&models.PendingAuditEvent{}).
+		Where("actor_id IN ? OR (target_type = ? AND target_id IN ?)", userIDs, models.AuditTargetUser, userIDs).
+		Updates(map[string]interface{}{"ip": "", "user_agent": "", "changes": nil}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.AuditEvent{}).
+		Where("redacted_at IS NULL AND (actor_id IN ? OR (target_type = ? AND target_id IN ?))", userIDs, models.AuditTargetUser, userIDs).
+		Updates(map[string]interface{}{
+			"ip":          "",
+			"user_agent":  "",
+			"changes":     nil,
+			"redacted_at": time.Now(),
+		}).Error
+}
@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"time"
+	"user-service/internal/models"
+)
+
+type DataExportRepository struct {
+	DB *gorm.DB
+}
+
+func NewDataExportRepository(db *gorm.DB) *DataExportRepository {
+	return &DataExportRepository{DB: db}
+}
+
+func (dr *DataExportRepository) Create(export *models.DataExport) error {
+	return dr.DB.Create(export).Error
+}
+
+// GetByID returns a user's export without its archive.
+func (dr *DataExportRepository) GetByID(userID, id uint) (*models.DataExport, error) {
+	var export models.DataExport
+	if err := dr.DB.Omit("data").Where("id = ? AND user_id = ?", id, userID).First(&export).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// GetWithData returns an export together with its archive.
+func (dr *DataExportRepository) GetWithData(id uint) (*models.DataExport, error) {
+	var export models.DataExport
+	if err := dr.DB.First(&export, id).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// HasPending reports whether the user has an export still being built.
+func (dr *DataExportRepository) HasPending(userID uint) (bool, error) {
+	var count int64
+	err := dr.DB.Model(&models.DataExport{}).Where("user_id = ? AND status = ?", userID, models.DataExportPending).Count(&count).Error
+	return count > 0, err
+}
+
+// ClaimPending returns up to limit pending exports that no worker holds and
+// leases them for lease. Like OutboxRepository.ClaimDue, the lease is
+// conditional on the value that was read so each export is claimed once.
+func (dr *DataExportRepository) ClaimPending(limit int, lease time.Duration) ([]models.DataExport, error) {
+	now := time.Now()
+	var pending []models.DataExport
+	if err := dr.DB.Omit("data").Where("status = ? AND (claimed_until IS NULL OR claimed_until <= ?)", models.DataExportPending, now).
+		Order("id").Limit(limit).Find(&pending).Error; err != nil {
+		return nil, err
+	}
+
+	claimed := pending[:0]
+	for _, export := range pending {
+		query := dr.DB.Model(&models.DataExport{}).Where("id = ? AND status = ?", export.ID, models.DataExportPending)
+		if export.ClaimedUntil == nil {
+			query = query.Where("claimed_until IS NULL")
+		} else {
+			query = query.Where("claimed_until = ?", *export.ClaimedUntil)
+		}
+		result := query.Update("claimed_until", now.Add(lease))
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			claimed = append(claimed, export)
+		}
+	}
+	return claimed, nil
+}
+
+func (dr *DataExportRepository) MarkReady(id uint, data []byte, expiresAt time.Time) error {
+	return dr.DB.Model(&models.DataExport{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       models.DataExportReady,
+		"data":         data,
+		"completed_at": time.Now(),
+		"expires_at":   expiresAt,
+	}).Error
+}
+
+func (dr *DataExportRepository) MarkFailed(id uint) error {
+	return dr.DB.Model(&models.DataExport{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       models.DataExportFailed,
+		"completed_at": time.Now(),
+	}).Error
+}
+
+// DeleteExpired removes the exports whose download window has passed.
+func (dr *DataExportRepository) DeleteExpired() error {
+	return dr.DB.Where("expires_at <= ?", time.Now()).Delete(&models.DataExport{}).Error
+}
+
+// ListSessions returns all of a user's sessions, including revoked and
+// expired ones, newest first.
+func (dr *DataExportRepository) ListSessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := dr.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// ListLoginAttempts returns all of a user's login attempts, newest first.
+func (dr *DataExportRepository) ListLoginAttempts(userID uint) ([]models.LoginAttempt, error) {
+	var attempts []models.LoginAttempt
+	err := dr.DB.Where("user_id = ?", userID).Order("id DESC").Find(&attempts).Error
+	return attempts, err
+}
+
+// ListAuditEvents returns the audit events the user took part in, as actor
+// or as target, newest first.
+func (dr *DataExportRepository) ListAuditEvents(userID uint) ([]models.AuditEvent, error) {
+	var events []models.AuditEvent
+	err := dr.DB.Where("actor_id = ? OR (target_type = ? AND target_id = ?)", userID, models.AuditTargetUser, userID).
+		Order("id DESC").Find(&events).Error
+	return events, err
+}
+
+// ListInvitations returns the invitations sent to an address or accepted by
+// the user, newest first.
+func (dr *DataExportRepository) ListInvitations(userID uint, email string) ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	err := dr.DB.Where("email = ? OR accepted_by_id = ?", email, userID).Order("created_at DESC").Find(&invitations).Error
+	return invitations, err
+}
@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"time"
+	"user-service/internal/models"
+)
+
+type EmailChangeRepository struct {
+	DB *gorm.DB
+}
+
+func NewEmailChangeRepository(db *gorm.DB) *EmailChangeRepository {
+	return &EmailChangeRepository{DB: db}
+}
+
+// Create stores a new request and cancels any earlier pending request of the
+// same user, so only the latest confirmation link works.
+func (er *EmailChangeRepository) Create(request *models.EmailChangeRequest) error {
+	return er.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.EmailChangeRequest{}).
+			Where("user_id = ? AND confirmed_at IS NULL AND cancelled_at IS NULL", request.UserID).
+			Update("cancelled_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(request).Error
+	})
+}
+
+func (er *EmailChangeRepository) GetByConfirmHash(hash string) (*models.EmailChangeRequest, error) {
+	var request models.EmailChangeRequest
+	if err := er.DB.Where("confirm_token_hash = ?", hash).First(&request).Error; err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (er *EmailChangeRepository) GetByCancelHash(hash string) (*models.EmailChangeRequest, error) {
+	var request models.EmailChangeRequest
+	if err := er.DB.Where("cancel_token_hash = ?", hash).First(&request).Error; err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// Confirm marks the request confirmed and moves the user to the new address
+// in one transaction. It reports false when the request is no longer pending
+// or the user's email changed in the meantime.
+func (er *EmailChangeRepository) Confirm(request *models.EmailChangeRequest) (bool, error) {
+	var ok bool
+	err := er.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.EmailChangeRequest{}).
+			Where("id = ? AND confirmed_at IS NULL AND cancelled_at IS NULL", request.ID).
+			Update("confirmed_at", now)
+		if result.Error != nil || result.RowsAffected != 1 {
+			return result.Error
+		}
+		result = tx.Model(&models.User{}).
+			Where("id = ? AND email = ?", request.UserID, request.OldEmail).
+			Updates(map[string]interface{}{"email": request.NewEmail, "email_verified_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return gorm.ErrRecordNotFound
+		}
+		ok = true
+		return nil
+	})
+	if err == gorm.ErrRecordNotFound {
+		return false, nil
+	}
+	return ok, err
+}
+
+// Cancel marks the request cancelled. If it had already been confirmed and
+// the user still has the new address, the old address is restored; the
+// cancel link was delivered there, which proves the user owns it.
+func (er *EmailChangeRepository) Cancel(request *models.EmailChangeRequest) (bool, error) {
+	var ok bool
+	err := er.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.EmailChangeRequest{}).
+			Where("id = ? AND cancelled_at IS NULL", request.ID).
+			Update("cancelled_at", time.Now())
+		if result.Error != nil || result.RowsAffected != 1 {
+			return result.Error
+		}
+		if request.ConfirmedAt != nil {
+			if err := tx.Model(&models.User{}).
+				Where("id = ? AND email = ?", request.UserID, request.NewEmail).
+				Updates(map[string]interface{}{"email": request.OldEmail, "email_verified_at": time.Now()}).Error; err != nil {
+				return err
+			}
+		}
+		ok = true
+		return nil
+	})
+	return ok, err
+}
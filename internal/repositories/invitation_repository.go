@@ -0,0 +1,119 @@
+package repositories
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"time"
+	"user-service/internal/models"
+)
+
+type InvitationRepository struct {
+	DB *gorm.DB
+}
+
+func NewInvitationRepository(db *gorm.DB) *InvitationRepository {
+	return &InvitationRepository{DB: db}
+}
+
+// Create stores a new invitation and revokes any earlier pending invitation
+// of the same address to the organization, so only the latest link works.
+func (ir *InvitationRepository) Create(invitation *models.Invitation) error {
+	return ir.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Invitation{}).
+			Where("organization_id = ? AND email = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitation.OrganizationID, invitation.Email).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Omit("Organization", "Role").Create(invitation).Error
+	})
+}
+
+func (ir *InvitationRepository) GetByID(organizationID, id uint) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := ir.DB.Joins("Organization").Joins("Role").
+		Where("invitations.organization_id = ? AND invitations.id = ?", organizationID, id).
+		First(&invitation).Error; err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (ir *InvitationRepository) GetByTokenHash(hash string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := ir.DB.Joins("Organization").Joins("Role").
+		Where("invitations.token_hash = ?", hash).First(&invitation).Error; err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// List returns the invitations of an organization, newest first.
+func (ir *InvitationRepository) List(organizationID uint) ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	err := ir.DB.Joins("Role").Where("invitations.organization_id = ?", organizationID).
+		Order("invitations.created_at DESC, invitations.id DESC").Find(&invitations).Error
+	return invitations, err
+}
+
+// Renew replaces the token and expiry of a pending invitation. It reports
+// false when the invitation is no longer pending.
+func (ir *InvitationRepository) Renew(invitation *models.Invitation) (bool, error) {
+	result := ir.DB.Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitation.ID).
+		Updates(map[string]interface{}{"token_hash": invitation.TokenHash, "expires_at": invitation.ExpiresAt})
+	return result.RowsAffected == 1, result.Error
+}
+
+// Revoke marks a pending invitation revoked. It reports false when the
+// invitation is no longer pending.
+func (ir *InvitationRepository) Revoke(invitation *models.Invitation) (bool, error) {
+	result := ir.DB.Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitation.ID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// Accept marks the invitation accepted by the user and adds them to the
+// organization with the invited role in one transaction. It reports false
+// when the invitation was used or revoked in the meantime.
+func (ir *InvitationRepository) Accept(invitation *models.Invitation, userID uint) (bool, error) {
+	err := ir.DB.Transaction(func(tx *gorm.DB) error {
+		return acceptInvitation(tx, invitation, userID)
+	})
+	if errors.Is(err, errInvitationNotPending) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// AcceptWithNewUser creates the user and accepts the invitation with the new
+// account in one transaction, so no account is left behind when the
+// invitation was used or revoked in the meantime, which is reported as false.
+func (ir *InvitationRepository) AcceptWithNewUser(invitation *models.Invitation, user *models.User) (bool, error) {
+	err := ir.DB.Transaction(func(tx *gorm.DB) error {
+		if err := createUser(tx, user); err != nil {
+			return err
+		}
+		return acceptInvitation(tx, invitation, user.ID)
+	})
+	if errors.Is(err, errInvitationNotPending) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// errInvitationNotPending rolls back an acceptance that lost a race.
+var errInvitationNotPending = errors.New("invitation is no longer pending")
+
+func acceptInvitation(tx *gorm.DB, invitation *models.Invitation, userID uint) error {
+	result := tx.Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitation.ID).
+		Updates(map[string]interface{}{"accepted_at": time.Now(), "accepted_by_id": userID})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return errInvitationNotPending
+	}
+	return addMember(tx, invitation.OrganizationID, userID, []uint{invitation.RoleID})
+}
@@ -0,0 +1,33 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"user-service/internal/models"
+)
+
+type LoginHistoryRepository struct {
+	DB *gorm.DB
+}
+
+func NewLoginHistoryRepository(db *gorm.DB) *LoginHistoryRepository {
+	return &LoginHistoryRepository{DB: db}
+}
+
+func (lr *LoginHistoryRepository) Create(attempt *models.LoginAttempt) error {
+	return lr.DB.Create(attempt).Error
+}
+
+// List returns up to limit of the user's login attempts older than the
+// attempt beforeID, newest first. success filters on the outcome when set.
+func (lr *LoginHistoryRepository) List(userID uint, success *bool, beforeID uint, limit int) ([]models.LoginAttempt, error) {
+	query := lr.DB.Where("user_id = ?", userID)
+	if success != nil {
+		query = query.Where("success = ?", *success)
+	}
+	if beforeID != 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+	var attempts []models.LoginAttempt
+	err := query.Order("id DESC").Limit(limit).Find(&attempts).Error
+	return attempts, err
+}
@@ -0,0 +1,110 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"time"
+	"user-service/internal/models"
+)
+
+type MFARepository struct {
+	DB *gorm.DB
+}
+
+func NewMFARepository(db *gorm.DB) *MFARepository {
+	return &MFARepository{DB: db}
+}
+
+// ReplaceRecoveryCodes deletes the user's recovery codes and stores the new ones.
+func (mr *MFARepository) ReplaceRecoveryCodes(userID uint, codes []models.MFARecoveryCode) error {
+	return mr.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// UseRecoveryCode consumes an unused recovery code, reporting whether one matched.
+func (mr *MFARepository) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	result := mr.DB.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// AdvanceTOTPStep records the last accepted TOTP time step. It reports false
+// when the step is not newer than the stored one, i.e. the code was replayed.
+func (mr *MFARepository) AdvanceTOTPStep(userID uint, step int64) (bool, error) {
+	result := mr.DB.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RecordFailedAttempt counts a wrong code at the MFA login step. Once
+// maxAttempts are reached the step is locked until lockedUntil and the count
+// starts over.
+func (mr *MFARepository) RecordFailedAttempt(userID uint, maxAttempts int, lockedUntil time.Time) error {
+	return mr.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			UpdateColumn("mfa_failed_attempts", gorm.Expr("mfa_failed_attempts + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).
+			Where("id = ? AND mfa_failed_attempts >= ?", userID, maxAttempts).
+			UpdateColumns(map[string]interface{}{"mfa_failed_attempts": 0, "mfa_locked_until": lockedUntil}).Error
+	})
+}
+
+// ResetFailedAttempts clears the count of wrong codes after a successful
+// MFA login.
+func (mr *MFARepository) ResetFailedAttempts(userID uint) error {
+	return mr.DB.Model(&models.User{}).
+		Where("id = ? AND (mfa_failed_attempts > 0 OR mfa_locked_until IS NOT NULL)", userID).
+		UpdateColumns(map[string]interface{}{"mfa_failed_attempts": 0, "mfa_locked_until": nil}).Error
+}
+
+// SetTOTPSecret stores a new TOTP secret (or clears it) and leaves MFA
+// disabled until EnableMFA is called.
+func (mr *MFARepository) SetTOTPSecret(userID uint, secret string) error {
+	return mr.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Updates(map[string]interface{}{"mfa_enabled": false, "totp_secret": secret, "pending_totp_secret": "", "totp_last_step": 0}).Error
+}
+
+// SetPendingTOTPSecret stores the secret of a TOTP enrollment that has not
+// been confirmed yet. It is not a second factor until ConfirmTOTPSecret.
+func (mr *MFARepository) SetPendingTOTPSecret(userID uint, secret string) error {
+	return mr.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("pending_totp_secret", secret).Error
+}
+
+// ConfirmTOTPSecret makes the pending secret the user's TOTP secret and
+// enables MFA. It reports false when the pending secret has changed since
+// it was checked.
+func (mr *MFARepository) ConfirmTOTPSecret(userID uint, secret string) (bool, error) {
+	result := mr.DB.Model(&models.User{}).
+		Where("id = ? AND pending_totp_secret = ?", userID, secret).
+		Updates(map[string]interface{}{"mfa_enabled": true, "totp_secret": secret, "pending_totp_secret": ""})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (mr *MFARepository) EnableMFA(userID uint) error {
+	return mr.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("mfa_enabled", true).Error
+}
@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"time"
+	"user-service/internal/models"
+)
+
+type OAuthRepository struct {
+	DB *gorm.DB
+}
+
+func NewOAuthRepository(db *gorm.DB) *OAuthRepository {
+	return &OAuthRepository{DB: db}
+}
+
+func (or *OAuthRepository) CreateClient(client *models.OAuthClient) error {
+	return or.DB.Create(client).Error
+}
+
+func (or *OAuthRepository) GetClientByClientID(clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	if err := or.DB.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// ListClients returns the clients of an organization, or every client when
+// organizationID is nil.
+func (or *OAuthRepository) ListClients(organizationID *uint) ([]models.OAuthClient, error) {
+	var clients []models.OAuthClient
+	query := or.DB.Order("id")
+	if organizationID != nil {
+		query = query.Where("organization_id = ?", *organizationID)
+	}
+	err := query.Find(&clients).Error
+	return clients, err
+}
+
+func (or *OAuthRepository) DeleteClient(client *models.OAuthClient) error {
+	return or.DB.Delete(client).Error
+}
+
+func (or *OAuthRepository) CreateAuthorizationCode(code *models.AuthorizationCode) error {
+	return or.DB.Create(code).Error
+}
+
+func (or *OAuthRepository) GetAuthorizationCodeByHash(hash string) (*models.AuthorizationCode, error) {
+	var code models.AuthorizationCode
+	if err := or.DB.Where("code_hash = ?", hash).First(&code).Error; err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// MarkAuthorizationCodeUsed consumes the code, reporting false if another
+// request already did.
+func (or *OAuthRepository) MarkAuthorizationCodeUsed(id uint) (bool, error) {
+	result := or.DB.Model(&models.AuthorizationCode{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (or *OAuthRepository) SetAuthorizationCodeSession(id uint, sessionID string) error {
+	return or.DB.Model(&models.AuthorizationCode{}).
+		Where("id = ?", id).
+		Update("session_id", sessionID).Error
+}
@@ -0,0 +1,130 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"user-service/internal/models"
+)
+
+type OrganizationRepository struct {
+	DB *gorm.DB
+}
+
+func NewOrganizationRepository(db *gorm.DB) *OrganizationRepository {
+	return &OrganizationRepository{DB: db}
+}
+
+// Create stores a new organization with its built-in roles and makes the
+// given user its owner.
+func (or *OrganizationRepository) Create(org *models.Organization, ownerID uint) error {
+	return or.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		var permissions []models.Permission
+		if err := tx.Where("name <> ?", models.PermOrganizationsManage).Find(&permissions).Error; err != nil {
+			return err
+		}
+		var memberPermissions []models.Permission
+		for _, permission := range permissions {
+			if permission.Name == models.PermMembersRead {
+				memberPermissions = append(memberPermissions, permission)
+			}
+		}
+		owner := models.Role{OrganizationID: &org.ID, Name: models.OrgOwnerRole, Description: "Full access to the organization", System: true, Permissions: permissions}
+		member := models.Role{OrganizationID: &org.ID, Name: models.OrgMemberRole, Description: "Default role of members", System: true, Permissions: memberPermissions}
+		if err := tx.Omit("Permissions.*").Create(&owner).Error; err != nil {
+			return err
+		}
+		if err := tx.Omit("Permissions.*").Create(&member).Error; err != nil {
+			return err
+		}
+		membership := models.Membership{OrganizationID: org.ID, UserID: ownerID, Roles: []models.Role{owner}}
+		return tx.Omit("Roles.*", "Organization", "User").Create(&membership).Error
+	})
+}
+
+func (or *OrganizationRepository) GetByID(id uint) (*models.Organization, error) {
+	var org models.Organization
+	if err := or.DB.First(&org, id).Error; err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (or *OrganizationRepository) SlugExists(slug string) (bool, error) {
+	var count int64
+	err := or.DB.Unscoped().Model(&models.Organization{}).Where("slug = ?", slug).Count(&count).Error
+	return count > 0, err
+}
+
+func (or *OrganizationRepository) UpdateName(id uint, name string) error {
+	return or.DB.Model(&models.Organization{}).Where("id = ?", id).Update("name", name).Error
+}
+
+// ListMemberships returns a user's active memberships with their
+// organization and roles, oldest first.
+func (or *OrganizationRepository) ListMemberships(userID uint) ([]models.Membership, error) {
+	var memberships []models.Membership
+	err := or.DB.Joins("Organization").Preload("Roles").
+		Where("memberships.user_id = ? AND memberships.deactivated_at IS NULL", userID).
+		Order("memberships.created_at, memberships.id").
+		Find(&memberships).Error
+	return memberships, err
+}
+
+// GetMembership returns the user's active membership of an organization.
+func (or *OrganizationRepository) GetMembership(organizationID, userID uint) (*models.Membership, error) {
+	var membership models.Membership
+	if err := or.DB.Where("organization_id = ? AND user_id = ? AND deactivated_at IS NULL", organizationID, userID).
+		First(&membership).Error; err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// ListMembers returns the memberships of an organization, deactivated ones
+// included, with their users and roles.
+func (or *OrganizationRepository) ListMembers(organizationID uint) ([]models.Membership, error) {
+	var memberships []models.Membership
+	err := or.DB.Joins("User").Preload("Roles").
+		Where("memberships.organization_id = ?", organizationID).Order("memberships.created_at, memberships.id").
+		Find(&memberships).Error
+	return memberships, err
+}
+
+// AddMember makes a user a member of an organization with the given roles.
+// Adding an existing member only adds the roles.
+func (or *OrganizationRepository) AddMember(organizationID, userID uint, roles []models.Role) error {
+	roleIDs := make([]uint, 0, len(roles))
+	for _, role := range roles {
+		roleIDs = append(roleIDs, role.ID)
+	}
+	return or.DB.Transaction(func(tx *gorm.DB) error {
+		return addMember(tx, organizationID, userID, roleIDs)
+	})
+}
+
+func addMember(tx *gorm.DB, organizationID, userID uint, roleIDs []uint) error {
+	membership := models.Membership{OrganizationID: organizationID, UserID: userID}
+	if err := tx.Where(&membership).FirstOrCreate(&membership).Error; err != nil {
+		return err
+	}
+	for _, roleID := range roleIDs {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Table("membership_roles").
+			Create(map[string]interface{}{"membership_id": membership.ID, "role_id": roleID}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveMember deletes a membership and its role assignments.
+func (or *OrganizationRepository) RemoveMember(membership *models.Membership) error {
+	return or.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM membership_roles WHERE membership_id = ?", membership.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(membership).Error
+	})
+}
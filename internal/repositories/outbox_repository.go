@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"time"
+	"user-service/internal/models"
+)
+
+type OutboxRepository struct {
+	DB *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) *OutboxRepository {
+	return &OutboxRepository{DB: db}
+}
+
+func (or *OutboxRepository) Create(email *models.OutboxEmail) error {
+	return or.DB.Create(email).Error
+}
+
+// ClaimDue returns up to limit pending emails whose next attempt is due and
+// pushes their next attempt out by lease. The push is conditional on the
+// value that was read, so when several workers poll the same table each
+// email is claimed by only one of them.
+func (or *OutboxRepository) ClaimDue(limit int, lease time.Duration) ([]models.OutboxEmail, error) {
+	now := time.Now()
+	var due []models.OutboxEmail
+	if err := or.DB.Where("status = ? AND next_attempt_at <= ?", models.OutboxStatusPending, now).
+		Order("next_attempt_at").Limit(limit).Find(&due).Error; err != nil {
+		return nil, err
+	}
+
+	claimed := due[:0]
+	for _, email := range due {
+		result := or.DB.Model(&models.OutboxEmail{}).
+			Where("id = ? AND status = ? AND next_attempt_at = ?", email.ID, models.OutboxStatusPending, email.NextAttemptAt).
+			Update("next_attempt_at", now.Add(lease))
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			claimed = append(claimed, email)
+		}
+	}
+	return claimed, nil
+}
+
+// MarkSent records a delivered email and clears its bodies.
+func (or *OutboxRepository) MarkSent(id uint) error {
+	return or.DB.Model(&models.OutboxEmail{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":     models.OutboxStatusSent,
+		"sent_at":    time.Now(),
+		"last_error": "",
+		"text_body":  "",
+		"html_body":  "",
+	}).Error
+}
+
+// MarkAttemptFailed records a failed delivery. A zero next time marks the
+// email as permanently failed and clears its bodies.
+func (or *OutboxRepository) MarkAttemptFailed(id uint, attempts int, lastError string, next time.Time) error {
+	updates := map[string]interface{}{
+		"attempts":   attempts,
+		"last_error": lastError,
+	}
+	if next.IsZero() {
+		updates["status"] = models.OutboxStatusFailed
+		updates["text_body"] = ""
+		updates["html_body"] = ""
+	} else {
+		updates["next_attempt_at"] = next
+	}
+	return or.DB.Model(&models.OutboxEmail{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// DeleteFinished removes sent and permanently failed emails last updated
+// before the cutoff.
+func (or *OutboxRepository) DeleteFinished(before time.Time) error {
+	return or.DB.Unscoped().
+		Where("status IN ? AND updated_at < ?", []string{models.OutboxStatusSent, models.OutboxStatusFailed}, before).
+		Delete(&models.OutboxEmail{}).Error
+}
@@ -0,0 +1,263 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"user-service/internal/models"
+)
+
+type RoleRepository struct {
+	DB *gorm.DB
+}
+
+func NewRoleRepository(db *gorm.DB) *RoleRepository {
+	return &RoleRepository{DB: db}
+}
+
+// SeedDefaults creates the permission catalog and the built-in roles, and
+// makes sure the admin role holds every permission.
+func (rr *RoleRepository) SeedDefaults() error {
+	return rr.DB.Transaction(func(tx *gorm.DB) error {
+		for _, permission := range models.PermissionCatalog {
+			permission := permission
+			if err := tx.Where(models.Permission{Name: permission.Name}).
+				Assign(models.Permission{Description: permission.Description}).
+				FirstOrCreate(&permission).Error; err != nil {
+				return err
+			}
+		}
+		var permissions []models.Permission
+		if err := tx.Find(&permissions).Error; err != nil {
+			return err
+		}
+		builtin := []models.Role{
+			{Name: models.AdminRole, Description: "Full access", System: true},
+			{Name: models.DefaultRole, Description: "Default role of new users", System: true},
+		}
+		for _, role := range builtin {
+			role := role
+			if err := tx.Where("organization_id IS NULL AND name = ?", role.Name).
+				Attrs(models.Role{Description: role.Description}).
+				Assign(models.Role{System: true}).
+				FirstOrCreate(&role).Error; err != nil {
+				return err
+			}
+			if role.Name == models.AdminRole {
+				if err := tx.Model(&role).Omit("Permissions.*").Association("Permissions").Replace(permissions); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateLegacyRoles moves the role names stored in the old users.role
+// column into role assignments and drops the column.
+func (rr *RoleRepository) MigrateLegacyRoles() error {
+	// Role names used to be unique across the service; they are now unique
+	// per organization.
+	if rr.DB.Migrator().HasIndex(&models.Role{}, "idx_roles_name") {
+		if err := rr.DB.Migrator().DropIndex(&models.Role{}, "idx_roles_name"); err != nil {
+			return err
+		}
+	}
+	if !rr.DB.Migrator().HasColumn(&models.User{}, "role") {
+		return nil
+	}
+	return rr.DB.Transaction(func(tx *gorm.DB) error {
+		var roles []models.Role
+		if err := tx.Where("organization_id IS NULL AND name IN ?", []string{models.AdminRole, models.DefaultRole}).Find(&roles).Error; err != nil {
+			return err
+		}
+		for _, role := range roles {
+			// Every account that was not an admin was a plain user.
+			query := tx.Table("users").Where("role = ?", models.AdminRole)
+			if role.Name == models.DefaultRole {
+				query = tx.Table("users").Where("role IS NULL OR role <> ?", models.AdminRole)
+			}
+			var userIDs []uint
+			if err := query.Pluck("id", &userIDs).Error; err != nil {
+				return err
+			}
+			rows := make([]map[string]interface{}, 0, len(userIDs))
+			for _, userID := range userIDs {
+				rows = append(rows, map[string]interface{}{"user_id": userID, "role_id": role.ID})
+			}
+			if len(rows) == 0 {
+				continue
+			}
+			if err := tx.Table("user_roles").Clauses(clause.OnConflict{DoNothing: true}).
+				CreateInBatches(rows, 500).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().DropColumn(&models.User{}, "role")
+	})
+}
+
+// List returns the roles of an organization, or the global roles when
+// organizationID is nil.
+func (rr *RoleRepository) List(organizationID *uint) ([]models.Role, error) {
+	var roles []models.Role
+	err := whereOrganization(rr.DB, organizationID).Preload("Permissions").Order("name").Find(&roles).Error
+	return roles, err
+}
+
+// GetByName finds a role of an organization, or a global role when
+// organizationID is nil.
+func (rr *RoleRepository) GetByName(organizationID *uint, name string) (*models.Role, error) {
+	var role models.Role
+	if err := whereOrganization(rr.DB, organizationID).Preload("Permissions").Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func whereOrganization(db *gorm.DB, organizationID *uint) *gorm.DB {
+	if organizationID == nil {
+		return db.Where("organization_id IS NULL")
+	}
+	return db.Where("organization_id = ?", *organizationID)
+}
+
+func (rr *RoleRepository) ListPermissions() ([]models.Permission, error) {
+	var permissions []models.Permission
+	err := rr.DB.Order("name").Find(&permissions).Error
+	return permissions, err
+}
+
+func (rr *RoleRepository) GetPermissionsByNames(names []string) ([]models.Permission, error) {
+	permissions := []models.Permission{}
+	if len(names) == 0 {
+		return permissions, nil
+	}
+	err := rr.DB.Where("name IN ?", names).Find(&permissions).Error
+	return permissions, err
+}
+
+func (rr *RoleRepository) Create(role *models.Role) error {
+	return rr.DB.Omit("Permissions.*").Create(role).Error
+}
+
+// Update saves the role's description and, when permissions is not nil,
+// replaces its permissions.
+func (rr *RoleRepository) Update(role *models.Role, permissions []models.Permission) error {
+	return rr.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(role).Omit(clause.Associations).Update("description", role.Description).Error; err != nil {
+			return err
+		}
+		if permissions == nil {
+			return nil
+		}
+		return tx.Model(role).Omit("Permissions.*").Association("Permissions").Replace(permissions)
+	})
+}
+
+// Delete removes a role together with its assignments.
+func (rr *RoleRepository) Delete(role *models.Role) error {
+	return rr.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM user_roles WHERE role_id = ?", role.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM membership_roles WHERE role_id = ?", role.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM role_permissions WHERE role_id = ?", role.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(role).Error
+	})
+}
+
+// ListUserRoles returns the global roles of a user.
+func (rr *RoleRepository) ListUserRoles(userID uint) ([]models.Role, error) {
+	var roles []models.Role
+	err := rr.DB.Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).Preload("Permissions").Order("roles.name").Find(&roles).Error
+	return roles, err
+}
+
+// ListMembershipRoles returns the roles a user holds in an organization
+// through an active membership.
+func (rr *RoleRepository) ListMembershipRoles(organizationID, userID uint) ([]models.Role, error) {
+	var roles []models.Role
+	err := rr.DB.Joins("JOIN membership_roles ON membership_roles.role_id = roles.id").
+		Joins("JOIN memberships ON memberships.id = membership_roles.membership_id").
+		Where("memberships.organization_id = ? AND memberships.user_id = ? AND memberships.deactivated_at IS NULL", organizationID, userID).
+		Preload("Permissions").Order("roles.name").Find(&roles).Error
+	return roles, err
+}
+
+// UserPermissions returns the names of a user's global roles and of their
+// roles in the organization (when not 0), and the union of their
+// permissions.
+func (rr *RoleRepository) UserPermissions(userID, organizationID uint) ([]string, []string, error) {
+	roles, err := rr.ListUserRoles(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if organizationID != 0 {
+		orgRoles, err := rr.ListMembershipRoles(organizationID, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		roles = append(roles, orgRoles...)
+	}
+	roleNames := make([]string, 0, len(roles))
+	permissionNames := []string{}
+	seen := map[string]bool{}
+	for _, role := range roles {
+		roleNames = append(roleNames, role.Name)
+		for _, permission := range role.Permissions {
+			if !seen[permission.Name] {
+				seen[permission.Name] = true
+				permissionNames = append(permissionNames, permission.Name)
+			}
+		}
+	}
+	return roleNames, permissionNames, nil
+}
+
+// AssignRole gives a role to a user. Assigning a role twice is a no-op.
+func (rr *RoleRepository) AssignRole(userID, roleID uint) error {
+	return rr.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Table("user_roles").Create(map[string]interface{}{"user_id": userID, "role_id": roleID}).Error
+}
+
+// RemoveRole takes a role from a user. It reports false when the user did
+// not have it.
+func (rr *RoleRepository) RemoveRole(userID, roleID uint) (bool, error) {
+	result := rr.DB.Exec("DELETE FROM user_roles WHERE user_id = ? AND role_id = ?", userID, roleID)
+	return result.RowsAffected > 0, result.Error
+}
+
+// AssignMembershipRole gives an organization role to a member.
+func (rr *RoleRepository) AssignMembershipRole(membershipID, roleID uint) error {
+	return rr.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Table("membership_roles").Create(map[string]interface{}{"membership_id": membershipID, "role_id": roleID}).Error
+}
+
+// RemoveMembershipRole takes an organization role from a member. It reports
+// false when the member did not have it.
+func (rr *RoleRepository) RemoveMembershipRole(membershipID, roleID uint) (bool, error) {
+	result := rr.DB.Exec("DELETE FROM membership_roles WHERE membership_id = ? AND role_id = ?", membershipID, roleID)
+	return result.RowsAffected > 0, result.Error
+}
+
+// CountUsersWithRole counts the users holding a role, directly for global
+// roles or through an active membership for organization roles. Deleted
+// and disabled users are not counted.
+func (rr *RoleRepository) CountUsersWithRole(role *models.Role) (int64, error) {
+	var count int64
+	query := rr.DB.Table("user_roles").Joins("JOIN users ON users.id = user_roles.user_id").
+		Where("user_roles.role_id = ? AND users.deleted_at IS NULL AND users.status = ?", role.ID, models.UserStatusActive)
+	if role.OrganizationID != nil {
+		query = rr.DB.Table("membership_roles").
+			Joins("JOIN memberships ON memberships.id = membership_roles.membership_id").
+			Joins("JOIN users ON users.id = memberships.user_id").
+			Where("membership_roles.role_id = ? AND memberships.deactivated_at IS NULL AND users.deleted_at IS NULL AND users.status = ?", role.ID, models.UserStatusActive)
+	}
+	err := query.Count(&count).Error
+	return count, err
+}
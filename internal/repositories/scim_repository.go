@@ -0,0 +1,228 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+	"user-service/internal/models"
+)
+
+// SCIMRepository stores SCIM tokens and runs the membership and role queries
+// behind the SCIM Users and Groups endpoints.
+type SCIMRepository struct {
+	DB *gorm.DB
+}
+
+func NewSCIMRepository(db *gorm.DB) *SCIMRepository {
+	return &SCIMRepository{DB: db}
+}
+
+func (sr *SCIMRepository) CreateToken(token *models.SCIMToken) error {
+	return sr.DB.Create(token).Error
+}
+
+func (sr *SCIMRepository) GetTokenByHash(hash string) (*models.SCIMToken, error) {
+	var token models.SCIMToken
+	if err := sr.DB.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (sr *SCIMRepository) TouchToken(id uint) error {
+	return sr.DB.Model(&models.SCIMToken{}).Where("id = ?", id).Update("last_used_at", time.Now()).Error
+}
+
+func (sr *SCIMRepository) ListTokens(organizationID uint) ([]models.SCIMToken, error) {
+	var tokens []models.SCIMToken
+	err := sr.DB.Where("organization_id = ?", organizationID).Order("id").Find(&tokens).Error
+	return tokens, err
+}
+
+// DeleteToken deletes a token of the organization. It reports false when
+// there was no such token.
+func (sr *SCIMRepository) DeleteToken(organizationID, id uint) (bool, error) {
+	result := sr.DB.Where("organization_id = ? AND id = ?", organizationID, id).Delete(&models.SCIMToken{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// SCIMFilter restricts a listing to rows whose Column equals Value. An empty
+// Column lists everything.
+type SCIMFilter struct {
+	Column string
+	Value  string
+}
+
+// ListMembers returns a page of an organization's memberships, deactivated
+// ones included, with their users and roles, and the total number matching
+// the filter.
+func (sr *SCIMRepository) ListMembers(organizationID uint, filter SCIMFilter, offset, limit int) ([]models.Membership, int64, error) {
+	query := sr.DB.Model(&models.Membership{}).Joins("User").Where("memberships.organization_id = ?", organizationID)
+	if filter.Column != "" {
+		query = query.Where(filter.Column+" = ?", filter.Value)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var memberships []models.Membership
+	err := query.Preload("Roles").Order("memberships.user_id").Offset(offset).Limit(limit).Find(&memberships).Error
+	return memberships, total, err
+}
+
+// GetMember returns a user's membership of the organization, deactivated or
+// not, with the user and roles.
+func (sr *SCIMRepository) GetMember(organizationID, userID uint) (*models.Membership, error) {
+	var membership models.Membership
+	if err := sr.DB.Joins("User").Preload("Roles").
+		Where("memberships.organization_id = ? AND memberships.user_id = ?", organizationID, userID).
+		First(&membership).Error; err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// GetMembershipByUserEmail finds the membership of the user with the email,
+// deactivated or not.
+func (sr *SCIMRepository) GetMembershipByUserEmail(organizationID uint, email string) (*models.Membership, error) {
+	var membership models.Membership
+	if err := sr.DB.Joins("User").
+		Where("memberships.organization_id = ? AND User.email = ?", organizationID, email).
+		First(&membership).Error; err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// Provision makes the user a member of the organization with the given
+// roles, creating the user first when it has no ID yet.
+func (sr *SCIMRepository) Provision(user *models.User, membership *models.Membership, roleIDs []uint) error {
+	return sr.DB.Transaction(func(tx *gorm.DB) error {
+		if user.ID == 0 {
+			if err := createUser(tx, user); err != nil {
+				return err
+			}
+		}
+		membership.UserID = user.ID
+		if err := tx.Omit("Roles", "Organization", "User").Create(membership).Error; err != nil {
+			return err
+		}
+		for _, roleID := range roleIDs {
+			if err := tx.Table("membership_roles").
+				Create(map[string]interface{}{"membership_id": membership.ID, "role_id": roleID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateMember saves the SCIM fields of a membership and, when userValues
+// is not empty, the given columns of its user.
+func (sr *SCIMRepository) UpdateMember(membership *models.Membership, userValues map[string]interface{}) error {
+	return sr.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Membership{}).Where("id = ?", membership.ID).
+			Updates(map[string]interface{}{"external_id": membership.ExternalID, "deactivated_at": membership.DeactivatedAt}).Error; err != nil {
+			return err
+		}
+		if len(userValues) == 0 {
+			return nil
+		}
+		return tx.Model(&models.User{}).Where("id = ?", membership.UserID).Updates(userValues).Error
+	})
+}
+
+// ListRoles returns a page of an organization's roles and the total number
+// matching the filter.
+func (sr *SCIMRepository) ListRoles(organizationID uint, filter SCIMFilter, offset, limit int) ([]models.Role, int64, error) {
+	query := sr.DB.Model(&models.Role{}).Where("organization_id = ?", organizationID)
+	if filter.Column != "" {
+		query = query.Where(filter.Column+" = ?", filter.Value)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var roles []models.Role
+	err := query.Order("id").Offset(offset).Limit(limit).Find(&roles).Error
+	return roles, total, err
+}
+
+func (sr *SCIMRepository) GetRole(organizationID, id uint) (*models.Role, error) {
+	var role models.Role
+	if err := sr.DB.Where("organization_id = ? AND id = ?", organizationID, id).First(&role).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// ListRoleMembers returns the memberships holding a role, with their users.
+func (sr *SCIMRepository) ListRoleMembers(roleID uint) ([]models.Membership, error) {
+	var memberships []models.Membership
+	err := sr.DB.Joins("User").
+		Joins("JOIN membership_roles ON membership_roles.membership_id = memberships.id").
+		Where("membership_roles.role_id = ?", roleID).Order("memberships.user_id").
+		Find(&memberships).Error
+	return memberships, err
+}
+
+// CountMembers counts how many of the users are members of the
+// organization, deactivated or not.
+func (sr *SCIMRepository) CountMembers(organizationID uint, userIDs []uint) (int64, error) {
+	var count int64
+	err := sr.DB.Model(&models.Membership{}).
+		Where("organization_id = ? AND user_id IN ?", organizationID, userIDs).Count(&count).Error
+	return count, err
+}
+
+// SaveRole stores a new role, or renames an existing one, and then gives it
+// to the users in add and takes it from the users in remove. With replace
+// set, remove is ignored and every other holder loses the role.
+func (sr *SCIMRepository) SaveRole(role *models.Role, add, remove []uint, replace bool) error {
+	return sr.DB.Transaction(func(tx *gorm.DB) error {
+		if role.ID == 0 {
+			if err := tx.Omit("Permissions").Create(role).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Model(role).Update("name", role.Name).Error; err != nil {
+			return err
+		}
+		if replace {
+			if err := tx.Exec("DELETE FROM membership_roles WHERE role_id = ?", role.ID).Error; err != nil {
+				return err
+			}
+		} else if len(remove) > 0 {
+			members := tx.Model(&models.Membership{}).Select("id").
+				Where("organization_id = ? AND user_id IN ?", *role.OrganizationID, remove)
+			if err := tx.Exec("DELETE FROM membership_roles WHERE role_id = ? AND membership_id IN (?)", role.ID, members).Error; err != nil {
+				return err
+			}
+		}
+		if len(add) == 0 {
+			return nil
+		}
+		var membershipIDs []uint
+		if err := tx.Model(&models.Membership{}).Where("organization_id = ? AND user_id IN ?", *role.OrganizationID, add).
+			Pluck("id", &membershipIDs).Error; err != nil {
+			return err
+		}
+		for _, membershipID := range membershipIDs {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Table("membership_roles").
+				Create(map[string]interface{}{"membership_id": membershipID, "role_id": role.ID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveMember deletes a membership and its role assignments, leaving the
+// user's account in place.
+func (sr *SCIMRepository) RemoveMember(membership *models.Membership) error {
+	return sr.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM membership_roles WHERE membership_id = ?", membership.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Membership{}, membership.ID).Error
+	})
+}
@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"time"
+	"user-service/internal/models"
+)
+
+type SessionRepository struct {
+	DB *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) *SessionRepository {
+	return &SessionRepository{DB: db}
+}
+
+func (sr *SessionRepository) Create(session *models.Session) error {
+	return sr.DB.Create(session).Error
+}
+
+func (sr *SessionRepository) GetBySessionID(sessionID string) (*models.Session, error) {
+	var session models.Session
+	if err := sr.DB.Where("session_id = ?", sessionID).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (sr *SessionRepository) ListActiveByUserID(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := sr.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (sr *SessionRepository) Touch(sessionID string, lastSeen time.Time) error {
+	return sr.DB.Model(&models.Session{}).
+		Where("session_id = ?", sessionID).
+		Update("last_seen_at", lastSeen).Error
+}
+
+func (sr *SessionRepository) Extend(sessionID string, expiresAt time.Time) error {
+	return sr.DB.Model(&models.Session{}).
+		Where("session_id = ?", sessionID).
+		Updates(map[string]interface{}{"expires_at": expiresAt, "last_seen_at": time.Now()}).Error
+}
+
+// SetOrganization changes the active organization of a session.
+func (sr *SessionRepository) SetOrganization(sessionID string, organizationID *uint) error {
+	return sr.DB.Model(&models.Session{}).
+		Where("session_id = ?", sessionID).
+		Update("organization_id", organizationID).Error
+}
+
+func (sr *SessionRepository) Revoke(sessionID string) error {
+	return sr.DB.Model(&models.Session{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeAllByUserID revokes every active session of the user except the one
+// given in exceptSessionID, and returns the IDs of the sessions it revoked.
+func (sr *SessionRepository) RevokeAllByUserID(userID uint, exceptSessionID string) ([]string, error) {
+	var ids []string
+	query := sr.DB.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if exceptSessionID != "" {
+		query = query.Where("session_id <> ?", exceptSessionID)
+	}
+	if err := query.Pluck("session_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return ids, nil
+	}
+	err := sr.DB.Model(&models.Session{}).
+		Where("session_id IN ?", ids).
+		Update("revoked_at", time.Now()).Error
+	return ids, err
+}
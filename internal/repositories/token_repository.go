@@ -0,0 +1,88 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"time"
+	"user-service/internal/models"
+)
+
+type TokenRepository struct {
+	DB *gorm.DB
+}
+
+func NewTokenRepository(db *gorm.DB) *TokenRepository {
+	return &TokenRepository{DB: db}
+}
+
+func (tr *TokenRepository) CreateRefreshToken(token *models.RefreshToken) error {
+	return tr.DB.Create(token).Error
+}
+
+func (tr *TokenRepository) GetRefreshTokenByHash(hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := tr.DB.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed flags the token as consumed. It reports false when the
+// token had already been used or revoked, so concurrent refreshes with the
+// same token cannot both succeed.
+func (tr *TokenRepository) MarkRefreshTokenUsed(id uint) (bool, error) {
+	result := tr.DB.Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (tr *TokenRepository) RevokeRefreshTokenFamily(familyID string) error {
+	return tr.DB.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (tr *TokenRepository) RevokeRefreshTokenFamilies(familyIDs []string) error {
+	if len(familyIDs) == 0 {
+		return nil
+	}
+	return tr.DB.Model(&models.RefreshToken{}).
+		Where("family_id IN ? AND revoked_at IS NULL", familyIDs).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (tr *TokenRepository) CreatePasswordResetToken(token *models.PasswordResetToken) error {
+	return tr.DB.Create(token).Error
+}
+
+func (tr *TokenRepository) GetPasswordResetTokenByHash(hash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	if err := tr.DB.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// UsePasswordResetTokens marks every unused reset token of the user as used.
+// It reports whether the given token was among them, so a token can only
+// reset the password once and older links die with it.
+func (tr *TokenRepository) UsePasswordResetTokens(userID, tokenID uint) (bool, error) {
+	var ok bool
+	err := tr.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", tokenID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		ok = result.RowsAffected == 1
+		return tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", userID).
+			Update("used_at", now).Error
+	})
+	return ok, err
+}
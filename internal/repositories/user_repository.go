@@ -2,7 +2,11 @@ package repositories
 
 import (
 	"errors"
+	"fmt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
 	"user-service/internal/models"
 )
 
@@ -14,8 +18,22 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 	return &UserRepository{DB: db}
 }
 
+// Create stores a new user. A user created without roles gets the default
+// role.
 func (ur *UserRepository) Create(user *models.User) error {
-	return ur.DB.Create(user).Error
+	return ur.DB.Transaction(func(tx *gorm.DB) error {
+		return createUser(tx, user)
+	})
+}
+
+func createUser(tx *gorm.DB, user *models.User) error {
+	if len(user.Roles) == 0 {
+		var role models.Role
+		if err := tx.Where("organization_id IS NULL AND name = ?", models.DefaultRole).First(&role).Error; err == nil {
+			user.Roles = []models.Role{role}
+		}
+	}
+	return tx.Omit("Roles.*").Create(user).Error
 }
 
 func (ur *UserRepository) CreateAuthProvider(authProvider *models.AuthProvider) error {
@@ -31,14 +49,41 @@ func (ur *UserRepository) GetByEmail(email string) (*models.User, error) {
 	return &user, nil
 }
 
-func (ur *UserRepository) GetUserByProviderID(providerID string) (*models.User, error) {
+// GetUserByProviderID finds the user linked to an external account.
+func (ur *UserRepository) GetUserByProviderID(provider, providerID string) (*models.User, error) {
 	var user models.User
-	if err := ur.DB.Where("provider_id = ?", providerID).First(&user).Error; err != nil {
+	if err := ur.DB.Joins("JOIN auth_providers ON auth_providers.user_id = users.id AND auth_providers.deleted_at IS NULL").
+		Where("auth_providers.provider = ? AND auth_providers.provider_id = ?", provider, providerID).
+		First(&user).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
+// CreateWithAuthProvider creates a user together with their first provider link.
+func (ur *UserRepository) CreateWithAuthProvider(user *models.User, authProvider *models.AuthProvider) error {
+	return ur.DB.Transaction(func(tx *gorm.DB) error {
+		if err := createUser(tx, user); err != nil {
+			return err
+		}
+		authProvider.UserID = user.ID
+		return tx.Create(authProvider).Error
+	})
+}
+
+func (ur *UserRepository) ListAuthProviders(userID uint) ([]models.AuthProvider, error) {
+	var providers []models.AuthProvider
+	err := ur.DB.Where("user_id = ?", userID).Order("created_at").Find(&providers).Error
+	return providers, err
+}
+
+// DeleteAuthProvider removes the link for good so the provider account can
+// be linked again later.
+func (ur *UserRepository) DeleteAuthProvider(userID uint, provider string) (bool, error) {
+	result := ur.DB.Unscoped().Where("user_id = ? AND provider = ?", userID, provider).Delete(&models.AuthProvider{})
+	return result.RowsAffected > 0, result.Error
+}
+
 func (ur *UserRepository) CheckEmailExist(user *models.User) error {
 	var count int64
 	ur.DB.Model(&models.User{}).Where("email = ?", user.Email).Count(&count)
@@ -50,7 +95,7 @@ func (ur *UserRepository) CheckEmailExist(user *models.User) error {
 
 func (ur *UserRepository) GetByID(id uint) (*models.User, error) {
 	var user models.User
-	result := ur.DB.First(&user, id)
+	result := ur.DB.Preload("Roles").First(&user, id)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -58,5 +103,285 @@ func (ur *UserRepository) GetByID(id uint) (*models.User, error) {
 }
 
 func (ur *UserRepository) Update(user *models.User) error {
-	return ur.DB.Save(user).Error
+	return ur.DB.Omit(clause.Associations).Save(user).Error
+}
+
+// TouchLastLogin sets the user's LastLogin without changing UpdatedAt.
+func (ur *UserRepository) TouchLastLogin(id uint, at time.Time) error {
+	return ur.DB.Model(&models.User{}).Where("id = ?", id).UpdateColumn("last_login", at).Error
+}
+
+// UpdateColumns updates the given columns of a user without touching the others.
+func (ur *UserRepository) UpdateColumns(id uint, values map[string]interface{}) error {
+	return ur.DB.Model(&models.User{}).Where("id = ?", id).Updates(values).Error
+}
+
+// UserFilter selects the users returned by List. Zero fields do not filter.
+type UserFilter struct {
+	// OrganizationID limits the users to the organization's members.
+	OrganizationID uint
+	Search         string
+	Role           *models.Role
+	Provider       string
+	Verified       *bool
+	// Status is an account status; expired statuses count as active.
+	Status          string
+	Deleted         bool
+	CreatedAfter    *time.Time
+	CreatedBefore   *time.Time
+	LastLoginAfter  *time.Time
+	LastLoginBefore *time.Time
+	// Sort is "id", "email" or "name"; ties are broken by ID.
+	Sort       string
+	Descending bool
+	// After continues a listing after the user with the given sort value
+	// and ID.
+	After *UserCursor
+}
+
+type UserCursor struct {
+	Value string `json:"v,omitempty"`
+	ID    uint   `json:"id"`
+}
+
+// List returns up to limit users matching the filter, with their global
+// roles, in the filter's sort order.
+func (ur *UserRepository) List(filter UserFilter, limit int) ([]models.User, error) {
+	query := ur.DB.Model(&models.User{})
+	if filter.Deleted {
+		query = query.Unscoped().Where("users.deleted_at IS NOT NULL")
+	}
+	if filter.OrganizationID != 0 {
+		query = query.Where("users.id IN (?)", ur.DB.Table("memberships").Select("user_id").
+			Where("organization_id = ?", filter.OrganizationID))
+	}
+	if filter.Search != "" {
+		pattern := "%" + escapeLike(filter.Search) + "%"
+		query = query.Where("(users.name LIKE ? ESCAPE '!' OR users.email LIKE ? ESCAPE '!')", pattern, pattern)
+	}
+	if filter.Role != nil {
+		if filter.Role.OrganizationID == nil {
+			query = query.Where("users.id IN (?)", ur.DB.Table("user_roles").Select("user_id").
+				Where("role_id = ?", filter.Role.ID))
+		} else {
+			query = query.Where("users.id IN (?)", ur.DB.Table("memberships").Select("memberships.user_id").
+				Joins("JOIN membership_roles ON membership_roles.membership_id = memberships.id").
+				Where("membership_roles.role_id = ? AND memberships.deactivated_at IS NULL", filter.Role.ID))
+		}
+	}
+	if filter.Provider != "" {
+		query = query.Where("users.id IN (?)", ur.DB.Model(&models.AuthProvider{}).Select("user_id").
+			Where("provider = ?", filter.Provider))
+	}
+	if filter.Verified != nil {
+		if *filter.Verified {
+			query = query.Where("users.email_verified_at IS NOT NULL")
+		} else {
+			query = query.Where("users.email_verified_at IS NULL")
+		}
+	}
+	switch filter.Status {
+	case "":
+	case models.UserStatusActive:
+		query = query.Where("(users.status = ? OR users.status_expires_at <= ?)", models.UserStatusActive, time.Now())
+	default:
+		query = query.Where("users.status = ? AND (users.status_expires_at IS NULL OR users.status_expires_at > ?)", filter.Status, time.Now())
+	}
+	if filter.CreatedAfter != nil {
+		query = query.Where("users.created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("users.created_at < ?", *filter.CreatedBefore)
+	}
+	if filter.LastLoginAfter != nil {
+		query = query.Where("users.last_login >= ?", *filter.LastLoginAfter)
+	}
+	if filter.LastLoginBefore != nil {
+		query = query.Where("users.last_login < ?", *filter.LastLoginBefore)
+	}
+
+	column := "users.id"
+	if filter.Sort == "email" || filter.Sort == "name" {
+		column = "users." + filter.Sort
+	}
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if filter.After != nil {
+		if column == "users.id" {
+			query = query.Where("users.id "+comparison+" ?", filter.After.ID)
+		} else {
+			query = query.Where("("+column+" "+comparison+" ? OR ("+column+" = ? AND users.id "+comparison+" ?))",
+				filter.After.Value, filter.After.Value, filter.After.ID)
+		}
+	}
+	if column != "users.id" {
+		query = query.Order(column + " " + direction)
+	}
+	var users []models.User
+	err := query.Order("users.id " + direction).Limit(limit).Preload("Roles").Find(&users).Error
+	return users, err
+}
+
+// escapeLike escapes the LIKE wildcards of s for use with ESCAPE '!'.
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+// Delete soft-deletes a user. Their providers, roles and memberships are
+// kept.
+func (ur *UserRepository) Delete(user *models.User) error {
+	return ur.DB.Delete(user).Error
+}
+
+// GetStatus loads only the status columns of a user.
+func (ur *UserRepository) GetStatus(id uint) (*models.User, error) {
+	var user models.User
+	if err := ur.DB.Select("id", "status", "status_expires_at").First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetDeletedByID finds a soft-deleted user.
+func (ur *UserRepository) GetDeletedByID(id uint) (*models.User, error) {
+	var user models.User
+	if err := ur.DB.Unscoped().Preload("Roles").Where("deleted_at IS NOT NULL").First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Restore undoes the soft delete of a user.
+func (ur *UserRepository) Restore(id uint) error {
+	return ur.DB.Unscoped().Model(&models.User{}).Where("id = ?", id).Update("deleted_at", nil).Error
+}
+
+// GetByIDWithDeleted finds a user whether or not they are deleted.
+func (ur *UserRepository) GetByIDWithDeleted(id uint) (*models.User, error) {
+	var user models.User
+	if err := ur.DB.Unscoped().Preload("Roles").First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// PurgeDeleted permanently removes up to limit users deleted before the
+// given time, together with everything that belongs to them, and returns
+// how many were removed. Erased users are kept.
+func (ur *UserRepository) PurgeDeleted(before time.Time, limit int) (int, error) {
+	var userIDs []uint
+	if err := ur.DB.Unscoped().Model(&models.User{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ? AND erased_at IS NULL", before).
+		Order("deleted_at").Limit(limit).Pluck("id", &userIDs).Error; err != nil {
+		return 0, err
+	}
+	if len(userIDs) == 0 {
+		return 0, nil
+	}
+	err := ur.DB.Transaction(func(tx *gorm.DB) error {
+		if err := deleteUserData(tx, userIDs); err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.User{}, userIDs).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(userIDs), nil
+}
+
+// Erase anonymizes a user: the account row is kept, so records that refer
+// to it stay valid, but every personal field is cleared, the address is
+// replaced, and the user's logins, sessions, tokens, memberships and
+// exports are removed. Invitations sent to the address are anonymized and
+// queued emails to it are dropped. The account ends up deleted.
+func (ur *UserRepository) Erase(user *models.User) error {
+	now := time.Now()
+	erasedEmail := fmt.Sprintf("erased-%d@erased.invalid", user.ID)
+	return ur.DB.Transaction(func(tx *gorm.DB) error {
+		if err := deleteUserData(tx, []uint{user.ID}); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Invitation{}).Where("email = ?", user.Email).Update("email", erasedEmail).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("recipient = ?", user.Email).Delete(&models.OutboxEmail{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("email = ?", user.Email).Delete(&models.LoginAttempt{}).Error; err != nil {
+			return err
+		}
+		values := map[string]interface{}{
+			"email":                erasedEmail,
+			"password":             "",
+			"name":                 "Erased user",
+			"last_login":           nil,
+			"avatar_url":           "",
+			"locale":               "",
+			"timezone":             "",
+			"mfa_enabled":          false,
+			"totp_secret":          "",
+			"pending_totp_secret":  "",
+			"totp_last_step":       0,
+			"email_verified_at":    nil,
+			"verification_sent_at": nil,
+			"status_reason":        "",
+			"erased_at":            now,
+		}
+		if !user.DeletedAt.Valid {
+			values["deleted_at"] = now
+		}
+		return tx.Unscoped().Model(&models.User{}).Where("id = ?", user.ID).Updates(values).Error
+	})
+}
+
+// deleteUserData removes everything that belongs to the given users except
+// the account rows themselves. Audit events are kept with their personal
+// fields redacted.
+func deleteUserData(tx *gorm.DB, userIDs []uint) error {
+	if err := redactAuditEvents(tx, userIDs); err != nil {
+		return err
+	}
+	owned := []interface{}{
+		&models.AuthProvider{}, &models.Session{}, &models.RefreshToken{}, &models.PasswordResetToken{},
+		&models.AuthorizationCode{}, &models.MFARecoveryCode{}, &models.WebAuthnCredential{},
+		&models.WebAuthnChallenge{}, &models.EmailChangeRequest{}, &models.DataExport{}, &models.LoginAttempt{},
+	}
+	for _, model := range owned {
+		if err := tx.Unscoped().Where("user_id IN ?", userIDs).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	memberships := tx.Model(&models.Membership{}).Select("id").Where("user_id IN ?", userIDs)
+	if err := tx.Exec("DELETE FROM membership_roles WHERE membership_id IN (?)", memberships).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id IN ?", userIDs).Delete(&models.Membership{}).Error; err != nil {
+		return err
+	}
+	return tx.Exec("DELETE FROM user_roles WHERE user_id IN ?", userIDs).Error
+}
+
+// MarkEmailsVerified treats every existing account as verified. It is run
+// once when email verification is introduced, so REQUIRE_EMAIL_VERIFICATION
+// only applies to accounts created after that.
+func (ur *UserRepository) MarkEmailsVerified() error {
+	return ur.DB.Unscoped().Model(&models.User{}).
+		Where("email_verified_at IS NULL").
+		UpdateColumn("email_verified_at", gorm.Expr("created_at")).Error
+}
+
+// MigrateEmailIndex drops the unique index users.email had before
+// uniqueness moved to active_email; it also counted deleted accounts.
+func (ur *UserRepository) MigrateEmailIndex() error {
+	for _, name := range []string{"email", "uni_users_email"} {
+		if ur.DB.Migrator().HasIndex(&models.User{}, name) {
+			if err := ur.DB.Migrator().DropIndex(&models.User{}, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
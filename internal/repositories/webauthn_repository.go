@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"time"
+	"user-service/internal/models"
+)
+
+type WebAuthnRepository struct {
+	DB *gorm.DB
+}
+
+func NewWebAuthnRepository(db *gorm.DB) *WebAuthnRepository {
+	return &WebAuthnRepository{DB: db}
+}
+
+func (wr *WebAuthnRepository) CreateCredential(credential *models.WebAuthnCredential) error {
+	return wr.DB.Create(credential).Error
+}
+
+func (wr *WebAuthnRepository) ListCredentialsByUserID(userID uint) ([]models.WebAuthnCredential, error) {
+	var credentials []models.WebAuthnCredential
+	err := wr.DB.Where("user_id = ?", userID).Order("id").Find(&credentials).Error
+	return credentials, err
+}
+
+func (wr *WebAuthnRepository) UpdateCredentialUsage(id uint, signCount uint32, backupState bool) error {
+	return wr.DB.Model(&models.WebAuthnCredential{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"sign_count": signCount, "backup_state": backupState, "last_used_at": time.Now()}).Error
+}
+
+// DeleteCredential removes one of the user's credentials, reporting whether it existed.
+func (wr *WebAuthnRepository) DeleteCredential(userID, id uint) (bool, error) {
+	result := wr.DB.Unscoped().Where("id = ? AND user_id = ?", id, userID).Delete(&models.WebAuthnCredential{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteCredentialsByUserID removes every credential of the user.
+func (wr *WebAuthnRepository) DeleteCredentialsByUserID(userID uint) error {
+	return wr.DB.Unscoped().Where("user_id = ?", userID).Delete(&models.WebAuthnCredential{}).Error
+}
+
+func (wr *WebAuthnRepository) CreateChallenge(challenge *models.WebAuthnChallenge) error {
+	return wr.DB.Create(challenge).Error
+}
+
+// TakeChallenge returns and deletes the stored challenge of a ceremony, so
+// each challenge can only be answered once.
+func (wr *WebAuthnRepository) TakeChallenge(challenge, ceremony string) (*models.WebAuthnChallenge, error) {
+	var stored models.WebAuthnChallenge
+	err := wr.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("challenge = ? AND ceremony = ?", challenge, ceremony).First(&stored).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&stored).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
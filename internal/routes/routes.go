@@ -1,35 +1,239 @@
 package routes
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"log"
+	"user-service/config"
 	"user-service/internal/controllers"
 	middleware "user-service/internal/middlewares"
+	"user-service/internal/models"
 	"user-service/internal/repositories"
 	"user-service/internal/services"
 	"user-service/pkg/database"
+	"user-service/pkg/social"
 )
 
-func RegisterRoutes(r *gin.Engine) {
+// RegisterRoutes wires the services and registers every route. It fails
+// when a configured feature cannot be set up; features left unconfigured,
+// such as WebAuthn, are skipped. Services the caller also uses, such as
+// the ones running background workers, are passed in rather than built
+// again.
+func RegisterRoutes(r *gin.Engine, outboxService *services.OutboxService, dataExportService *services.DataExportService, auditService *services.AuditService, roleService *services.RoleService) error {
+	socialRegistry, err := social.NewRegistry(config.AppConfig.SocialProviders)
+	if err != nil {
+		return fmt.Errorf("configure login providers: %w", err)
+	}
+
+	r.Use(middleware.RequestID())
+
 	userRepo := repositories.NewUserRepository(database.GetDB())
-	userService := services.NewUserService(userRepo)
-	userController := controllers.NewUserController(userService)
+	tokenRepo := repositories.NewTokenRepository(database.GetDB())
+	sessionRepo := repositories.NewSessionRepository(database.GetDB())
+	oauthRepo := repositories.NewOAuthRepository(database.GetDB())
+	mfaRepo := repositories.NewMFARepository(database.GetDB())
+	webAuthnRepo := repositories.NewWebAuthnRepository(database.GetDB())
+	emailChangeRepo := repositories.NewEmailChangeRepository(database.GetDB())
+	roleRepo := repositories.NewRoleRepository(database.GetDB())
+	orgRepo := repositories.NewOrganizationRepository(database.GetDB())
+	invitationRepo := repositories.NewInvitationRepository(database.GetDB())
+	scimRepo := repositories.NewSCIMRepository(database.GetDB())
+	loginHistoryRepo := repositories.NewLoginHistoryRepository(database.GetDB())
+	loginHistoryService := services.NewLoginHistoryService(loginHistoryRepo, userRepo, auditService)
+	userService := services.NewUserService(userRepo, roleRepo, auditService, loginHistoryService)
+	tokenService := services.NewTokenService(tokenRepo, userRepo, sessionRepo, roleRepo, orgRepo, loginHistoryService)
+	sessionService := services.NewSessionService(sessionRepo, tokenRepo, userRepo)
+	oauthService := services.NewOAuthService(oauthRepo, userRepo, tokenService, auditService)
+	mfaService := services.NewMFAService(userRepo, mfaRepo, webAuthnRepo, loginHistoryService, auditService)
+	webAuthnService, err := services.NewWebAuthnService(userRepo, webAuthnRepo, mfaService, loginHistoryService, auditService)
+	if errors.Is(err, services.ErrWebAuthnNotConfigured) {
+		log.Printf("WEBAUTHN_RP_ID or WEBAUTHN_RP_NAME not set, passkeys and security keys are disabled")
+	} else if err != nil {
+		return err
+	} else {
+		mfaService.WebAuthnService = webAuthnService
+	}
+	passwordService := services.NewPasswordService(userRepo, tokenRepo, sessionService, outboxService, auditService)
+	emailVerificationService := services.NewEmailVerificationService(userRepo, outboxService)
+	emailChangeService := services.NewEmailChangeService(userRepo, emailChangeRepo, sessionService, outboxService, auditService)
+	accountLinkService := services.NewAccountLinkService(userRepo, webAuthnRepo, sessionService, socialRegistry, auditService)
+	socialAuthService := services.NewSocialAuthService(socialRegistry, userRepo, auditService, loginHistoryService)
+	organizationService := services.NewOrganizationService(orgRepo, roleRepo, sessionRepo, userRepo, tokenService, auditService)
+	invitationService := services.NewInvitationService(invitationRepo, orgRepo, roleRepo, userRepo, outboxService, auditService)
+	scimService := services.NewSCIMService(scimRepo, orgRepo, roleRepo, userRepo, auditService)
+	adminUserService := services.NewAdminUserService(userRepo, roleRepo, orgRepo, sessionService, mfaService, loginHistoryService, auditService)
+	accountDeletionService := services.NewAccountDeletionService(userRepo, roleRepo, orgRepo, sessionService, outboxService, auditService)
+	userController := controllers.NewUserController(userService, tokenService, emailVerificationService)
+	tokenController := controllers.NewTokenController(tokenService)
+	sessionController := controllers.NewSessionController(sessionService)
+	jwksController := controllers.NewJWKSController()
+	oauthController := controllers.NewOAuthController(oauthService)
+	mfaController := controllers.NewMFAController(mfaService, tokenService)
+	passwordController := controllers.NewPasswordController(passwordService)
+	emailVerificationController := controllers.NewEmailVerificationController(emailVerificationService)
+	emailChangeController := controllers.NewEmailChangeController(emailChangeService)
+	accountLinkController := controllers.NewAccountLinkController(accountLinkService)
+	socialAuthController := controllers.NewSocialAuthController(socialAuthService, accountLinkService, tokenService)
+	roleController := controllers.NewRoleController(roleService)
+	organizationController := controllers.NewOrganizationController(organizationService)
+	invitationController := controllers.NewInvitationController(invitationService)
+	scimController := controllers.NewSCIMController(scimService)
+	adminUserController := controllers.NewAdminUserController(adminUserService)
+	accountDeletionController := controllers.NewAccountDeletionController(accountDeletionService)
+	dataExportController := controllers.NewDataExportController(dataExportService)
+	auditController := controllers.NewAuditController(auditService)
+	loginHistoryController := controllers.NewLoginHistoryController(loginHistoryService)
+	authMiddleware := middleware.AuthMiddleware(sessionService)
+	clientAuthMiddleware := middleware.ClientAuthMiddleware(sessionService)
 
 	r.POST("/register", userController.Register)
 	r.POST("/login", userController.Login)
-	r.GET("/google-login", userController.GoogleLogin)
-	r.GET("/google-callback", userController.GoogleCallback)
+	r.POST("/login/mfa", mfaController.LoginMFA)
+	r.GET("/google-login", socialAuthController.GoogleLogin)
+	r.GET("/google-callback", socialAuthController.GoogleCallback)
+	r.GET("/auth/providers", socialAuthController.ListProviders)
+	r.GET("/auth/:provider/login", socialAuthController.Login)
+	r.GET("/auth/:provider/callback", socialAuthController.Callback)
+	r.POST("/auth/:provider/token", socialAuthController.TokenLogin)
+	r.POST("/token/refresh", tokenController.RefreshToken)
+	r.POST("/password/forgot", passwordController.ForgotPassword)
+	r.POST("/password/reset", passwordController.ResetPassword)
+	r.GET("/email/verify", emailVerificationController.VerifyEmail)
+	r.POST("/email/verify", emailVerificationController.VerifyEmail)
+	r.POST("/email/verification/resend", emailVerificationController.ResendVerification)
+	r.GET("/email/change/confirm", emailChangeController.ConfirmEmailChange)
+	r.POST("/email/change/confirm", emailChangeController.ConfirmEmailChange)
+	r.GET("/email/change/cancel", emailChangeController.CancelEmailChange)
+	r.POST("/email/change/cancel", emailChangeController.CancelEmailChange)
+	r.GET("/invitations", invitationController.PreviewInvitation)
+	r.POST("/invitations/accept", authMiddleware, invitationController.AcceptInvitation)
+	r.POST("/invitations/register", invitationController.RegisterWithInvitation)
+	r.GET("/exports/:id/download", dataExportController.DownloadExport)
+	r.GET("/.well-known/jwks.json", jwksController.GetJWKS)
+	r.GET("/.well-known/openid-configuration", oauthController.Discovery)
+
+	oauth := r.Group("/oauth2")
+	{
+		oauth.GET("/authorize", oauthController.StartAuthorize)
+		oauth.POST("/authorize", authMiddleware, oauthController.Authorize)
+		oauth.POST("/token", oauthController.Token)
+		oauth.GET("/userinfo", clientAuthMiddleware, oauthController.UserInfo)
+		oauth.POST("/userinfo", clientAuthMiddleware, oauthController.UserInfo)
+	}
 
 	admin := r.Group("/admin")
-	admin.Use(middleware.AuthMiddleware(), middleware.AdminMiddleware())
+	admin.Use(authMiddleware)
+	{
+		usersRead := middleware.RequirePermission(models.PermUsersRead)
+		usersWrite := middleware.RequirePermission(models.PermUsersWrite)
+		rolesRead := middleware.RequirePermission(models.PermRolesRead)
+		rolesWrite := middleware.RequirePermission(models.PermRolesWrite)
+		userInScope := middleware.RequireUserInScope(organizationService, "id")
+		admin.POST("/init-superuser", middleware.RequirePermission(models.PermOrganizationsManage), usersWrite, rolesWrite, userController.CreateSuperUser)
+		admin.POST("/oauth-clients", middleware.RequirePermission(models.PermOAuthClientsWrite), oauthController.CreateClient)
+		admin.GET("/oauth-clients", middleware.RequirePermission(models.PermOAuthClientsRead), oauthController.ListClients)
+		admin.DELETE("/oauth-clients/:client_id", middleware.RequirePermission(models.PermOAuthClientsWrite), oauthController.DeleteClient)
+		admin.GET("/users", usersRead, adminUserController.ListUsers)
+		admin.GET("/users/:id", usersRead, userInScope, adminUserController.GetUser)
+		admin.PATCH("/users/:id", usersWrite, userInScope, adminUserController.UpdateUser)
+		admin.DELETE("/users/:id", usersWrite, userInScope, adminUserController.DeleteUser)
+		admin.POST("/users/:id/restore", usersWrite, userInScope, adminUserController.RestoreUser)
+		admin.POST("/users/:id/erase", usersWrite, userInScope, adminUserController.EraseUser)
+		admin.PUT("/users/:id/status", usersWrite, userInScope, adminUserController.SetUserStatus)
+		admin.GET("/users/:id/login-history", usersRead, userInScope, adminUserController.GetLoginHistory)
+		admin.DELETE("/users/:id/mfa", usersWrite, userInScope, adminUserController.ResetMFA)
+		admin.GET("/users/:id/roles", usersRead, rolesRead, userInScope, roleController.ListUserRoles)
+		admin.PUT("/users/:id/roles/:role", rolesWrite, userInScope, roleController.AssignRole)
+		admin.DELETE("/users/:id/roles/:role", rolesWrite, userInScope, roleController.RemoveRole)
+		admin.GET("/roles", rolesRead, roleController.ListRoles)
+		admin.POST("/roles", rolesWrite, roleController.CreateRole)
+		admin.PATCH("/roles/:role", rolesWrite, roleController.UpdateRole)
+		admin.DELETE("/roles/:role", rolesWrite, roleController.DeleteRole)
+		admin.GET("/permissions", rolesRead, roleController.ListPermissions)
+		admin.GET("/audit-events", middleware.RequirePermission(models.PermAuditRead), auditController.ListEvents)
+		admin.GET("/audit-events/verify", middleware.RequirePermission(models.PermAuditRead, models.PermOrganizationsManage), auditController.VerifyChain)
+	}
+	orgs := r.Group("/orgs")
+	orgs.Use(authMiddleware)
 	{
-		admin.POST("/init-superuser", userController.CreateSuperUser)
+		activeOrg := middleware.RequireActiveOrg("id")
+		// A SCIM token can add members and grant them any organization
+		// role, so only those who could do both themselves may manage one.
+		manageSCIM := middleware.RequirePermission(models.PermOrganizationWrite, models.PermRolesWrite, models.PermMembersWrite)
+		orgs.GET("", organizationController.ListOrganizations)
+		orgs.POST("", organizationController.CreateOrganization)
+		orgs.GET("/:id", organizationController.GetOrganization)
+		orgs.PATCH("/:id", activeOrg, middleware.RequirePermission(models.PermOrganizationWrite), organizationController.UpdateOrganization)
+		orgs.POST("/:id/switch", organizationController.SwitchOrganization)
+		orgs.POST("/:id/leave", organizationController.LeaveOrganization)
+		orgs.GET("/:id/members", activeOrg, middleware.RequirePermission(models.PermMembersRead), organizationController.ListMembers)
+		orgs.DELETE("/:id/members/:user_id", activeOrg, middleware.RequirePermission(models.PermMembersWrite), organizationController.RemoveMember)
+		orgs.POST("/:id/invitations", activeOrg, middleware.RequirePermission(models.PermMembersWrite), invitationController.CreateInvitation)
+		orgs.GET("/:id/invitations", activeOrg, middleware.RequirePermission(models.PermMembersRead), invitationController.ListInvitations)
+		orgs.POST("/:id/invitations/:invitation_id/resend", activeOrg, middleware.RequirePermission(models.PermMembersWrite), invitationController.ResendInvitation)
+		orgs.DELETE("/:id/invitations/:invitation_id", activeOrg, middleware.RequirePermission(models.PermMembersWrite), invitationController.RevokeInvitation)
+		orgs.POST("/:id/scim-tokens", activeOrg, manageSCIM, scimController.CreateToken)
+		orgs.GET("/:id/scim-tokens", activeOrg, manageSCIM, scimController.ListTokens)
+		orgs.DELETE("/:id/scim-tokens/:token_id", activeOrg, manageSCIM, scimController.DeleteToken)
+	}
+	scim := r.Group("/scim/v2")
+	{
+		scimAuth := middleware.SCIMAuth(scimService)
+		scim.GET("/ServiceProviderConfig", scimController.ServiceProviderConfig)
+		scim.GET("/ResourceTypes", scimController.ResourceTypes)
+		scim.GET("/ResourceTypes/:id", scimController.ResourceTypes)
+		scim.GET("/Schemas", scimController.Schemas)
+		scim.GET("/Schemas/:id", scimController.Schemas)
+		scim.GET("/Users", scimAuth, scimController.ListUsers)
+		scim.POST("/Users", scimAuth, scimController.CreateUser)
+		scim.GET("/Users/:id", scimAuth, scimController.GetUser)
+		scim.PUT("/Users/:id", scimAuth, scimController.ReplaceUser)
+		scim.PATCH("/Users/:id", scimAuth, scimController.PatchUser)
+		scim.DELETE("/Users/:id", scimAuth, scimController.DeleteUser)
+		scim.GET("/Groups", scimAuth, scimController.ListGroups)
+		scim.POST("/Groups", scimAuth, scimController.CreateGroup)
+		scim.GET("/Groups/:id", scimAuth, scimController.GetGroup)
+		scim.PUT("/Groups/:id", scimAuth, scimController.ReplaceGroup)
+		scim.PATCH("/Groups/:id", scimAuth, scimController.PatchGroup)
+		scim.DELETE("/Groups/:id", scimAuth, scimController.DeleteGroup)
 	}
 	user := r.Group("/user")
-	user.Use(middleware.AuthMiddleware())
+	user.Use(authMiddleware)
 	{
-		//user.GET("/profile", userController.GetProfile)
-		//user.PUT("/profile", userController.UpdateProfile)
-		//user.POST("/auth-provider", userController.CreateAuthProvider)
+		user.DELETE("", accountDeletionController.DeleteAccount)
+		user.POST("/export", dataExportController.RequestExport)
+		user.GET("/export/:id", dataExportController.GetExport)
+		user.GET("/profile", userController.GetProfile)
+		user.PUT("/profile", userController.ReplaceProfile)
+		user.PATCH("/profile", userController.UpdateProfile)
+		user.GET("/auth-providers", accountLinkController.ListProviders)
+		user.POST("/auth-providers/:provider", accountLinkController.LinkProvider)
+		user.DELETE("/auth-providers/:provider", accountLinkController.UnlinkProvider)
 		user.POST("change-password", userController.ChangePassword)
+		user.POST("/email/change", emailChangeController.RequestEmailChange)
+		user.POST("/logout", sessionController.Logout)
+		user.POST("/logout-all", sessionController.LogoutAll)
+		user.GET("/sessions", sessionController.ListSessions)
+		user.GET("/login-history", loginHistoryController.GetLoginHistory)
+		user.DELETE("/sessions", sessionController.RevokeOtherSessions)
+		user.DELETE("/sessions/:id", sessionController.RevokeSession)
+		user.POST("/mfa/totp/setup", mfaController.SetupTOTP)
+		user.POST("/mfa/totp/confirm", mfaController.ConfirmTOTP)
+		user.POST("/mfa/recovery-codes", mfaController.RegenerateRecoveryCodes)
+		user.POST("/mfa/disable", mfaController.DisableMFA)
+	}
+	if webAuthnService != nil {
+		webAuthnController := controllers.NewWebAuthnController(webAuthnService, tokenService)
+		r.POST("/login/mfa/webauthn/begin", webAuthnController.BeginMFALogin)
+		r.POST("/login/mfa/webauthn/finish", webAuthnController.FinishMFALogin)
+		r.POST("/login/passkey/begin", webAuthnController.BeginPasskeyLogin)
+		r.POST("/login/passkey/finish", webAuthnController.FinishPasskeyLogin)
+		user.POST("/webauthn/reauth/begin", webAuthnController.BeginReauthentication)
+		user.POST("/webauthn/register/begin", webAuthnController.BeginRegistration)
+		user.POST("/webauthn/register/finish", webAuthnController.FinishRegistration)
+		user.GET("/webauthn/credentials", webAuthnController.ListCredentials)
+		user.DELETE("/webauthn/credentials/:id", webAuthnController.DeleteCredential)
 	}
+	return nil
 }
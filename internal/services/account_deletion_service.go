@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+	"user-service/utils"
+)
+
+// AccountDeletionGracePeriod is how long a deleted account can be restored
+// before it is purged for good.
+const AccountDeletionGracePeriod = time.Hour * 24 * 30
+
+var ErrRestoreWindowExpired = errors.New("the account can no longer be restored")
+
+// AccountDeletionService lets users delete their own account. Deleted
+// accounts are removed for good by AccountPurgeService.
+type AccountDeletionService struct {
+	UserRepository         *repositories.UserRepository
+	RoleRepository         *repositories.RoleRepository
+	OrganizationRepository *repositories.OrganizationRepository
+	SessionService         *SessionService
+	OutboxService          *OutboxService
+	AuditService           *AuditService
+}
+
+func NewAccountDeletionService(ur *repositories.UserRepository, rr *repositories.RoleRepository, or *repositories.OrganizationRepository, ss *SessionService, obs *OutboxService, as *AuditService) *AccountDeletionService {
+	return &AccountDeletionService{UserRepository: ur, RoleRepository: rr, OrganizationRepository: or, SessionService: ss, OutboxService: obs, AuditService: as}
+}
+
+// DeleteAccount soft-deletes the user's own account after checking the
+// current password, or the account email for accounts without a password.
+// The account is signed out everywhere and the user is told how long an
+// administrator can still restore it.
+func (ads *AccountDeletionService) DeleteAccount(userID uint, input models.DeleteAccountInput, info RequestInfo) error {
+	user, err := ads.UserRepository.GetByID(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if err := confirmIdentity(user, input.Password, input.Email); err != nil {
+		return err
+	}
+	if err := ensureNotLastAdminOrOwner(ads.RoleRepository, ads.OrganizationRepository, user); err != nil {
+		return err
+	}
+	if err := ads.UserRepository.Delete(user); err != nil {
+		return err
+	}
+	ads.AuditService.Record(info, models.AuditAccountDeleted, models.AuditTargetUser, userID, nil)
+	if err := ads.SessionService.RevokeAllSessions(userID, ""); err != nil {
+		return err
+	}
+	return ads.OutboxService.Enqueue(user.Email, "account_deleted", user.Locale, map[string]interface{}{
+		"Name":          user.Name,
+		"RestoreInDays": int(AccountDeletionGracePeriod.Hours() / 24),
+	})
+}
+
+// confirmIdentity checks the current password of a signed-in user, or the
+// account email when the account has no password, such as one created by a
+// social login or SCIM.
+func confirmIdentity(user *models.User, password, email string) error {
+	if user.Password != "" {
+		if !utils.CheckPasswordHash(password, user.Password) {
+			return utils.ErrInvalidCredentials
+		}
+	} else if !strings.EqualFold(strings.TrimSpace(email), user.Email) {
+		return utils.ErrInvalidCredentials
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+	"user-service/pkg/social"
+	"user-service/utils"
+)
+
+var (
+	ErrUnsupportedProvider   = errors.New("unsupported login provider")
+	ErrProviderAlreadyLinked = errors.New("login provider already linked")
+	ErrProviderNotLinked     = errors.New("login provider not linked")
+	ErrLastLoginMethod       = errors.New("cannot remove the last login method")
+)
+
+// AccountLinkService lets a signed-in user manage the external logins linked
+// to their account.
+type AccountLinkService struct {
+	UserRepository     *repositories.UserRepository
+	WebAuthnRepository *repositories.WebAuthnRepository
+	SessionService     *SessionService
+	Registry           *social.Registry
+	AuditService       *AuditService
+}
+
+func NewAccountLinkService(ur *repositories.UserRepository, wr *repositories.WebAuthnRepository, ss *SessionService, registry *social.Registry, as *AuditService) *AccountLinkService {
+	return &AccountLinkService{UserRepository: ur, WebAuthnRepository: wr, SessionService: ss, Registry: registry, AuditService: as}
+}
+
+func (als *AccountLinkService) ListProviders(userID uint) ([]models.AuthProviderResponse, error) {
+	providers, err := als.UserRepository.ListAuthProviders(userID)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]models.AuthProviderResponse, 0, len(providers))
+	for _, p := range providers {
+		response = append(response, models.AuthProviderResponse{
+			Provider: p.Provider,
+			Email:    p.Email,
+			LinkedAt: p.CreatedAt,
+		})
+	}
+	return response, nil
+}
+
+// StartLink begins linking a provider to the signed-in user. It returns the
+// provider's authorization URL and a signed state token for the callback,
+// which carries the user and session the link is for.
+func (als *AccountLinkService) StartLink(ctx context.Context, userID uint, sessionID, providerName, returnTo string) (string, string, error) {
+	provider, err := als.Registry.Get(providerName)
+	if err != nil {
+		return "", "", ErrUnsupportedProvider
+	}
+	return startAuthorization(ctx, provider, utils.OAuthStateClaims{
+		Provider:      providerName,
+		ReturnTo:      returnTo,
+		LinkUserID:    userID,
+		LinkSessionID: sessionID,
+	})
+}
+
+// LinkProvider finishes a link started with StartLink, redeeming the code
+// from a verified callback against the state, nonce and PKCE verifier of
+// that redirect. The session that started the link must still be active.
+// The provider email does not have to match the user's email.
+func (als *AccountLinkService) LinkProvider(ctx context.Context, code string, state *utils.OAuthStateClaims, info RequestInfo) error {
+	userID, providerName := state.LinkUserID, state.Provider
+	if err := als.SessionService.ValidateSession(state.LinkSessionID, userID); err != nil {
+		return err
+	}
+	provider, err := als.Registry.Get(providerName)
+	if err != nil {
+		return ErrUnsupportedProvider
+	}
+	identity, err := provider.Exchange(ctx, code, authRequest(state))
+	if err != nil {
+		return err
+	}
+
+	if owner, err := als.UserRepository.GetUserByProviderID(providerName, identity.ProviderID); err == nil {
+		if owner.ID == userID {
+			return nil
+		}
+		return ErrProviderAlreadyLinked
+	}
+	if err := als.UserRepository.CreateAuthProvider(&models.AuthProvider{
+		UserID:     userID,
+		Provider:   providerName,
+		ProviderID: identity.ProviderID,
+		Email:      identity.Email,
+	}); err != nil {
+		return ErrProviderAlreadyLinked
+	}
+	info.UserID = userID
+	als.AuditService.Record(info, models.AuditProviderLinked, models.AuditTargetUser, userID, map[string]string{
+		"provider": providerName,
+		"email":    identity.Email,
+	})
+	return nil
+}
+
+// UnlinkProvider removes a provider link unless it is the user's only way
+// to sign in: no password, no other provider and no passkey.
+func (als *AccountLinkService) UnlinkProvider(userID uint, provider string, info RequestInfo) error {
+	user, err := als.UserRepository.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	providers, err := als.UserRepository.ListAuthProviders(userID)
+	if err != nil {
+		return err
+	}
+	linked := false
+	for _, p := range providers {
+		if p.Provider == provider {
+			linked = true
+		}
+	}
+	if !linked {
+		return ErrProviderNotLinked
+	}
+
+	if user.Password == "" && len(providers) == 1 {
+		credentials, err := als.WebAuthnRepository.ListCredentialsByUserID(userID)
+		if err != nil {
+			return err
+		}
+		if len(credentials) == 0 {
+			return ErrLastLoginMethod
+		}
+	}
+	if _, err := als.UserRepository.DeleteAuthProvider(userID, provider); err != nil {
+		return err
+	}
+	als.AuditService.Record(info, models.AuditProviderUnlinked, models.AuditTargetUser, userID, map[string]string{"provider": provider})
+	return nil
+}
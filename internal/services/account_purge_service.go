@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+	"user-service/internal/repositories"
+)
+
+const (
+	accountPurgeInterval  = time.Hour
+	accountPurgeBatchSize = 100
+)
+
+// AccountPurgeService permanently removes deleted accounts once
+// AccountDeletionGracePeriod has passed.
+type AccountPurgeService struct {
+	UserRepository *repositories.UserRepository
+}
+
+func NewAccountPurgeService(ur *repositories.UserRepository) *AccountPurgeService {
+	return &AccountPurgeService{UserRepository: ur}
+}
+
+// Run purges expired accounts until ctx is cancelled.
+func (aps *AccountPurgeService) Run(ctx context.Context) {
+	ticker := time.NewTicker(accountPurgeInterval)
+	defer ticker.Stop()
+	for {
+		aps.PurgeExpired()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeExpired removes the accounts deleted longer than the grace period
+// ago, with their providers, sessions and tokens, in batches.
+func (aps *AccountPurgeService) PurgeExpired() {
+	before := time.Now().Add(-AccountDeletionGracePeriod)
+	for {
+		purged, err := aps.UserRepository.PurgeDeleted(before, accountPurgeBatchSize)
+		if err != nil {
+			log.Printf("account purge: failed to purge deleted users: %v", err)
+			return
+		}
+		if purged > 0 {
+			log.Printf("account purge: purged %d deleted users", purged)
+		}
+		if purged < accountPurgeBatchSize {
+			return
+		}
+	}
+}
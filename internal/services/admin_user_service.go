@@ -0,0 +1,413 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+)
+
+const defaultUserPageSize = 20
+
+var (
+	ErrInvalidCursor        = errors.New("invalid cursor")
+	ErrAccountNotManaged    = errors.New("account is not managed by the organization")
+	ErrCannotDisableSelf    = errors.New("cannot delete or disable your own account")
+	ErrStatusReasonRequired = errors.New("a reason is required")
+	ErrInvalidStatusExpiry  = errors.New("only suspensions can expire, and only in the future")
+)
+
+// userCursor is the position a page of users ends at. It records the sort
+// so a cursor cannot be replayed with another order.
+type userCursor struct {
+	Sort string `json:"s"`
+	repositories.UserCursor
+}
+
+// AdminUserService lets administrators find and manage user accounts.
+// Callers without organizations:manage only see the members of their
+// active organization and can only change the accounts it provisioned.
+type AdminUserService struct {
+	UserRepository         *repositories.UserRepository
+	RoleRepository         *repositories.RoleRepository
+	OrganizationRepository *repositories.OrganizationRepository
+	SessionService         *SessionService
+	MFAService             *MFAService
+	LoginHistoryService    *LoginHistoryService
+	AuditService           *AuditService
+}
+
+func NewAdminUserService(ur *repositories.UserRepository, rr *repositories.RoleRepository, or *repositories.OrganizationRepository, ss *SessionService, ms *MFAService, lhs *LoginHistoryService, as *AuditService) *AdminUserService {
+	return &AdminUserService{UserRepository: ur, RoleRepository: rr, OrganizationRepository: or, SessionService: ss, MFAService: ms, LoginHistoryService: lhs, AuditService: as}
+}
+
+// ListUsers returns a page of the users in scope matching the query, newest
+// first unless the query sorts otherwise.
+func (aus *AdminUserService) ListUsers(scope OrgScope, query models.ListUsersQuery) (*models.UserListResponse, error) {
+	filter := repositories.UserFilter{
+		Search:          strings.TrimSpace(query.Q),
+		Provider:        query.Provider,
+		Verified:        query.Verified,
+		Deleted:         query.Status == "deleted",
+		CreatedAfter:    query.CreatedAfter,
+		CreatedBefore:   query.CreatedBefore,
+		LastLoginAfter:  query.LastLoginAfter,
+		LastLoginBefore: query.LastLoginBefore,
+	}
+	if query.Status != "deleted" {
+		filter.Status = query.Status
+	}
+	if !scope.All {
+		if scope.OrganizationID == 0 {
+			return nil, ErrNoActiveOrganization
+		}
+		filter.OrganizationID = scope.OrganizationID
+	}
+	if query.Role != "" {
+		role, err := findRole(aus.RoleRepository, scope, query.Role)
+		if err != nil {
+			return nil, err
+		}
+		filter.Role = role
+	}
+
+	sort := query.Sort
+	if sort == "" {
+		sort = "-created_at"
+	}
+	filter.Descending = strings.HasPrefix(sort, "-")
+	filter.Sort = strings.TrimPrefix(sort, "-")
+	if filter.Sort == "created_at" {
+		filter.Sort = "id"
+	}
+	if query.Cursor != "" {
+		after, err := decodeUserCursor(query.Cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = after
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultUserPageSize
+	}
+	users, err := aus.UserRepository.List(filter, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	response := &models.UserListResponse{Users: make([]models.UserResponse, 0, limit)}
+	if len(users) > limit {
+		users = users[:limit]
+		last := users[limit-1]
+		cursor := repositories.UserCursor{ID: last.ID}
+		switch filter.Sort {
+		case "email":
+			cursor.Value = last.Email
+		case "name":
+			cursor.Value = last.Name
+		}
+		response.NextCursor = encodeUserCursor(sort, cursor)
+	}
+	for i := range users {
+		response.Users = append(response.Users, NewUserResponse(&users[i]))
+	}
+	return response, nil
+}
+
+// GetUser returns an account in scope with its linked providers. Like the
+// changes below, reading an account requires that the caller manages it.
+func (aus *AdminUserService) GetUser(scope OrgScope, userID uint) (*models.AdminUserResponse, error) {
+	user, err := aus.UserRepository.GetByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if err := aus.ensureManaged(scope, userID); err != nil {
+		return nil, err
+	}
+	providers, err := aus.UserRepository.ListAuthProviders(userID)
+	if err != nil {
+		return nil, err
+	}
+	response := models.AdminUserResponse{UserResponse: NewUserResponse(user), Providers: make([]string, 0, len(providers))}
+	if response.Status != models.UserStatusActive {
+		response.StatusReason = user.StatusReason
+		response.StatusChangedBy = user.StatusChangedBy
+		response.StatusChangedAt = user.StatusChangedAt
+		response.StatusExpiresAt = user.StatusExpiresAt
+	}
+	for _, provider := range providers {
+		response.Providers = append(response.Providers, provider.Provider)
+	}
+	return &response, nil
+}
+
+// LoginHistory returns a page of the sign-in attempts on a managed account.
+// Deleted accounts keep their history until they are purged.
+func (aus *AdminUserService) LoginHistory(scope OrgScope, userID uint, query models.LoginHistoryQuery) (*models.LoginHistoryResponse, error) {
+	if _, err := aus.UserRepository.GetByIDWithDeleted(userID); err != nil {
+		return nil, ErrUserNotFound
+	}
+	if err := aus.ensureManaged(scope, userID); err != nil {
+		return nil, err
+	}
+	return aus.LoginHistoryService.ListAttempts(userID, query)
+}
+
+// ResetMFA removes every second factor of a managed account, for a user who
+// lost their authenticator and recovery codes.
+func (aus *AdminUserService) ResetMFA(scope OrgScope, info RequestInfo, userID uint) error {
+	user, err := aus.UserRepository.GetByID(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if err := aus.ensureManaged(scope, userID); err != nil {
+		return err
+	}
+	if err := aus.MFAService.ResetMFA(userID); err != nil {
+		return err
+	}
+	aus.AuditService.Record(info, models.AuditMFAReset, models.AuditTargetUser, userID, map[string]models.AuditChange{
+		"mfa_enabled": {From: user.MFAEnabled, To: false},
+	})
+	return nil
+}
+
+// UpdateUser changes the account fields set in input. Changing the email
+// marks it unverified unless input says otherwise.
+func (aus *AdminUserService) UpdateUser(scope OrgScope, info RequestInfo, userID uint, input models.AdminUpdateUserInput) (*models.AdminUserResponse, error) {
+	user, err := aus.UserRepository.GetByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if err := aus.ensureManaged(scope, userID); err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	if input.Name != nil {
+		values["name"] = *input.Name
+	}
+	if input.Locale != nil {
+		values["locale"] = *input.Locale
+	}
+	if input.Timezone != nil {
+		values["timezone"] = *input.Timezone
+	}
+	if input.Email != nil && !strings.EqualFold(*input.Email, user.Email) {
+		if err := aus.UserRepository.CheckEmailExist(&models.User{Email: *input.Email}); err != nil {
+			return nil, ErrEmailTaken
+		}
+		values["email"] = *input.Email
+		values["email_verified_at"] = nil
+	}
+	if input.EmailVerified != nil {
+		if !*input.EmailVerified {
+			values["email_verified_at"] = nil
+		} else if user.EmailVerifiedAt == nil || values["email"] != nil {
+			values["email_verified_at"] = time.Now()
+		}
+	}
+	if len(values) > 0 {
+		if err := aus.UserRepository.UpdateColumns(userID, values); err != nil {
+			return nil, err
+		}
+		aus.recordChanges(info, models.AuditUserUpdated, user)
+	}
+	return aus.GetUser(scope, userID)
+}
+
+// DeleteUser soft-deletes an account and signs it out everywhere. The
+// account can be restored until AccountDeletionGracePeriod has passed. The
+// last admin and the last owner of an organization cannot be deleted.
+func (aus *AdminUserService) DeleteUser(scope OrgScope, info RequestInfo, userID uint) error {
+	if info.UserID == userID {
+		return ErrCannotDisableSelf
+	}
+	user, err := aus.UserRepository.GetByID(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if err := aus.ensureManaged(scope, userID); err != nil {
+		return err
+	}
+	if user.CurrentStatus() == models.UserStatusActive {
+		if err := ensureNotLastAdminOrOwner(aus.RoleRepository, aus.OrganizationRepository, user); err != nil {
+			return err
+		}
+	}
+	if err := aus.UserRepository.Delete(user); err != nil {
+		return err
+	}
+	aus.AuditService.Record(info, models.AuditUserDeleted, models.AuditTargetUser, userID, nil)
+	return aus.SessionService.RevokeAllSessions(userID, "")
+}
+
+// RestoreUser undoes the deletion of an account that has not been purged
+// yet. It fails when the account's email has been registered again since.
+func (aus *AdminUserService) RestoreUser(scope OrgScope, info RequestInfo, userID uint) (*models.AdminUserResponse, error) {
+	user, err := aus.UserRepository.GetDeletedByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if err := aus.ensureManaged(scope, userID); err != nil {
+		return nil, err
+	}
+	if user.ErasedAt != nil || time.Since(user.DeletedAt.Time) > AccountDeletionGracePeriod {
+		return nil, ErrRestoreWindowExpired
+	}
+	if err := aus.UserRepository.CheckEmailExist(user); err != nil {
+		return nil, ErrEmailTaken
+	}
+	if err := aus.UserRepository.Restore(userID); err != nil {
+		return nil, err
+	}
+	aus.AuditService.Record(info, models.AuditUserRestored, models.AuditTargetUser, userID, nil)
+	return aus.GetUser(scope, userID)
+}
+
+// EraseUser anonymizes an account for good to answer an erasure request.
+// It also works on deleted accounts that have not been purged yet. Unlike a
+// purge, the account row is kept so records that refer to it stay valid.
+func (aus *AdminUserService) EraseUser(scope OrgScope, info RequestInfo, userID uint) error {
+	if info.UserID == userID {
+		return ErrCannotDisableSelf
+	}
+	user, err := aus.UserRepository.GetByIDWithDeleted(userID)
+	if err != nil || user.ErasedAt != nil {
+		return ErrUserNotFound
+	}
+	if err := aus.ensureManaged(scope, userID); err != nil {
+		return err
+	}
+	if !user.DeletedAt.Valid && user.CurrentStatus() == models.UserStatusActive {
+		if err := ensureNotLastAdminOrOwner(aus.RoleRepository, aus.OrganizationRepository, user); err != nil {
+			return err
+		}
+	}
+	if err := aus.UserRepository.Erase(user); err != nil {
+		return err
+	}
+	aus.AuditService.Record(info, models.AuditUserErased, models.AuditTargetUser, userID, nil)
+	return nil
+}
+
+// SetStatus changes an account's status. Any status but active signs the
+// account out everywhere and keeps it from signing in until an
+// administrator reinstates it or the suspension expires.
+func (aus *AdminUserService) SetStatus(scope OrgScope, info RequestInfo, userID uint, input models.SetUserStatusInput) (*models.AdminUserResponse, error) {
+	if info.UserID == userID {
+		return nil, ErrCannotDisableSelf
+	}
+	user, err := aus.UserRepository.GetByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if err := aus.ensureManaged(scope, userID); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	values := map[string]interface{}{
+		"status":            input.Status,
+		"status_reason":     "",
+		"status_changed_by": info.UserID,
+		"status_changed_at": now,
+		"status_expires_at": nil,
+	}
+	if input.Status != models.UserStatusActive {
+		reason := strings.TrimSpace(input.Reason)
+		if reason == "" {
+			return nil, ErrStatusReasonRequired
+		}
+		if input.ExpiresAt != nil && (input.Status != models.UserStatusSuspended || !input.ExpiresAt.After(now)) {
+			return nil, ErrInvalidStatusExpiry
+		}
+		if user.CurrentStatus() == models.UserStatusActive {
+			if err := ensureNotLastAdminOrOwner(aus.RoleRepository, aus.OrganizationRepository, user); err != nil {
+				return nil, err
+			}
+		}
+		values["status_reason"] = reason
+		values["status_expires_at"] = input.ExpiresAt
+	}
+	if err := aus.UserRepository.UpdateColumns(userID, values); err != nil {
+		return nil, err
+	}
+	aus.recordChanges(info, models.AuditUserStatusChanged, user)
+	if input.Status != models.UserStatusActive {
+		if err := aus.SessionService.RevokeAllSessions(userID, ""); err != nil {
+			return nil, err
+		}
+	}
+	return aus.GetUser(scope, userID)
+}
+
+// recordChanges audits an update of the account, logging the fields that
+// differ between before and the stored account.
+func (aus *AdminUserService) recordChanges(info RequestInfo, action string, before *models.User) {
+	after, err := aus.UserRepository.GetByID(before.ID)
+	if err != nil {
+		log.Printf("audit: failed to reload user %d for %s: %v", before.ID, action, err)
+		return
+	}
+	aus.AuditService.Record(info, action, models.AuditTargetUser, before.ID, auditDiff(auditUserFields(before), auditUserFields(after)))
+}
+
+// ensureNotLastAdminOrOwner fails when taking the account away would leave
+// no active admin, or an organization without an active owner.
+func ensureNotLastAdminOrOwner(rr *repositories.RoleRepository, or *repositories.OrganizationRepository, user *models.User) error {
+	for _, role := range user.Roles {
+		if role.Name == models.AdminRole {
+			if err := ensureNotLastHolder(rr, &role, ErrLastAdmin); err != nil {
+				return err
+			}
+		}
+	}
+	memberships, err := or.ListMemberships(user.ID)
+	if err != nil {
+		return err
+	}
+	for _, membership := range memberships {
+		for _, role := range membership.Roles {
+			if role.System && role.Name == models.OrgOwnerRole {
+				if err := ensureNotLastHolder(rr, &role, ErrLastOwner); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ensureManaged fails unless the caller manages all organizations or the
+// account was provisioned by the caller's active organization.
+func (aus *AdminUserService) ensureManaged(scope OrgScope, userID uint) error {
+	if scope.All {
+		return nil
+	}
+	membership, err := aus.OrganizationRepository.GetMembership(scope.OrganizationID, userID)
+	if err != nil || !membership.Provisioned {
+		return ErrAccountNotManaged
+	}
+	return nil
+}
+
+func encodeUserCursor(sort string, cursor repositories.UserCursor) string {
+	data, _ := json.Marshal(userCursor{Sort: sort, UserCursor: cursor})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeUserCursor(value, sort string) (*repositories.UserCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor userCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != sort || cursor.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor.UserCursor, nil
+}
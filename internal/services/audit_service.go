@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"strconv"
+	"time"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+)
+
+const (
+	defaultAuditPageSize = 50
+	auditVerifyBatchSize = 500
+	auditChainBatchSize  = 200
+	// auditChainInterval is how often events recorded with RecordLater are
+	// chained into the log.
+	auditChainInterval = time.Second
+)
+
+var errAuditChainBroken = errors.New("audit chain broken")
+
+// RequestInfo identifies who made a request and from where. UserID and
+// OrganizationID are zero for anonymous requests.
+type RequestInfo struct {
+	UserID         uint
+	OrganizationID uint
+	IP             string
+	UserAgent      string
+	RequestID      string
+}
+
+// AuditService records security-relevant actions in the audit log and lets
+// administrators search and verify it.
+type AuditService struct {
+	AuditRepository *repositories.AuditRepository
+}
+
+func NewAuditService(ar *repositories.AuditRepository) *AuditService {
+	return &AuditService{AuditRepository: ar}
+}
+
+// Record appends an event for an action taken by info's user on the target.
+// changes is stored as JSON; it holds the before/after values of the fields
+// the action changed, or the details of a failed attempt. Like a failed
+// notification email, a failure to record is logged rather than failing an
+// action that has already happened.
+func (as *AuditService) Record(info RequestInfo, action, targetType string, targetID uint, changes interface{}) {
+	event := models.AuditEvent{
+		ActorID:        optionalID(info.UserID),
+		OrganizationID: optionalID(info.OrganizationID),
+		Action:         action,
+		TargetType:     targetType,
+		TargetID:       optionalID(targetID),
+		IP:             info.IP,
+		UserAgent:      info.UserAgent,
+		RequestID:      info.RequestID,
+		Changes:        encodeAuditChanges(action, changes),
+	}
+	if err := as.AuditRepository.Append(&event); err != nil {
+		log.Printf("audit: failed to record %s: %v", action, err)
+	}
+}
+
+// RecordLater is Record for actions too frequent to each take the lock on
+// the chain head, such as logins. The event is stored right away and
+// chained into the log with others by Run shortly after.
+func (as *AuditService) RecordLater(info RequestInfo, action, targetType string, targetID uint, changes interface{}) {
+	event := models.PendingAuditEvent{
+		ActorID:        optionalID(info.UserID),
+		OrganizationID: optionalID(info.OrganizationID),
+		Action:         action,
+		TargetType:     targetType,
+		TargetID:       optionalID(targetID),
+		IP:             info.IP,
+		UserAgent:      info.UserAgent,
+		RequestID:      info.RequestID,
+		Changes:        encodeAuditChanges(action, changes),
+	}
+	if err := as.AuditRepository.Enqueue(&event); err != nil {
+		log.Printf("audit: failed to record %s: %v", action, err)
+	}
+}
+
+func encodeAuditChanges(action string, changes interface{}) json.RawMessage {
+	if changes == nil {
+		return nil
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		log.Printf("audit: failed to encode changes of %s: %v", action, err)
+	}
+	return data
+}
+
+// Run chains the events recorded with RecordLater every auditChainInterval
+// until the context is cancelled.
+func (as *AuditService) Run(ctx context.Context) {
+	ticker := time.NewTicker(auditChainInterval)
+	defer ticker.Stop()
+	for {
+		as.ChainPending()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ChainPending appends every event waiting to be chained to the log.
+func (as *AuditService) ChainPending() {
+	for {
+		count, err := as.AuditRepository.ChainPending(auditChainBatchSize)
+		if err != nil {
+			log.Printf("audit: failed to chain pending events: %v", err)
+			return
+		}
+		if count < auditChainBatchSize {
+			return
+		}
+	}
+}
+
+// ListEvents returns a page of the events matching the query, newest first.
+// Callers without organizations:manage only see the events recorded while
+// their active organization was active.
+func (as *AuditService) ListEvents(scope OrgScope, query models.ListAuditEventsQuery) (*models.AuditEventListResponse, error) {
+	filter := repositories.AuditFilter{
+		ActorID:    query.ActorID,
+		Action:     query.Action,
+		TargetType: query.TargetType,
+		TargetID:   query.TargetID,
+		RequestID:  query.RequestID,
+		From:       query.From,
+		To:         query.To,
+	}
+	if !scope.All {
+		if scope.OrganizationID == 0 {
+			return nil, ErrNoActiveOrganization
+		}
+		filter.OrganizationID = scope.OrganizationID
+	}
+	if query.Cursor != "" {
+		before, err := decodeIDCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.BeforeID = before
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultAuditPageSize
+	}
+	events, err := as.AuditRepository.List(filter, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	response := &models.AuditEventListResponse{Events: make([]models.AuditEventResponse, 0, limit)}
+	if len(events) > limit {
+		events = events[:limit]
+		response.NextCursor = encodeIDCursor(events[limit-1].ID)
+	}
+	for _, event := range events {
+		response.Events = append(response.Events, models.AuditEventResponse{
+			ID:             event.ID,
+			CreatedAt:      event.CreatedAt,
+			ActorID:        event.ActorID,
+			OrganizationID: event.OrganizationID,
+			Action:         event.Action,
+			TargetType:     event.TargetType,
+			TargetID:       event.TargetID,
+			IP:             event.IP,
+			UserAgent:      event.UserAgent,
+			RequestID:      event.RequestID,
+			Changes:        event.Changes,
+			Hash:           event.Hash,
+			Redacted:       event.RedactedAt != nil,
+		})
+	}
+	return response, nil
+}
+
+// Verify walks the whole log and checks that every event links to the one
+// before it, that its hash matches its content, and that the newest event
+// is still there. Redacted events must have their personal fields cleared.
+func (as *AuditService) Verify() (*models.AuditVerifyResponse, error) {
+	head, err := as.AuditRepository.Head()
+	if err != nil {
+		return nil, err
+	}
+	response := &models.AuditVerifyResponse{Valid: true}
+	prevHash := ""
+	headFound := head == ""
+	err = as.AuditRepository.Walk(auditVerifyBatchSize, func(events []models.AuditEvent) error {
+		for i := range events {
+			event := &events[i]
+			if !auditEventIntact(event, prevHash) {
+				id := event.ID
+				response.BrokenAt = &id
+				return errAuditChainBroken
+			}
+			response.Checked++
+			prevHash = event.Hash
+			if event.Hash == head {
+				headFound = true
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errAuditChainBroken) {
+		response.Valid = false
+		return response, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	response.Valid = headFound
+	return response, nil
+}
+
+// auditEventIntact reports whether an event links to the hash of the one
+// before it and still matches its own hash.
+func auditEventIntact(event *models.AuditEvent, prevHash string) bool {
+	return event.PrevHash == prevHash && event.Hash == event.ComputeHash() && piiIntact(event)
+}
+
+// piiIntact reports whether the personal fields of an event still match its
+// digest, or have been cleared by a redaction.
+func piiIntact(event *models.AuditEvent) bool {
+	if event.RedactedAt != nil {
+		return event.IP == "" && event.UserAgent == "" && len(event.Changes) == 0
+	}
+	return event.PIIDigest == event.ComputePIIDigest()
+}
+
+// auditDiff returns the fields whose value differs between before and
+// after.
+func auditDiff(before, after map[string]interface{}) map[string]models.AuditChange {
+	changes := map[string]models.AuditChange{}
+	for field, value := range after {
+		if !reflect.DeepEqual(before[field], value) {
+			changes[field] = models.AuditChange{From: before[field], To: value}
+		}
+	}
+	return changes
+}
+
+// auditUserFields returns the account fields administrators can change, in
+// the form they are compared and logged in.
+func auditUserFields(user *models.User) map[string]interface{} {
+	fields := map[string]interface{}{
+		"name":              user.Name,
+		"email":             user.Email,
+		"locale":            user.Locale,
+		"timezone":          user.Timezone,
+		"email_verified":    user.EmailVerifiedAt != nil,
+		"status":            user.CurrentStatus(),
+		"status_reason":     user.StatusReason,
+		"status_expires_at": nil,
+	}
+	if user.StatusExpiresAt != nil && user.CurrentStatus() != models.UserStatusActive {
+		fields["status_expires_at"] = user.StatusExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return fields
+}
+
+func optionalID(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+// encodeIDCursor encodes the ID of the last item of a page of a listing
+// ordered by descending ID.
+func encodeIDCursor(id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(id), 10)))
+}
+
+func decodeIDCursor(value string) (uint, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseUint(string(data), 10, 64)
+	if err != nil || id == 0 {
+		return 0, ErrInvalidCursor
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	"user-service/internal/models"
+)
+
+// auditChain links events the way the repository chains them.
+func auditChain(events []models.AuditEvent) []models.AuditEvent {
+	prevHash := ""
+	for i := range events {
+		events[i].PIIDigest = events[i].ComputePIIDigest()
+		events[i].PrevHash = prevHash
+		events[i].Hash = events[i].ComputeHash()
+		prevHash = events[i].Hash
+	}
+	return events
+}
+
+func TestAuditEventIntact(t *testing.T) {
+	created := time.UnixMilli(1700000000000)
+	redacted := created.Add(time.Hour)
+	tests := []struct {
+		name   string
+		tamper func(events []models.AuditEvent)
+		// broken is the index of the first event that must fail, or -1.
+		broken int
+	}{
+		{"untouched", func([]models.AuditEvent) {}, -1},
+		{"action changed", func(e []models.AuditEvent) { e[1].Action = models.AuditRoleDeleted }, 1},
+		{"actor changed", func(e []models.AuditEvent) { e[0].ActorID = nil }, 0},
+		{"timestamp changed", func(e []models.AuditEvent) { e[2].CreatedAt = e[2].CreatedAt.Add(time.Second) }, 2},
+		{"IP changed", func(e []models.AuditEvent) { e[1].IP = "10.0.0.1" }, 1},
+		{"changes edited", func(e []models.AuditEvent) { e[0].Changes = json.RawMessage(`{"email":{"to":"x@example.com"}}`) }, 0},
+		{"hash recomputed", func(e []models.AuditEvent) {
+			e[1].Action = models.AuditRoleDeleted
+			e[1].Hash = e[1].ComputeHash()
+		}, 2},
+		{"event removed", func(e []models.AuditEvent) { copy(e[1:], e[2:]); e[2] = e[1] }, 1},
+		{"redacted", func(e []models.AuditEvent) {
+			e[1].IP, e[1].UserAgent, e[1].Changes, e[1].RedactedAt = "", "", nil, &redacted
+		}, -1},
+		{"redacted but IP kept", func(e []models.AuditEvent) {
+			e[1].UserAgent, e[1].Changes, e[1].RedactedAt = "", nil, &redacted
+		}, 1},
+	}
+	for _, tt := range tests {
+		actorID := uint(1)
+		events := auditChain([]models.AuditEvent{
+			{CreatedAt: created, ActorID: &actorID, Action: models.AuditRegister, TargetType: models.AuditTargetUser, TargetID: optionalID(1), IP: "192.0.2.1", UserAgent: "test", Changes: json.RawMessage(`{"email":{"to":"a@example.com"}}`)},
+			{CreatedAt: created.Add(time.Minute), ActorID: &actorID, Action: models.AuditRoleCreated, TargetType: models.AuditTargetRole, TargetID: optionalID(2), IP: "192.0.2.1", UserAgent: "test", Changes: json.RawMessage(`{"name":{"to":"editor"}}`)},
+			{CreatedAt: created.Add(2 * time.Minute), ActorID: &actorID, Action: models.AuditRoleUpdated, TargetType: models.AuditTargetRole, TargetID: optionalID(2), IP: "192.0.2.1", UserAgent: "test"},
+		})
+		tt.tamper(events)
+		broken := -1
+		prevHash := ""
+		for i := range events {
+			if !auditEventIntact(&events[i], prevHash) {
+				broken = i
+				break
+			}
+			prevHash = events[i].Hash
+		}
+		if broken != tt.broken {
+			t.Errorf("%s: chain broken at %d, want %d", tt.name, broken, tt.broken)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"user-service/config"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+	"user-service/utils"
+)
+
+const (
+	dataExportPollInterval = time.Second * 30
+	dataExportBatchSize    = 5
+	// dataExportLease is how long a claimed export is hidden from other
+	// workers while it is being built.
+	dataExportLease = time.Minute * 10
+	// dataExportTTL is how long a finished export can be downloaded.
+	dataExportTTL = time.Hour * 48
+)
+
+var (
+	ErrExportNotFound   = errors.New("export not found")
+	ErrExportInProgress = errors.New("an export is already being prepared")
+	ErrExportNotReady   = errors.New("export is not ready")
+)
+
+// DataExportService answers data subject access requests: it builds an
+// archive of everything stored about a user in the background and hands it
+// out through a signed link that expires with the archive.
+type DataExportService struct {
+	DataExportRepository   *repositories.DataExportRepository
+	UserRepository         *repositories.UserRepository
+	OrganizationRepository *repositories.OrganizationRepository
+	WebAuthnRepository     *repositories.WebAuthnRepository
+	OutboxService          *OutboxService
+}
+
+func NewDataExportService(dr *repositories.DataExportRepository, ur *repositories.UserRepository, or *repositories.OrganizationRepository, wr *repositories.WebAuthnRepository, obs *OutboxService) *DataExportService {
+	return &DataExportService{DataExportRepository: dr, UserRepository: ur, OrganizationRepository: or, WebAuthnRepository: wr, OutboxService: obs}
+}
+
+// RequestExport queues an export of the user's data. Only one export can be
+// in preparation at a time.
+func (des *DataExportService) RequestExport(userID uint, format string) (*models.DataExportResponse, error) {
+	if format == "" {
+		format = models.DataExportFormatJSON
+	}
+	pending, err := des.DataExportRepository.HasPending(userID)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, ErrExportInProgress
+	}
+	export := models.DataExport{UserID: userID, Format: format, Status: models.DataExportPending}
+	if err := des.DataExportRepository.Create(&export); err != nil {
+		return nil, err
+	}
+	return des.newResponse(&export, nil)
+}
+
+// GetExport returns the state of one of the user's exports, with a fresh
+// download link once it is ready.
+func (des *DataExportService) GetExport(userID, id uint) (*models.DataExportResponse, error) {
+	export, err := des.DataExportRepository.GetByID(userID, id)
+	if err != nil || exportExpired(export) {
+		return nil, ErrExportNotFound
+	}
+	user, err := des.UserRepository.GetByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	return des.newResponse(export, user)
+}
+
+// Download checks a signed download link and returns the export it points
+// to. The link stops working when the export expires or the account's email
+// changes.
+func (des *DataExportService) Download(id uint, token string) (*models.DataExport, error) {
+	claims, err := utils.ParseActionToken(token, utils.DataExportPurpose)
+	if err != nil {
+		return nil, err
+	}
+	user, err := des.UserRepository.GetByID(claims.UserID)
+	if err != nil || !strings.EqualFold(user.Email, claims.Email) {
+		return nil, utils.ErrInvalidActionToken
+	}
+	export, err := des.DataExportRepository.GetWithData(id)
+	if err != nil || export.UserID != user.ID || exportExpired(export) {
+		return nil, ErrExportNotFound
+	}
+	if export.Status != models.DataExportReady {
+		return nil, ErrExportNotReady
+	}
+	return export, nil
+}
+
+// Run builds pending exports and removes expired ones until ctx is
+// cancelled.
+func (des *DataExportService) Run(ctx context.Context) {
+	ticker := time.NewTicker(dataExportPollInterval)
+	defer ticker.Stop()
+	for {
+		des.ProcessPending()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessPending builds one batch of pending exports, emails their owners
+// the download link, and removes expired exports.
+func (des *DataExportService) ProcessPending() {
+	if err := des.DataExportRepository.DeleteExpired(); err != nil {
+		log.Printf("data export: failed to remove expired exports: %v", err)
+	}
+	exports, err := des.DataExportRepository.ClaimPending(dataExportBatchSize, dataExportLease)
+	if err != nil {
+		log.Printf("data export: failed to load pending exports: %v", err)
+		return
+	}
+	for i := range exports {
+		if err := des.build(&exports[i]); err != nil {
+			log.Printf("data export: export %d failed: %v", exports[i].ID, err)
+			if err := des.DataExportRepository.MarkFailed(exports[i].ID); err != nil {
+				log.Printf("data export: failed to mark export %d as failed: %v", exports[i].ID, err)
+			}
+		}
+	}
+}
+
+func (des *DataExportService) build(export *models.DataExport) error {
+	user, err := des.UserRepository.GetByID(export.UserID)
+	if err != nil {
+		return err
+	}
+	archive, err := des.collect(user)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if export.Format == models.DataExportFormatZIP {
+		data, err = zipArchive(archive)
+	} else {
+		data, err = json.MarshalIndent(archive, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(dataExportTTL)
+	if err := des.DataExportRepository.MarkReady(export.ID, data, expiresAt); err != nil {
+		return err
+	}
+	export.Status = models.DataExportReady
+	export.ExpiresAt = &expiresAt
+	response, err := des.newResponse(export, user)
+	if err != nil {
+		return err
+	}
+	return des.OutboxService.Enqueue(user.Email, "data_export_ready", user.Locale, map[string]interface{}{
+		"Name":           user.Name,
+		"Link":           response.DownloadURL,
+		"ExpiresInHours": int(dataExportTTL.Hours()),
+	})
+}
+
+// collect gathers everything stored about the user.
+func (des *DataExportService) collect(user *models.User) (*models.DataExportArchive, error) {
+	archive := &models.DataExportArchive{
+		ExportedAt:          time.Now(),
+		Profile:             NewUserResponse(user),
+		AuthProviders:       []models.ExportedAuthProvider{},
+		Sessions:            []models.ExportedSession{},
+		Organizations:       []models.ExportedMembership{},
+		WebAuthnCredentials: []models.WebAuthnCredentialResponse{},
+		Invitations:         []models.ExportedInvitation{},
+		LoginHistory:        []models.LoginAttemptResponse{},
+		AuditEvents:         []models.ExportedAuditEvent{},
+	}
+	providers, err := des.UserRepository.ListAuthProviders(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, provider := range providers {
+		archive.AuthProviders = append(archive.AuthProviders, models.ExportedAuthProvider{
+			Provider:   provider.Provider,
+			ProviderID: provider.ProviderID,
+			Email:      provider.Email,
+			LinkedAt:   provider.CreatedAt,
+		})
+	}
+	sessions, err := des.DataExportRepository.ListSessions(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		archive.Sessions = append(archive.Sessions, models.ExportedSession{
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			RevokedAt:  session.RevokedAt,
+		})
+	}
+	memberships, err := des.OrganizationRepository.ListMemberships(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, membership := range memberships {
+		archive.Organizations = append(archive.Organizations, models.ExportedMembership{
+			OrganizationID:   membership.OrganizationID,
+			OrganizationName: membership.Organization.Name,
+			Roles:            roleNames(membership.Roles),
+			ExternalID:       membership.ExternalID,
+			Provisioned:      membership.Provisioned,
+			JoinedAt:         membership.CreatedAt,
+		})
+	}
+	credentials, err := des.WebAuthnRepository.ListCredentialsByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range credentials {
+		archive.WebAuthnCredentials = append(archive.WebAuthnCredentials, toWebAuthnCredentialResponse(&credentials[i]))
+	}
+	invitations, err := des.DataExportRepository.ListInvitations(user.ID, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	for _, invitation := range invitations {
+		archive.Invitations = append(archive.Invitations, models.ExportedInvitation{
+			OrganizationID: invitation.OrganizationID,
+			Email:          invitation.Email,
+			CreatedAt:      invitation.CreatedAt,
+			AcceptedAt:     invitation.AcceptedAt,
+			RevokedAt:      invitation.RevokedAt,
+		})
+	}
+	attempts, err := des.DataExportRepository.ListLoginAttempts(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, attempt := range attempts {
+		archive.LoginHistory = append(archive.LoginHistory, newLoginAttemptResponse(&attempt))
+	}
+	events, err := des.DataExportRepository.ListAuditEvents(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range events {
+		archive.AuditEvents = append(archive.AuditEvents, newExportedAuditEvent(&events[i], user.ID))
+	}
+	return archive, nil
+}
+
+func newExportedAuditEvent(event *models.AuditEvent, userID uint) models.ExportedAuditEvent {
+	exported := models.ExportedAuditEvent{
+		CreatedAt:   event.CreatedAt,
+		Action:      event.Action,
+		ActedBySelf: event.ActorID != nil && *event.ActorID == userID,
+		AboutSelf:   event.TargetType == models.AuditTargetUser && event.TargetID != nil && *event.TargetID == userID,
+	}
+	if exported.ActedBySelf {
+		exported.IP, exported.UserAgent = event.IP, event.UserAgent
+	}
+	if exported.AboutSelf {
+		exported.Changes = event.Changes
+	}
+	return exported
+}
+
+// zipArchive writes each section of the archive to its own JSON file.
+func zipArchive(archive *models.DataExportArchive) ([]byte, error) {
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", archive.Profile},
+		{"auth_providers.json", archive.AuthProviders},
+		{"sessions.json", archive.Sessions},
+		{"organizations.json", archive.Organizations},
+		{"webauthn_credentials.json", archive.WebAuthnCredentials},
+		{"invitations.json", archive.Invitations},
+		{"login_history.json", archive.LoginHistory},
+		{"audit_events.json", archive.AuditEvents},
+	}
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, file := range files {
+		content, err := json.MarshalIndent(file.content, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		w, err := writer.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: archive.ExportedAt})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// newResponse describes an export. The download link of a ready export is
+// signed for the user and lasts as long as the export.
+func (des *DataExportService) newResponse(export *models.DataExport, user *models.User) (*models.DataExportResponse, error) {
+	response := &models.DataExportResponse{
+		ID:          export.ID,
+		Format:      export.Format,
+		Status:      export.Status,
+		CreatedAt:   export.CreatedAt,
+		CompletedAt: export.CompletedAt,
+		ExpiresAt:   export.ExpiresAt,
+	}
+	if export.Status == models.DataExportReady && user != nil {
+		token, err := utils.GenerateActionToken(utils.DataExportPurpose, user.ID, user.Email, time.Until(*export.ExpiresAt))
+		if err != nil {
+			return nil, err
+		}
+		base := strings.TrimSuffix(config.AppConfig.OIDCIssuer, "/")
+		if base == "" {
+			base = "http://localhost:8080"
+		}
+		response.DownloadURL = tokenLink(fmt.Sprintf("%s/exports/%d/download", base, export.ID), "", token)
+	}
+	return response, nil
+}
+
+func exportExpired(export *models.DataExport) bool {
+	return export.ExpiresAt != nil && !time.Now().Before(*export.ExpiresAt)
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"user-service/config"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+	"user-service/utils"
+)
+
+const (
+	emailChangeExpiry = time.Hour * 24
+	// emailChangeCancelWindow is how long the link sent to the old address
+	// can stop or roll back the change.
+	emailChangeCancelWindow = time.Hour * 24 * 7
+)
+
+var (
+	ErrInvalidEmailChangeToken = errors.New("invalid or expired email change token")
+	ErrSameEmail               = errors.New("new email is the same as the current one")
+	ErrEmailTaken              = errors.New("email already exists")
+)
+
+type EmailChangeService struct {
+	UserRepository        *repositories.UserRepository
+	EmailChangeRepository *repositories.EmailChangeRepository
+	SessionService        *SessionService
+	OutboxService         *OutboxService
+	AuditService          *AuditService
+}
+
+func NewEmailChangeService(ur *repositories.UserRepository, er *repositories.EmailChangeRepository, ss *SessionService, obs *OutboxService, as *AuditService) *EmailChangeService {
+	return &EmailChangeService{UserRepository: ur, EmailChangeRepository: er, SessionService: ss, OutboxService: obs, AuditService: as}
+}
+
+// RequestEmailChange starts changing the user's email once they confirm it
+// with their password, or their current email when the account has no
+// password. The address is only switched once the link sent to newEmail is
+// opened; the current address is notified and gets a link to cancel.
+func (ecs *EmailChangeService) RequestEmailChange(userID uint, input models.ChangeEmailInput) error {
+	user, err := ecs.UserRepository.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := confirmIdentity(user, input.Password, input.Email); err != nil {
+		return err
+	}
+	newEmail := input.NewEmail
+	if strings.EqualFold(user.Email, newEmail) {
+		return ErrSameEmail
+	}
+	if err := ecs.UserRepository.CheckEmailExist(&models.User{Email: newEmail}); err != nil {
+		return ErrEmailTaken
+	}
+
+	confirmToken, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return err
+	}
+	cancelToken, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return err
+	}
+	request := models.EmailChangeRequest{
+		UserID:           user.ID,
+		OldEmail:         user.Email,
+		NewEmail:         newEmail,
+		ConfirmTokenHash: utils.HashToken(confirmToken),
+		CancelTokenHash:  utils.HashToken(cancelToken),
+		ExpiresAt:        time.Now().Add(emailChangeExpiry),
+	}
+	if err := ecs.EmailChangeRepository.Create(&request); err != nil {
+		return err
+	}
+
+	if err := ecs.OutboxService.Enqueue(newEmail, "email_change_confirm", user.Locale, map[string]interface{}{
+		"Name":           user.Name,
+		"NewEmail":       newEmail,
+		"Link":           tokenLink(config.AppConfig.EmailChangeConfirmURL, "http://localhost:8080/email/change/confirm", confirmToken),
+		"ExpiresInHours": int(emailChangeExpiry.Hours()),
+	}); err != nil {
+		return err
+	}
+	return ecs.OutboxService.Enqueue(user.Email, "email_change_notice", user.Locale, map[string]interface{}{
+		"Name":         user.Name,
+		"NewEmail":     newEmail,
+		"CancelLink":   tokenLink(config.AppConfig.EmailChangeCancelURL, "http://localhost:8080/email/change/cancel", cancelToken),
+		"CancelInDays": int(emailChangeCancelWindow.Hours() / 24),
+	})
+}
+
+// ConfirmEmailChange switches the user to the new address. Availability is
+// checked again because the address may have been registered since the
+// request was made.
+func (ecs *EmailChangeService) ConfirmEmailChange(token string, info RequestInfo) error {
+	request, err := ecs.EmailChangeRepository.GetByConfirmHash(utils.HashToken(token))
+	if err != nil || request.ConfirmedAt != nil || request.CancelledAt != nil || time.Now().After(request.ExpiresAt) {
+		return ErrInvalidEmailChangeToken
+	}
+	if err := ecs.UserRepository.CheckEmailExist(&models.User{Email: request.NewEmail}); err != nil {
+		return ErrEmailTaken
+	}
+	ok, err := ecs.EmailChangeRepository.Confirm(request)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidEmailChangeToken
+	}
+	info.UserID = request.UserID
+	ecs.AuditService.Record(info, models.AuditEmailChanged, models.AuditTargetUser, request.UserID, map[string]models.AuditChange{
+		"email": {From: request.OldEmail, To: request.NewEmail},
+	})
+	return nil
+}
+
+// CancelEmailChange stops a pending change, or rolls back a confirmed one.
+// A rolled back change may have been made by someone who knew the password,
+// so every session of the user is revoked as well.
+func (ecs *EmailChangeService) CancelEmailChange(token string, info RequestInfo) error {
+	request, err := ecs.EmailChangeRepository.GetByCancelHash(utils.HashToken(token))
+	if err != nil || request.CancelledAt != nil || time.Since(request.CreatedAt) > emailChangeCancelWindow {
+		return ErrInvalidEmailChangeToken
+	}
+	if request.ConfirmedAt != nil {
+		if err := ecs.UserRepository.CheckEmailExist(&models.User{Email: request.OldEmail}); err != nil {
+			return ErrEmailTaken
+		}
+	}
+	ok, err := ecs.EmailChangeRepository.Cancel(request)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidEmailChangeToken
+	}
+	if request.ConfirmedAt != nil {
+		info.UserID = request.UserID
+		ecs.AuditService.Record(info, models.AuditEmailChangeUndone, models.AuditTargetUser, request.UserID, map[string]models.AuditChange{
+			"email": {From: request.NewEmail, To: request.OldEmail},
+		})
+		return ecs.SessionService.RevokeAllSessions(request.UserID, "")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"time"
+	"user-service/config"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+	"user-service/utils"
+)
+
+const (
+	emailVerificationExpiry   = time.Hour * 24
+	emailVerificationThrottle = time.Minute * 2
+)
+
+var ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+
+type EmailVerificationService struct {
+	UserRepository *repositories.UserRepository
+	OutboxService  *OutboxService
+}
+
+func NewEmailVerificationService(ur *repositories.UserRepository, obs *OutboxService) *EmailVerificationService {
+	return &EmailVerificationService{UserRepository: ur, OutboxService: obs}
+}
+
+// SendVerification emails the user a signed verification link for their
+// current address.
+func (es *EmailVerificationService) SendVerification(user *models.User) error {
+	token, err := utils.GenerateActionToken(utils.EmailVerificationPurpose, user.ID, user.Email, emailVerificationExpiry)
+	if err != nil {
+		return err
+	}
+	if err := es.UserRepository.UpdateColumns(user.ID, map[string]interface{}{"verification_sent_at": time.Now()}); err != nil {
+		return err
+	}
+
+	return es.OutboxService.Enqueue(user.Email, "email_verification", user.Locale, map[string]interface{}{
+		"Name":           user.Name,
+		"Link":           emailVerificationLink(token),
+		"ExpiresInHours": int(emailVerificationExpiry.Hours()),
+	})
+}
+
+// ResendVerification sends a new link to an unverified address. Unknown or
+// already verified addresses and requests within the throttle window are
+// ignored without an error, so callers cannot probe which emails exist.
+func (es *EmailVerificationService) ResendVerification(email string) error {
+	user, err := es.UserRepository.GetByEmail(email)
+	if err != nil || user.EmailVerifiedAt != nil {
+		return nil
+	}
+	if user.VerificationSentAt != nil && time.Since(*user.VerificationSentAt) < emailVerificationThrottle {
+		return nil
+	}
+	return es.SendVerification(user)
+}
+
+// VerifyEmail marks the address in the token as verified. Tokens sent to an
+// address the user no longer has are rejected.
+func (es *EmailVerificationService) VerifyEmail(token string) error {
+	claims, err := utils.ParseActionToken(token, utils.EmailVerificationPurpose)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+	user, err := es.UserRepository.GetByID(claims.UserID)
+	if err != nil || user.Email != claims.Email {
+		return ErrInvalidVerificationToken
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	return es.UserRepository.UpdateColumns(user.ID, map[string]interface{}{"email_verified_at": time.Now()})
+}
+
+func emailVerificationLink(token string) string {
+	return tokenLink(config.AppConfig.EmailVerificationURL, "http://localhost:8080/email/verify", token)
+}
+
+// tokenLink adds token as a query parameter to base, or to fallback when
+// base is not configured.
+func tokenLink(base, fallback, token string) string {
+	if base == "" {
+		base = fallback
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return base + "?token=" + url.QueryEscape(token)
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
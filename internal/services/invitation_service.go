@@ -0,0 +1,295 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"user-service/config"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+	"user-service/utils"
+)
+
+const invitationExpiry = time.Hour * 24 * 7
+
+var (
+	ErrInvitationNotFound       = errors.New("invitation not found")
+	ErrInvalidInvitation        = errors.New("invalid or expired invitation")
+	ErrInvitationNotPending     = errors.New("invitation was already accepted or revoked")
+	ErrInvitationEmailMismatch  = errors.New("invitation was sent to another email address")
+	ErrInvitationRoleNotAllowed = errors.New("inviting with this role requires roles:write")
+	ErrAlreadyMember            = errors.New("user is already a member of the organization")
+)
+
+// InvitationService invites people to organizations by email. Invitees
+// accept with an existing account, or register one for the invited address.
+type InvitationService struct {
+	InvitationRepository   *repositories.InvitationRepository
+	OrganizationRepository *repositories.OrganizationRepository
+	RoleRepository         *repositories.RoleRepository
+	UserRepository         *repositories.UserRepository
+	OutboxService          *OutboxService
+	AuditService           *AuditService
+}
+
+func NewInvitationService(ir *repositories.InvitationRepository, or *repositories.OrganizationRepository, rr *repositories.RoleRepository, ur *repositories.UserRepository, obs *OutboxService, as *AuditService) *InvitationService {
+	return &InvitationService{InvitationRepository: ir, OrganizationRepository: or, RoleRepository: rr, UserRepository: ur, OutboxService: obs, AuditService: as}
+}
+
+// CreateInvitation invites an email address to the organization and emails
+// it the link. Only inviters allowed to assign roles may invite with a role
+// other than member.
+func (is *InvitationService) CreateInvitation(orgID, inviterID uint, input models.CreateInvitationInput, canAssignRoles bool, info RequestInfo) (*models.InvitationResponse, error) {
+	roleName := input.Role
+	if roleName == "" {
+		roleName = models.OrgMemberRole
+	}
+	role, err := is.RoleRepository.GetByName(&orgID, roleName)
+	if err != nil {
+		return nil, ErrRoleNotFound
+	}
+	if roleName != models.OrgMemberRole && !canAssignRoles {
+		return nil, ErrInvitationRoleNotAllowed
+	}
+	if user, err := is.UserRepository.GetByEmail(input.Email); err == nil {
+		if _, err := is.OrganizationRepository.GetMembership(orgID, user.ID); err == nil {
+			return nil, ErrAlreadyMember
+		}
+	}
+
+	token, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	invitation := models.Invitation{
+		OrganizationID: orgID,
+		Email:          input.Email,
+		RoleID:         role.ID,
+		InvitedByID:    inviterID,
+		TokenHash:      utils.HashToken(token),
+		ExpiresAt:      time.Now().Add(invitationExpiry),
+		Role:           *role,
+	}
+	if err := is.InvitationRepository.Create(&invitation); err != nil {
+		return nil, err
+	}
+	is.AuditService.Record(info, models.AuditInvitationCreated, models.AuditTargetInvitation, invitation.ID, map[string]interface{}{
+		"organization_id": orgID,
+		"role":            role.Name,
+	})
+	if err := is.send(&invitation, token); err != nil {
+		return nil, err
+	}
+	response := newInvitationResponse(&invitation)
+	return &response, nil
+}
+
+func (is *InvitationService) ListInvitations(orgID uint) ([]models.InvitationResponse, error) {
+	invitations, err := is.InvitationRepository.List(orgID)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]models.InvitationResponse, 0, len(invitations))
+	for i := range invitations {
+		responses = append(responses, newInvitationResponse(&invitations[i]))
+	}
+	return responses, nil
+}
+
+// ResendInvitation emails a fresh link for an invitation that has not been
+// accepted or revoked, which also extends an expired one. The previous link
+// stops working.
+func (is *InvitationService) ResendInvitation(orgID, invitationID uint) (*models.InvitationResponse, error) {
+	invitation, err := is.InvitationRepository.GetByID(orgID, invitationID)
+	if err != nil {
+		return nil, ErrInvitationNotFound
+	}
+	token, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	invitation.TokenHash = utils.HashToken(token)
+	invitation.ExpiresAt = time.Now().Add(invitationExpiry)
+	ok, err := is.InvitationRepository.Renew(invitation)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvitationNotPending
+	}
+	if err := is.send(invitation, token); err != nil {
+		return nil, err
+	}
+	response := newInvitationResponse(invitation)
+	return &response, nil
+}
+
+func (is *InvitationService) RevokeInvitation(orgID, invitationID uint) error {
+	invitation, err := is.InvitationRepository.GetByID(orgID, invitationID)
+	if err != nil {
+		return ErrInvitationNotFound
+	}
+	ok, err := is.InvitationRepository.Revoke(invitation)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvitationNotPending
+	}
+	return nil
+}
+
+// PreviewInvitation describes the invitation behind a link so the invitee's
+// page can offer to sign in or to register.
+func (is *InvitationService) PreviewInvitation(token string) (*models.InvitationPreviewResponse, error) {
+	invitation, err := is.pendingInvitation(token)
+	if err != nil {
+		return nil, err
+	}
+	_, err = is.UserRepository.GetByEmail(invitation.Email)
+	return &models.InvitationPreviewResponse{
+		Organization:  invitation.Organization.Name,
+		Email:         invitation.Email,
+		Role:          invitation.Role.Name,
+		AccountExists: err == nil,
+		ExpiresAt:     invitation.ExpiresAt,
+	}, nil
+}
+
+// AcceptInvitation adds the signed in user to the organization. The user's
+// email must be the invited address.
+func (is *InvitationService) AcceptInvitation(token string, userID uint, info RequestInfo) (*models.OrganizationResponse, error) {
+	invitation, err := is.pendingInvitation(token)
+	if err != nil {
+		return nil, err
+	}
+	user, err := is.UserRepository.GetByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		return nil, ErrInvitationEmailMismatch
+	}
+	if err := is.accept(invitation, user.ID); err != nil {
+		return nil, err
+	}
+	is.recordAccepted(info, invitation, user.ID)
+	return is.organizationResponse(invitation, user.ID)
+}
+
+// RegisterWithInvitation registers an account for the invited address and
+// accepts the invitation with it. Receiving the link proves the invitee owns
+// the address, so the email is verified right away.
+func (is *InvitationService) RegisterWithInvitation(input models.AcceptInvitationRegisterInput, info RequestInfo) (*models.User, error) {
+	invitation, err := is.pendingInvitation(input.Token)
+	if err != nil {
+		return nil, err
+	}
+	if err := is.UserRepository.CheckEmailExist(&models.User{Email: invitation.Email}); err != nil {
+		return nil, ErrEmailTaken
+	}
+	hashedPassword, err := utils.HashPassword(input.Password)
+	if err != nil {
+		return nil, err
+	}
+	verifiedAt := time.Now()
+	user := models.User{
+		Name:            input.Name,
+		Email:           invitation.Email,
+		Password:        hashedPassword,
+		EmailVerifiedAt: &verifiedAt,
+	}
+	ok, err := is.InvitationRepository.AcceptWithNewUser(invitation, &user)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidInvitation
+	}
+	info.UserID = user.ID
+	is.AuditService.Record(info, models.AuditRegister, models.AuditTargetUser, user.ID, map[string]models.AuditChange{
+		"email": {To: user.Email},
+	})
+	is.recordAccepted(info, invitation, user.ID)
+	return &user, nil
+}
+
+func (is *InvitationService) pendingInvitation(token string) (*models.Invitation, error) {
+	invitation, err := is.InvitationRepository.GetByTokenHash(utils.HashToken(token))
+	if err != nil || invitation.Status() != models.InvitationPending {
+		return nil, ErrInvalidInvitation
+	}
+	return invitation, nil
+}
+
+func (is *InvitationService) accept(invitation *models.Invitation, userID uint) error {
+	ok, err := is.InvitationRepository.Accept(invitation, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidInvitation
+	}
+	return nil
+}
+
+// recordAccepted audits the user joining the organization through the
+// invitation.
+func (is *InvitationService) recordAccepted(info RequestInfo, invitation *models.Invitation, userID uint) {
+	is.AuditService.Record(info, models.AuditInvitationAccepted, models.AuditTargetUser, userID, map[string]interface{}{
+		"organization_id": invitation.OrganizationID,
+		"invitation_id":   invitation.ID,
+		"role":            invitation.Role.Name,
+	})
+}
+
+func (is *InvitationService) organizationResponse(invitation *models.Invitation, userID uint) (*models.OrganizationResponse, error) {
+	roles, err := is.RoleRepository.ListMembershipRoles(invitation.OrganizationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.OrganizationResponse{
+		ID:        invitation.Organization.ID,
+		Name:      invitation.Organization.Name,
+		Slug:      invitation.Organization.Slug,
+		Roles:     roleNames(roles),
+		CreatedAt: invitation.Organization.CreatedAt,
+	}, nil
+}
+
+// send emails the invitation link, in the invitee's language when they
+// already have an account.
+func (is *InvitationService) send(invitation *models.Invitation, token string) error {
+	org, err := is.OrganizationRepository.GetByID(invitation.OrganizationID)
+	if err != nil {
+		return err
+	}
+	inviter := "Someone"
+	if user, err := is.UserRepository.GetByID(invitation.InvitedByID); err == nil {
+		inviter = user.Name
+	}
+	var locale string
+	if user, err := is.UserRepository.GetByEmail(invitation.Email); err == nil {
+		locale = user.Locale
+	}
+	return is.OutboxService.Enqueue(invitation.Email, "org_invitation", locale, map[string]interface{}{
+		"Organization":  org.Name,
+		"InvitedBy":     inviter,
+		"Email":         invitation.Email,
+		"Link":          tokenLink(config.AppConfig.InvitationURL, "http://localhost:8080/invitations", token),
+		"ExpiresInDays": int(invitationExpiry.Hours() / 24),
+	})
+}
+
+func newInvitationResponse(invitation *models.Invitation) models.InvitationResponse {
+	return models.InvitationResponse{
+		ID:             invitation.ID,
+		OrganizationID: invitation.OrganizationID,
+		Email:          invitation.Email,
+		Role:           invitation.Role.Name,
+		InvitedByID:    invitation.InvitedByID,
+		Status:         invitation.Status(),
+		ExpiresAt:      invitation.ExpiresAt,
+		CreatedAt:      invitation.CreatedAt,
+	}
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+	"user-service/utils"
+)
+
+const defaultLoginHistoryPageSize = 20
+
+// LoginHistoryService records every attempt to sign in, keeps the users'
+// LastLogin up to date and audits the attempts.
+type LoginHistoryService struct {
+	LoginHistoryRepository *repositories.LoginHistoryRepository
+	UserRepository         *repositories.UserRepository
+	AuditService           *AuditService
+}
+
+func NewLoginHistoryService(lr *repositories.LoginHistoryRepository, ur *repositories.UserRepository, as *AuditService) *LoginHistoryService {
+	return &LoginHistoryService{LoginHistoryRepository: lr, UserRepository: ur, AuditService: as}
+}
+
+// RecordSuccess records a completed login of the user and sets their
+// LastLogin. Like audit events, failures to record are only logged.
+func (lhs *LoginHistoryService) RecordSuccess(user *models.User, method string, info RequestInfo) {
+	now := time.Now()
+	if err := lhs.UserRepository.TouchLastLogin(user.ID, now); err != nil {
+		log.Printf("login history: failed to update last login of user %d: %v", user.ID, err)
+	} else {
+		user.LastLogin = now
+	}
+	lhs.record(user, user.Email, method, "", info)
+	info.UserID = user.ID
+	lhs.AuditService.RecordLater(info, models.AuditLogin, models.AuditTargetUser, user.ID, map[string]string{"method": method})
+}
+
+// RecordFailure records a failed login. user is nil when the attempt named
+// an email no account uses.
+func (lhs *LoginHistoryService) RecordFailure(user *models.User, email, method string, cause error, info RequestInfo) {
+	reason := loginFailureReason(cause)
+	lhs.record(user, email, method, reason, info)
+	var targetType string
+	var targetID uint
+	if user != nil {
+		targetType, targetID = models.AuditTargetUser, user.ID
+	}
+	lhs.AuditService.RecordLater(info, models.AuditLoginFailed, targetType, targetID, map[string]string{
+		"email":  email,
+		"method": method,
+		"reason": reason,
+	})
+}
+
+func (lhs *LoginHistoryService) record(user *models.User, email, method, reason string, info RequestInfo) {
+	attempt := models.LoginAttempt{
+		Email:         strings.TrimSpace(email),
+		Method:        method,
+		Success:       reason == "",
+		FailureReason: reason,
+		IP:            info.IP,
+		UserAgent:     info.UserAgent,
+	}
+	if user != nil {
+		attempt.UserID = &user.ID
+	}
+	if err := lhs.LoginHistoryRepository.Create(&attempt); err != nil {
+		log.Printf("login history: failed to record %s login: %v", method, err)
+	}
+}
+
+// ListAttempts returns a page of the user's login attempts, newest first.
+// Deleted accounts keep their history until they are purged.
+func (lhs *LoginHistoryService) ListAttempts(userID uint, query models.LoginHistoryQuery) (*models.LoginHistoryResponse, error) {
+	if _, err := lhs.UserRepository.GetByIDWithDeleted(userID); err != nil {
+		return nil, ErrUserNotFound
+	}
+	var beforeID uint
+	if query.Cursor != "" {
+		id, err := decodeIDCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		beforeID = id
+	}
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultLoginHistoryPageSize
+	}
+	attempts, err := lhs.LoginHistoryRepository.List(userID, query.Success, beforeID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	response := &models.LoginHistoryResponse{Attempts: make([]models.LoginAttemptResponse, 0, limit)}
+	if len(attempts) > limit {
+		attempts = attempts[:limit]
+		response.NextCursor = encodeIDCursor(attempts[limit-1].ID)
+	}
+	for _, attempt := range attempts {
+		response.Attempts = append(response.Attempts, newLoginAttemptResponse(&attempt))
+	}
+	return response, nil
+}
+
+func newLoginAttemptResponse(attempt *models.LoginAttempt) models.LoginAttemptResponse {
+	return models.LoginAttemptResponse{
+		ID:            attempt.ID,
+		Method:        attempt.Method,
+		Success:       attempt.Success,
+		FailureReason: attempt.FailureReason,
+		IP:            attempt.IP,
+		UserAgent:     attempt.UserAgent,
+		CreatedAt:     attempt.CreatedAt,
+	}
+}
+
+// loginFailureReason names the cause of a failed login for the history.
+func loginFailureReason(err error) string {
+	switch {
+	case errors.Is(err, utils.ErrInvalidCredentials):
+		return "invalid_credentials"
+	case errors.Is(err, ErrUserNotFound):
+		return "unknown_account"
+	case errors.Is(err, utils.ErrAccountSuspended):
+		return "account_suspended"
+	case errors.Is(err, utils.ErrAccountBanned):
+		return "account_banned"
+	case errors.Is(err, utils.ErrAccountPending):
+		return "account_pending"
+	case errors.Is(err, ErrEmailNotVerified):
+		return "email_not_verified"
+	case errors.Is(err, ErrInvalidMFACode):
+		return "invalid_code"
+	case errors.Is(err, ErrMFALocked):
+		return "mfa_locked"
+	case errors.Is(err, ErrWebAuthnVerification):
+		return "verification_failed"
+	case errors.Is(err, ErrAccountLinkRequired):
+		return "link_required"
+	}
+	return "error"
+}
@@ -0,0 +1,358 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"user-service/config"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+	"user-service/utils"
+)
+
+const (
+	recoveryCodeCount = 10
+	// maxMFAAttempts wrong codes at the MFA login step lock it for
+	// mfaLockout, so a TOTP code cannot be guessed by trying them all.
+	maxMFAAttempts = 5
+	mfaLockout     = time.Minute * 15
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("mfa already enabled")
+	ErrMFANotEnabled     = errors.New("mfa not enabled")
+	ErrMFANotStarted     = errors.New("mfa enrollment not started")
+	ErrInvalidMFACode    = errors.New("invalid mfa code")
+	ErrInvalidMFAToken   = errors.New("invalid mfa token")
+	ErrMFALocked         = errors.New("too many invalid mfa codes")
+)
+
+type MFAService struct {
+	UserRepository      *repositories.UserRepository
+	MFARepository       *repositories.MFARepository
+	WebAuthnRepository  *repositories.WebAuthnRepository
+	LoginHistoryService *LoginHistoryService
+	AuditService        *AuditService
+	// WebAuthnService verifies security key assertions. It is set once
+	// WebAuthn is configured and stays nil otherwise.
+	WebAuthnService *WebAuthnService
+}
+
+func NewMFAService(ur *repositories.UserRepository, mr *repositories.MFARepository, wr *repositories.WebAuthnRepository, lhs *LoginHistoryService, as *AuditService) *MFAService {
+	return &MFAService{UserRepository: ur, MFARepository: mr, WebAuthnRepository: wr, LoginHistoryService: lhs, AuditService: as}
+}
+
+// BeginTOTPEnrollment generates a new TOTP secret for the user. It only
+// becomes a second factor once ConfirmTOTPEnrollment receives a valid code,
+// so users whose MFA comes from security keys can add TOTP as well.
+func (ms *MFAService) BeginTOTPEnrollment(userID uint) (*models.TOTPSetupResponse, error) {
+	user, err := ms.UserRepository.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled && user.TOTPSecret != "" {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := ms.MFARepository.SetPendingTOTPSecret(user.ID, secret); err != nil {
+		return nil, err
+	}
+	return &models.TOTPSetupResponse{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPURI(totpIssuer(), user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment makes the pending TOTP secret a second factor once
+// the user proves their authenticator works. When this enables MFA a fresh
+// set of recovery codes is returned; adding TOTP while MFA is already on
+// requires re-authentication and keeps the existing codes.
+func (ms *MFAService) ConfirmTOTPEnrollment(userID uint, input models.TOTPConfirmInput, info RequestInfo) ([]string, error) {
+	user, err := ms.UserRepository.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled && user.TOTPSecret != "" {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.PendingTOTPSecret == "" {
+		return nil, ErrMFANotStarted
+	}
+	if user.MFAEnabled {
+		if err := ms.Reauthenticate(user, input.Reauthentication); err != nil {
+			return nil, err
+		}
+	}
+	if err := ms.checkTOTP(user.ID, user.PendingTOTPSecret, input.Code); err != nil {
+		return nil, err
+	}
+	confirmed, err := ms.MFARepository.ConfirmTOTPSecret(user.ID, user.PendingTOTPSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !confirmed {
+		return nil, ErrMFANotStarted
+	}
+	if user.MFAEnabled {
+		ms.AuditService.Record(info, models.AuditTOTPAdded, models.AuditTargetUser, user.ID, nil)
+		return nil, nil
+	}
+	ms.recordMFAChange(info, user.ID, true, models.LoginMethodTOTP)
+	return ms.generateRecoveryCodes(user.ID)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking
+// a second factor.
+func (ms *MFAService) RegenerateRecoveryCodes(userID uint, input models.SecondFactorInput) ([]string, error) {
+	user, err := ms.UserRepository.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.MFAEnabled {
+		return nil, ErrMFANotEnabled
+	}
+	if err := ms.verifyFreshSecondFactor(user, input); err != nil {
+		return nil, err
+	}
+	return ms.generateRecoveryCodes(user.ID)
+}
+
+// DisableMFA turns MFA off for a user who re-authenticates with their
+// password, or account email when they have none, and a second factor.
+func (ms *MFAService) DisableMFA(userID uint, input models.ReauthenticationInput, info RequestInfo) error {
+	user, err := ms.UserRepository.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.MFAEnabled {
+		return ErrMFANotEnabled
+	}
+	if err := ms.Reauthenticate(user, input); err != nil {
+		return err
+	}
+	if err := ms.turnOffMFA(user.ID); err != nil {
+		return err
+	}
+	ms.recordMFAChange(info, user.ID, false, secondFactorInputMethod(input.SecondFactorInput))
+	return nil
+}
+
+// ResetMFA removes every second factor of the user: the TOTP secret,
+// recovery codes and security keys. Used by admins to help users who lost
+// them all.
+func (ms *MFAService) ResetMFA(userID uint) error {
+	if err := ms.turnOffMFA(userID); err != nil {
+		return err
+	}
+	return ms.WebAuthnRepository.DeleteCredentialsByUserID(userID)
+}
+
+// turnOffMFA disables MFA and removes the TOTP secret and recovery codes.
+// Security keys stay registered for passkey login.
+func (ms *MFAService) turnOffMFA(userID uint) error {
+	if err := ms.MFARepository.SetTOTPSecret(userID, ""); err != nil {
+		return err
+	}
+	return ms.MFARepository.ReplaceRecoveryCodes(userID, nil)
+}
+
+// VerifyLoginChallenge checks the MFA token handed out by a password or
+// social login together with a TOTP or recovery code, and returns the user
+// tokens may now be issued for. Wrong codes are recorded in the login
+// history and too many of them lock the step for the user, whichever MFA
+// token they come with.
+func (ms *MFAService) VerifyLoginChallenge(mfaToken, code, recoveryCode string, info RequestInfo) (*models.User, error) {
+	user, err := ms.ParseMFAToken(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	method := SecondFactorMethod(recoveryCode)
+	if user.MFALockedUntil != nil && time.Now().Before(*user.MFALockedUntil) {
+		ms.LoginHistoryService.RecordFailure(user, user.Email, method, ErrMFALocked, info)
+		return nil, ErrMFALocked
+	}
+	if err := ms.VerifySecondFactor(user, code, recoveryCode); err != nil {
+		ms.LoginHistoryService.RecordFailure(user, user.Email, method, err, info)
+		if errors.Is(err, ErrInvalidMFACode) {
+			if err := ms.MFARepository.RecordFailedAttempt(user.ID, maxMFAAttempts, time.Now().Add(mfaLockout)); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+	if err := ms.MFARepository.ResetFailedAttempts(user.ID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// SecondFactorMethod is the login method of a second factor checked by
+// VerifySecondFactor.
+func SecondFactorMethod(recoveryCode string) string {
+	if recoveryCode != "" {
+		return models.LoginMethodRecoveryCode
+	}
+	return models.LoginMethodTOTP
+}
+
+// ParseMFAToken returns the user an MFA token was issued for.
+func (ms *MFAService) ParseMFAToken(mfaToken string) (*models.User, error) {
+	claims, err := utils.ParseToken(mfaToken)
+	if err != nil || claims.TokenType != utils.MFATokenType {
+		return nil, ErrInvalidMFAToken
+	}
+	user, err := ms.UserRepository.GetByID(claims.UserID)
+	if err != nil || !user.MFAEnabled {
+		return nil, ErrInvalidMFAToken
+	}
+	return user, nil
+}
+
+// EnableMFA turns MFA on for a user whose first second factor is not TOTP,
+// such as a security key, and returns their new recovery codes. A secret
+// left by an unconfirmed TOTP enrollment is dropped, so it cannot become a
+// second factor.
+func (ms *MFAService) EnableMFA(userID uint, info RequestInfo) ([]string, error) {
+	if err := ms.MFARepository.SetTOTPSecret(userID, ""); err != nil {
+		return nil, err
+	}
+	if err := ms.MFARepository.EnableMFA(userID); err != nil {
+		return nil, err
+	}
+	ms.recordMFAChange(info, userID, true, models.LoginMethodSecurityKey)
+	return ms.generateRecoveryCodes(userID)
+}
+
+// recordMFAChange audits MFA being turned on or off by the user, naming the
+// second factor that caused it.
+func (ms *MFAService) recordMFAChange(info RequestInfo, userID uint, enabled bool, method string) {
+	action := models.AuditMFADisabled
+	if enabled {
+		action = models.AuditMFAEnabled
+	}
+	ms.AuditService.Record(info, action, models.AuditTargetUser, userID, map[string]interface{}{
+		"mfa_enabled": models.AuditChange{From: !enabled, To: enabled},
+		"method":      method,
+	})
+}
+
+// Reauthenticate confirms a sensitive change to the user's own account: the
+// current password, or the account email for accounts without one, and a
+// fresh second factor when MFA is on. Wrong second factors count towards
+// the same lockout as the MFA login step.
+func (ms *MFAService) Reauthenticate(user *models.User, input models.ReauthenticationInput) error {
+	if err := confirmIdentity(user, input.Password, input.Email); err != nil {
+		return err
+	}
+	if !user.MFAEnabled {
+		return nil
+	}
+	return ms.verifyFreshSecondFactor(user, input.SecondFactorInput)
+}
+
+// verifyFreshSecondFactor checks a second factor given by a signed-in user,
+// locking the check after too many wrong ones.
+func (ms *MFAService) verifyFreshSecondFactor(user *models.User, input models.SecondFactorInput) error {
+	if user.MFALockedUntil != nil && time.Now().Before(*user.MFALockedUntil) {
+		return ErrMFALocked
+	}
+	var err error
+	switch {
+	case len(input.WebAuthn) == 0:
+		err = ms.VerifySecondFactor(user, input.Code, input.RecoveryCode)
+	case ms.WebAuthnService == nil:
+		err = ErrInvalidMFACode
+	default:
+		err = ms.WebAuthnService.VerifyReauthentication(user.ID, input.WebAuthn)
+		if errors.Is(err, ErrWebAuthnVerification) {
+			err = ErrInvalidMFACode
+		}
+	}
+	if errors.Is(err, ErrInvalidMFACode) {
+		if err := ms.MFARepository.RecordFailedAttempt(user.ID, maxMFAAttempts, time.Now().Add(mfaLockout)); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return ms.MFARepository.ResetFailedAttempts(user.ID)
+}
+
+// secondFactorInputMethod is the login method of the second factor given
+// in the input.
+func secondFactorInputMethod(input models.SecondFactorInput) string {
+	if len(input.WebAuthn) > 0 {
+		return models.LoginMethodSecurityKey
+	}
+	return SecondFactorMethod(input.RecoveryCode)
+}
+
+// VerifySecondFactor accepts either a TOTP code or an unused recovery code.
+func (ms *MFAService) VerifySecondFactor(user *models.User, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		normalized := strings.ToLower(strings.TrimSpace(recoveryCode))
+		ok, err := ms.MFARepository.UseRecoveryCode(user.ID, utils.HashToken(normalized))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+	return ms.verifyTOTP(user, code)
+}
+
+func (ms *MFAService) verifyTOTP(user *models.User, code string) error {
+	// MFA may be enabled through a security key alone.
+	if user.TOTPSecret == "" {
+		return ErrInvalidMFACode
+	}
+	return ms.checkTOTP(user.ID, user.TOTPSecret, code)
+}
+
+// checkTOTP validates a code against the secret and records its time step,
+// so the same code cannot be used twice.
+func (ms *MFAService) checkTOTP(userID uint, secret, code string) error {
+	step, ok := utils.ValidateTOTP(secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	advanced, err := ms.MFARepository.AdvanceTOTPStep(userID, step)
+	if err != nil {
+		return err
+	}
+	if !advanced {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (ms *MFAService) generateRecoveryCodes(userID uint) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.MFARecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, models.MFARecoveryCode{UserID: userID, CodeHash: utils.HashToken(code)})
+	}
+	if err := ms.MFARepository.ReplaceRecoveryCodes(userID, records); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func totpIssuer() string {
+	if config.AppConfig.TOTPIssuer != "" {
+		return config.AppConfig.TOTPIssuer
+	}
+	return "User Service"
+}
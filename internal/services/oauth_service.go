@@ -0,0 +1,387 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+	"user-service/utils"
+)
+
+const authorizationCodeExpiry = time.Minute * 5
+
+var (
+	ErrUnknownClient           = errors.New("unknown client")
+	ErrInvalidRedirectURI      = errors.New("redirect uri is not registered for this client")
+	ErrGlobalClientsNotAllowed = errors.New("global clients require organizations:manage")
+	SupportedOAuthScopes       = []string{"openid", "profile", "email"}
+	SupportedPKCEMethods       = []string{"S256"}
+	SupportedResponseTypes     = []string{"code"}
+)
+
+// OAuthError is an error defined by the OAuth 2.0 specification. Its Code is
+// returned to the client as the "error" parameter.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func newOAuthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+type OAuthService struct {
+	OAuthRepository *repositories.OAuthRepository
+	UserRepository  *repositories.UserRepository
+	TokenService    *TokenService
+	AuditService    *AuditService
+}
+
+func NewOAuthService(or *repositories.OAuthRepository, ur *repositories.UserRepository, ts *TokenService, as *AuditService) *OAuthService {
+	return &OAuthService{OAuthRepository: or, UserRepository: ur, TokenService: ts, AuditService: as}
+}
+
+// RegisterClient creates a new OAuth client owned by the active
+// organization, or a global one when input.Global is set or a caller managing
+// all organizations has none active. The plain client secret is only
+// returned here; just its hash is stored.
+func (oas *OAuthService) RegisterClient(scope OrgScope, input models.CreateOAuthClientInput, info RequestInfo) (*models.OAuthClientResponse, error) {
+	var organizationID *uint
+	switch {
+	case input.Global && !scope.All:
+		return nil, ErrGlobalClientsNotAllowed
+	case input.Global, scope.OrganizationID == 0 && scope.All:
+	case scope.OrganizationID == 0:
+		return nil, ErrNoActiveOrganization
+	default:
+		organizationID = &scope.OrganizationID
+	}
+	clientID, err := utils.GenerateRandomString(18)
+	if err != nil {
+		return nil, err
+	}
+	client := models.OAuthClient{
+		OrganizationID: organizationID,
+		ClientID:       clientID,
+		Name:           input.Name,
+		RedirectURIs:   strings.Join(input.RedirectURIs, " "),
+		Public:         input.Public,
+	}
+
+	var secret string
+	if !input.Public {
+		if secret, err = utils.GenerateRandomString(32); err != nil {
+			return nil, err
+		}
+		client.ClientSecretHash = utils.HashToken(secret)
+	}
+	if err := oas.OAuthRepository.CreateClient(&client); err != nil {
+		return nil, err
+	}
+	oas.AuditService.Record(info, models.AuditOAuthClientCreated, models.AuditTargetOAuthClient, client.ID, map[string]interface{}{
+		"client_id":       client.ClientID,
+		"name":            client.Name,
+		"redirect_uris":   input.RedirectURIs,
+		"public":          client.Public,
+		"organization_id": client.OrganizationID,
+	})
+
+	response := toOAuthClientResponse(&client)
+	response.ClientSecret = secret
+	return &response, nil
+}
+
+// ListClients returns the clients of the active organization, or every
+// client when the scope covers all organizations.
+func (oas *OAuthService) ListClients(scope OrgScope) ([]models.OAuthClientResponse, error) {
+	var organizationID *uint
+	if !scope.All {
+		organizationID = &scope.OrganizationID
+	}
+	clients, err := oas.OAuthRepository.ListClients(organizationID)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]models.OAuthClientResponse, 0, len(clients))
+	for i := range clients {
+		response = append(response, toOAuthClientResponse(&clients[i]))
+	}
+	return response, nil
+}
+
+// DeleteClient deletes a client of the active organization. Clients outside
+// the scope are reported as ErrUnknownClient.
+func (oas *OAuthService) DeleteClient(scope OrgScope, clientID string, info RequestInfo) error {
+	client, err := oas.OAuthRepository.GetClientByClientID(clientID)
+	if err != nil {
+		return ErrUnknownClient
+	}
+	if !scope.All && (client.OrganizationID == nil || *client.OrganizationID != scope.OrganizationID) {
+		return ErrUnknownClient
+	}
+	if err := oas.OAuthRepository.DeleteClient(client); err != nil {
+		return err
+	}
+	oas.AuditService.Record(info, models.AuditOAuthClientDeleted, models.AuditTargetOAuthClient, client.ID, map[string]string{"client_id": client.ClientID})
+	return nil
+}
+
+// ValidateAuthorizeRequest checks an authorization request. ErrUnknownClient
+// and ErrInvalidRedirectURI must be shown to the user; any *OAuthError may be
+// reported back to the validated redirect URI.
+func (oas *OAuthService) ValidateAuthorizeRequest(input models.AuthorizeInput) (*models.OAuthClient, error) {
+	client, err := oas.OAuthRepository.GetClientByClientID(input.ClientID)
+	if err != nil {
+		return nil, ErrUnknownClient
+	}
+	if !hasRedirectURI(client, input.RedirectURI) {
+		return nil, ErrInvalidRedirectURI
+	}
+
+	if input.ResponseType != "code" {
+		return client, newOAuthError("unsupported_response_type", "only the code response type is supported")
+	}
+	for _, scope := range strings.Fields(input.Scope) {
+		if !contains(SupportedOAuthScopes, scope) {
+			return client, newOAuthError("invalid_scope", "unsupported scope "+scope)
+		}
+	}
+	if input.CodeChallenge == "" {
+		if client.Public {
+			return client, newOAuthError("invalid_request", "public clients must use PKCE")
+		}
+	} else if input.CodeChallengeMethod != "S256" {
+		return client, newOAuthError("invalid_request", "code_challenge_method must be S256")
+	}
+	return client, nil
+}
+
+// Authorize issues an authorization code for the user and returns the URL
+// the user agent should be sent back to.
+func (oas *OAuthService) Authorize(userID uint, input models.AuthorizeInput) (string, error) {
+	if _, err := oas.ValidateAuthorizeRequest(input); err != nil {
+		return "", err
+	}
+
+	code, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	authCode := models.AuthorizationCode{
+		CodeHash:            utils.HashToken(code),
+		ClientID:            input.ClientID,
+		UserID:              userID,
+		RedirectURI:         input.RedirectURI,
+		Scope:               input.Scope,
+		Nonce:               input.Nonce,
+		CodeChallenge:       input.CodeChallenge,
+		CodeChallengeMethod: input.CodeChallengeMethod,
+		AuthTime:            now,
+		ExpiresAt:           now.Add(authorizationCodeExpiry),
+	}
+	if err := oas.OAuthRepository.CreateAuthorizationCode(&authCode); err != nil {
+		return "", err
+	}
+
+	return AuthorizeRedirectURL(input.RedirectURI, url.Values{"code": {code}, "state": {input.State}}), nil
+}
+
+// AuthorizeRedirectURL appends the response parameters to the client's
+// redirect URI, leaving out empty values.
+func AuthorizeRedirectURL(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := u.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Exchange handles the token endpoint for the authorization_code and
+// refresh_token grants. issuer is used for the ID token's iss claim.
+func (oas *OAuthService) Exchange(input models.OAuthTokenInput, issuer, userAgent, ip string) (*models.OAuthTokenResponse, error) {
+	client, err := oas.authenticateClient(input.ClientID, input.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	switch input.GrantType {
+	case "authorization_code":
+		return oas.exchangeAuthorizationCode(client, input, issuer, userAgent, ip)
+	case "refresh_token":
+		accessToken, refreshToken, err := oas.TokenService.RefreshTokens(input.RefreshToken, client.ClientID)
+		if err != nil {
+			if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+				return nil, newOAuthError("invalid_grant", "invalid refresh token")
+			}
+			if isAccountStatusError(err) {
+				return nil, newOAuthError("invalid_grant", "account is disabled")
+			}
+			return nil, err
+		}
+		return &models.OAuthTokenResponse{
+			AccessToken:  accessToken,
+			TokenType:    "Bearer",
+			ExpiresIn:    int(utils.AccessTokenExpiry().Seconds()),
+			RefreshToken: refreshToken,
+		}, nil
+	}
+	return nil, newOAuthError("unsupported_grant_type", "unsupported grant type "+input.GrantType)
+}
+
+func (oas *OAuthService) exchangeAuthorizationCode(client *models.OAuthClient, input models.OAuthTokenInput, issuer, userAgent, ip string) (*models.OAuthTokenResponse, error) {
+	invalidGrant := newOAuthError("invalid_grant", "invalid authorization code")
+
+	code, err := oas.OAuthRepository.GetAuthorizationCodeByHash(utils.HashToken(input.Code))
+	if err != nil || code.ClientID != client.ClientID || time.Now().After(code.ExpiresAt) {
+		return nil, invalidGrant
+	}
+	if code.UsedAt != nil {
+		// A replayed code revokes the session issued from its first use.
+		if code.SessionID != "" {
+			if err := oas.TokenService.RevokeSession(code.SessionID); err != nil {
+				return nil, err
+			}
+		}
+		return nil, invalidGrant
+	}
+	if code.RedirectURI != input.RedirectURI {
+		return nil, newOAuthError("invalid_grant", "redirect_uri does not match the authorization request")
+	}
+	if code.CodeChallenge != "" && !verifyCodeChallenge(input.CodeVerifier, code.CodeChallenge) {
+		return nil, newOAuthError("invalid_grant", "invalid code_verifier")
+	}
+
+	ok, err := oas.OAuthRepository.MarkAuthorizationCodeUsed(code.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, invalidGrant
+	}
+
+	user, err := oas.UserRepository.GetByID(code.UserID)
+	if err != nil || CheckAccountStatus(user) != nil {
+		return nil, invalidGrant
+	}
+	sessionID, err := oas.TokenService.StartSession(user, client.ClientID, code.Scope, userAgent, ip)
+	if err != nil {
+		return nil, err
+	}
+	if err := oas.OAuthRepository.SetAuthorizationCodeSession(code.ID, sessionID); err != nil {
+		return nil, err
+	}
+	accessToken, refreshToken, err := oas.TokenService.IssueSessionTokens(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(utils.AccessTokenExpiry().Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        code.Scope,
+	}
+	scopes := strings.Fields(code.Scope)
+	if contains(scopes, "openid") {
+		claims := &utils.IDTokenClaims{
+			Nonce:    code.Nonce,
+			AuthTime: code.AuthTime.Unix(),
+		}
+		claims.Issuer = issuer
+		claims.Subject = strconv.FormatUint(uint64(user.ID), 10)
+		claims.Audience = client.ClientID
+		if contains(scopes, "email") {
+			claims.Email = user.Email
+		}
+		if contains(scopes, "profile") {
+			claims.Name = user.Name
+		}
+		if response.IDToken, err = utils.GenerateIDToken(claims); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// GetUserInfo returns the standard OpenID Connect claims of the user that
+// the given scopes allow.
+func (oas *OAuthService) GetUserInfo(userID uint, scopes []string) (map[string]interface{}, error) {
+	user, err := oas.UserRepository.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	claims := map[string]interface{}{"sub": strconv.FormatUint(uint64(user.ID), 10)}
+	if contains(scopes, "profile") {
+		claims["name"] = user.Name
+	}
+	if contains(scopes, "email") {
+		claims["email"] = user.Email
+	}
+	return claims, nil
+}
+
+func (oas *OAuthService) authenticateClient(clientID, clientSecret string) (*models.OAuthClient, error) {
+	invalidClient := newOAuthError("invalid_client", "client authentication failed")
+	client, err := oas.OAuthRepository.GetClientByClientID(clientID)
+	if err != nil {
+		return nil, invalidClient
+	}
+	if client.Public {
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(clientSecret)), []byte(client.ClientSecretHash)) != 1 {
+		return nil, invalidClient
+	}
+	return client, nil
+}
+
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if verifier == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func hasRedirectURI(client *models.OAuthClient, redirectURI string) bool {
+	return contains(strings.Fields(client.RedirectURIs), redirectURI)
+}
+
+func toOAuthClientResponse(client *models.OAuthClient) models.OAuthClientResponse {
+	return models.OAuthClientResponse{
+		OrganizationID: client.OrganizationID,
+		ClientID:       client.ClientID,
+		Name:           client.Name,
+		RedirectURIs:   strings.Fields(client.RedirectURIs),
+		Public:         client.Public,
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package services
+
+import "testing"
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// RFC 7636 appendix B.
+	const (
+		verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	)
+	tests := []struct {
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{verifier, challenge, true},
+		{verifier + "x", challenge, false},
+		{verifier, challenge + "=", false},
+		// The plain method is not supported: the verifier is not its own
+		// challenge.
+		{verifier, verifier, false},
+		{"", "", false},
+		{"", challenge, false},
+	}
+	for _, tt := range tests {
+		if got := verifyCodeChallenge(tt.verifier, tt.challenge); got != tt.want {
+			t.Errorf("verifyCodeChallenge(%q, %q) = %v, want %v", tt.verifier, tt.challenge, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrInvalidSlug          = errors.New("invalid organization slug")
+	ErrSlugTaken            = errors.New("organization slug is taken")
+	ErrNotMember            = errors.New("user is not a member of the organization")
+	ErrLastOwner            = errors.New("cannot remove the last owner")
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// OrgScope is the part of the service an authenticated caller can act on:
+// their active organization, or everything for holders of the
+// organizations:manage permission.
+type OrgScope struct {
+	OrganizationID uint
+	All            bool
+}
+
+// OrganizationService manages organizations and their members.
+type OrganizationService struct {
+	OrganizationRepository *repositories.OrganizationRepository
+	RoleRepository         *repositories.RoleRepository
+	SessionRepository      *repositories.SessionRepository
+	UserRepository         *repositories.UserRepository
+	TokenService           *TokenService
+	AuditService           *AuditService
+}
+
+func NewOrganizationService(or *repositories.OrganizationRepository, rr *repositories.RoleRepository, sr *repositories.SessionRepository, ur *repositories.UserRepository, ts *TokenService, as *AuditService) *OrganizationService {
+	return &OrganizationService{OrganizationRepository: or, RoleRepository: rr, SessionRepository: sr, UserRepository: ur, TokenService: ts, AuditService: as}
+}
+
+// CreateOrganization creates an organization owned by the user. Without a
+// slug one is derived from the name.
+func (ogs *OrganizationService) CreateOrganization(userID uint, input models.CreateOrganizationInput) (*models.OrganizationResponse, error) {
+	slug := input.Slug
+	if slug == "" {
+		generated, err := ogs.generateSlug(input.Name)
+		if err != nil {
+			return nil, err
+		}
+		slug = generated
+	} else {
+		if !slugPattern.MatchString(slug) {
+			return nil, ErrInvalidSlug
+		}
+		exists, err := ogs.OrganizationRepository.SlugExists(slug)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, ErrSlugTaken
+		}
+	}
+
+	org := models.Organization{Name: input.Name, Slug: slug}
+	if err := ogs.OrganizationRepository.Create(&org, userID); err != nil {
+		return nil, err
+	}
+	return &models.OrganizationResponse{
+		ID:        org.ID,
+		Name:      org.Name,
+		Slug:      org.Slug,
+		Roles:     []string{models.OrgOwnerRole},
+		CreatedAt: org.CreatedAt,
+	}, nil
+}
+
+// generateSlug turns a name such as "Acme Corp." into "acme-corp", adding
+// a random suffix when that is taken.
+func (ogs *OrganizationService) generateSlug(name string) (string, error) {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+		if b.Len() >= 48 {
+			break
+		}
+	}
+	base := b.String()
+	if base == "" {
+		base = "org"
+	}
+	slug := base
+	for i := 0; i < 5; i++ {
+		exists, err := ogs.OrganizationRepository.SlugExists(slug)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return slug, nil
+		}
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+		slug = base + "-" + hex.EncodeToString(suffix)
+	}
+	return "", ErrSlugTaken
+}
+
+// ListOrganizations returns the organizations the user belongs to, marking
+// the active one.
+func (ogs *OrganizationService) ListOrganizations(userID, activeOrgID uint) ([]models.OrganizationResponse, error) {
+	memberships, err := ogs.OrganizationRepository.ListMemberships(userID)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]models.OrganizationResponse, 0, len(memberships))
+	for _, membership := range memberships {
+		responses = append(responses, models.OrganizationResponse{
+			ID:        membership.Organization.ID,
+			Name:      membership.Organization.Name,
+			Slug:      membership.Organization.Slug,
+			Roles:     roleNames(membership.Roles),
+			Active:    membership.OrganizationID == activeOrgID,
+			CreatedAt: membership.Organization.CreatedAt,
+		})
+	}
+	return responses, nil
+}
+
+// GetOrganization returns an organization the caller belongs to.
+func (ogs *OrganizationService) GetOrganization(scope OrgScope, userID, orgID uint) (*models.OrganizationResponse, error) {
+	org, err := ogs.OrganizationRepository.GetByID(orgID)
+	if err != nil {
+		return nil, ErrOrganizationNotFound
+	}
+	response := &models.OrganizationResponse{
+		ID:        org.ID,
+		Name:      org.Name,
+		Slug:      org.Slug,
+		Active:    org.ID == scope.OrganizationID,
+		CreatedAt: org.CreatedAt,
+	}
+	if _, err := ogs.OrganizationRepository.GetMembership(orgID, userID); err != nil {
+		if !scope.All {
+			return nil, ErrOrganizationNotFound
+		}
+		return response, nil
+	}
+	roles, err := ogs.RoleRepository.ListMembershipRoles(orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	response.Roles = roleNames(roles)
+	return response, nil
+}
+
+func (ogs *OrganizationService) UpdateOrganization(orgID uint, input models.UpdateOrganizationInput) error {
+	if _, err := ogs.OrganizationRepository.GetByID(orgID); err != nil {
+		return ErrOrganizationNotFound
+	}
+	return ogs.OrganizationRepository.UpdateName(orgID, input.Name)
+}
+
+// SwitchOrganization makes another organization the active one of the
+// caller's session and issues tokens for it. Callers with
+// organizations:manage can switch to organizations they do not belong to.
+func (ogs *OrganizationService) SwitchOrganization(scope OrgScope, userID uint, sessionID string, orgID uint) (string, string, error) {
+	if _, err := ogs.OrganizationRepository.GetByID(orgID); err != nil {
+		return "", "", ErrOrganizationNotFound
+	}
+	if _, err := ogs.OrganizationRepository.GetMembership(orgID, userID); err != nil && !scope.All {
+		return "", "", ErrOrganizationNotFound
+	}
+	user, err := ogs.UserRepository.GetByID(userID)
+	if err != nil {
+		return "", "", ErrUserNotFound
+	}
+	if err := ogs.SessionRepository.SetOrganization(sessionID, &orgID); err != nil {
+		return "", "", err
+	}
+	return ogs.TokenService.IssueSessionTokens(user, sessionID)
+}
+
+func (ogs *OrganizationService) ListMembers(orgID uint) ([]models.MemberResponse, error) {
+	memberships, err := ogs.OrganizationRepository.ListMembers(orgID)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]models.MemberResponse, 0, len(memberships))
+	for _, membership := range memberships {
+		responses = append(responses, models.MemberResponse{
+			UserID:   membership.UserID,
+			Email:    membership.User.Email,
+			Name:     membership.User.Name,
+			Roles:    roleNames(membership.Roles),
+			Active:   membership.DeactivatedAt == nil,
+			JoinedAt: membership.CreatedAt,
+		})
+	}
+	return responses, nil
+}
+
+// RemoveMember takes a user out of an organization. The last owner cannot
+// be removed, so an organization always has someone who can manage it.
+func (ogs *OrganizationService) RemoveMember(orgID, userID uint, info RequestInfo) error {
+	membership, err := ogs.OrganizationRepository.GetMembership(orgID, userID)
+	if err != nil {
+		return ErrNotMember
+	}
+	roles, err := ogs.RoleRepository.ListMembershipRoles(orgID, userID)
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if role.Name == models.OrgOwnerRole {
+			if err := ensureNotLastHolder(ogs.RoleRepository, &role, ErrLastOwner); err != nil {
+				return err
+			}
+		}
+	}
+	if err := ogs.OrganizationRepository.RemoveMember(membership); err != nil {
+		return err
+	}
+	ogs.AuditService.Record(info, models.AuditMemberRemoved, models.AuditTargetUser, userID, map[string]interface{}{
+		"organization_id": orgID,
+		"roles":           models.AuditChange{From: roleNames(roles)},
+	})
+	return nil
+}
+
+// UserInScope reports whether an admin acting in scope may manage the user,
+// that is whether the user belongs to the scope's organization.
+func (ogs *OrganizationService) UserInScope(scope OrgScope, userID uint) (bool, error) {
+	if scope.All {
+		return true, nil
+	}
+	if scope.OrganizationID == 0 {
+		return false, nil
+	}
+	if _, err := ogs.OrganizationRepository.GetMembership(scope.OrganizationID, userID); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+// ensureNotLastHolder fails with err when at most one user holds the role.
+func ensureNotLastHolder(rr *repositories.RoleRepository, role *models.Role, err error) error {
+	count, countErr := rr.CountUsersWithRole(role)
+	if countErr != nil {
+		return countErr
+	}
+	if count <= 1 {
+		return err
+	}
+	return nil
+}
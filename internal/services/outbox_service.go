@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+	"user-service/pkg/mailer"
+)
+
+const (
+	outboxPollInterval = time.Second * 10
+	outboxBatchSize    = 20
+	// outboxLease is how long a claimed email is hidden from other workers
+	// while it is being sent.
+	outboxLease       = time.Minute * 2
+	outboxMaxAttempts = 8
+	outboxBaseBackoff = time.Second * 30
+	outboxMaxBackoff  = time.Hour
+	// outboxRetention is how long sent and failed emails are kept.
+	outboxRetention = time.Hour * 24 * 7
+)
+
+// OutboxService queues emails in the database and delivers them in the
+// background, so a slow or failing mail server never fails a request.
+type OutboxService struct {
+	OutboxRepository *repositories.OutboxRepository
+	Mailer           mailer.Mailer
+}
+
+func NewOutboxService(or *repositories.OutboxRepository, m mailer.Mailer) *OutboxService {
+	return &OutboxService{OutboxRepository: or, Mailer: m}
+}
+
+// Enqueue renders the named template in the recipient's locale and stores
+// the result for delivery.
+func (obs *OutboxService) Enqueue(to, template, locale string, data interface{}) error {
+	msg, err := mailer.Render(template, locale, data)
+	if err != nil {
+		return err
+	}
+	return obs.OutboxRepository.Create(&models.OutboxEmail{
+		Recipient:     to,
+		Subject:       msg.Subject,
+		TextBody:      msg.Text,
+		HTMLBody:      msg.HTML,
+		Status:        models.OutboxStatusPending,
+		NextAttemptAt: time.Now(),
+	})
+}
+
+// Run delivers due emails until ctx is cancelled.
+func (obs *OutboxService) Run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	for {
+		obs.DeliverDue()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue sends one batch of due emails and schedules retries for the
+// ones that fail. Finished emails past outboxRetention are removed.
+func (obs *OutboxService) DeliverDue() {
+	if err := obs.OutboxRepository.DeleteFinished(time.Now().Add(-outboxRetention)); err != nil {
+		log.Printf("outbox: failed to remove finished emails: %v", err)
+	}
+	emails, err := obs.OutboxRepository.ClaimDue(outboxBatchSize, outboxLease)
+	if err != nil {
+		log.Printf("outbox: failed to load pending emails: %v", err)
+		return
+	}
+	for _, email := range emails {
+		sendErr := obs.Mailer.Send(mailer.Message{
+			To:      email.Recipient,
+			Subject: email.Subject,
+			Text:    email.TextBody,
+			HTML:    email.HTMLBody,
+		})
+		if sendErr == nil {
+			err = obs.OutboxRepository.MarkSent(email.ID)
+		} else {
+			attempts := email.Attempts + 1
+			var next time.Time
+			if attempts < outboxMaxAttempts {
+				next = time.Now().Add(outboxBackoff(attempts))
+			}
+			log.Printf("outbox: sending email %d failed (attempt %d): %v", email.ID, attempts, sendErr)
+			err = obs.OutboxRepository.MarkAttemptFailed(email.ID, attempts, sendErr.Error(), next)
+		}
+		if err != nil {
+			log.Printf("outbox: failed to update email %d: %v", email.ID, err)
+		}
+	}
+}
+
+// outboxBackoff doubles the delay after every failed attempt, up to
+// outboxMaxBackoff.
+func outboxBackoff(attempts int) time.Duration {
+	delay := outboxBaseBackoff << (attempts - 1)
+	if delay <= 0 || delay > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, outboxBaseBackoff},
+		{2, 2 * outboxBaseBackoff},
+		{3, 4 * outboxBaseBackoff},
+		{7, 64 * outboxBaseBackoff},
+		{outboxMaxAttempts, outboxMaxBackoff},
+		// Large shifts overflow; they must still be capped.
+		{70, outboxMaxBackoff},
+	}
+	for _, tt := range tests {
+		if got := outboxBackoff(tt.attempts); got != tt.want {
+			t.Errorf("outboxBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"time"
+	"user-service/config"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+	"user-service/utils"
+)
+
+const passwordResetExpiry = time.Hour
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+type PasswordService struct {
+	UserRepository  *repositories.UserRepository
+	TokenRepository *repositories.TokenRepository
+	SessionService  *SessionService
+	OutboxService   *OutboxService
+	AuditService    *AuditService
+}
+
+func NewPasswordService(ur *repositories.UserRepository, tr *repositories.TokenRepository, ss *SessionService, obs *OutboxService, as *AuditService) *PasswordService {
+	return &PasswordService{UserRepository: ur, TokenRepository: tr, SessionService: ss, OutboxService: obs, AuditService: as}
+}
+
+// ForgotPassword emails a reset link to the user with this address. Unknown
+// addresses are silently ignored so the endpoint cannot be used to find out
+// which emails are registered.
+func (ps *PasswordService) ForgotPassword(email string) error {
+	user, err := ps.UserRepository.GetByEmail(email)
+	if err != nil {
+		return nil
+	}
+
+	token, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return err
+	}
+	reset := models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(passwordResetExpiry),
+	}
+	if err := ps.TokenRepository.CreatePasswordResetToken(&reset); err != nil {
+		return err
+	}
+
+	return ps.OutboxService.Enqueue(user.Email, "password_reset", user.Locale, map[string]interface{}{
+		"Name":             user.Name,
+		"Link":             passwordResetLink(token),
+		"ExpiresInMinutes": int(passwordResetExpiry.Minutes()),
+	})
+}
+
+// ResetPassword sets a new password using a reset token and signs the user
+// out of every session.
+func (ps *PasswordService) ResetPassword(token, newPassword string, info RequestInfo) error {
+	reset, err := ps.TokenRepository.GetPasswordResetTokenByHash(utils.HashToken(token))
+	if err != nil || reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+	ok, err := ps.TokenRepository.UsePasswordResetTokens(reset.UserID, reset.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidResetToken
+	}
+
+	user, err := ps.UserRepository.GetByID(reset.UserID)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	user.Password = hashedPassword
+	if err := ps.UserRepository.Update(user); err != nil {
+		return err
+	}
+	info.UserID = user.ID
+	ps.AuditService.Record(info, models.AuditPasswordReset, models.AuditTargetUser, user.ID, nil)
+	return ps.SessionService.RevokeAllSessions(user.ID, "")
+}
+
+func passwordResetLink(token string) string {
+	return tokenLink(config.AppConfig.PasswordResetURL, "http://localhost:3000/reset-password", token)
+}
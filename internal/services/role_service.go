@@ -0,0 +1,345 @@
+package services
+
+import (
+	"errors"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+)
+
+var (
+	ErrRoleNotFound          = errors.New("role not found")
+	ErrRoleExists            = errors.New("role already exists")
+	ErrSystemRole            = errors.New("system role cannot be changed")
+	ErrUnknownPermission     = errors.New("unknown permission")
+	ErrPermissionNotAllowed  = errors.New("permission can only be granted by a global role")
+	ErrRoleNotAssigned       = errors.New("role is not assigned to the user")
+	ErrLastAdmin             = errors.New("cannot remove the last admin")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrNoActiveOrganization  = errors.New("no active organization")
+	ErrGlobalRolesNotAllowed = errors.New("global roles require organizations:manage")
+)
+
+// RoleService manages roles, their permissions and role assignments. Every
+// operation works in a scope: callers see and assign the roles of their
+// active organization, and only holders of organizations:manage see and
+// assign global roles.
+type RoleService struct {
+	RoleRepository         *repositories.RoleRepository
+	UserRepository         *repositories.UserRepository
+	OrganizationRepository *repositories.OrganizationRepository
+	AuditService           *AuditService
+}
+
+func NewRoleService(rr *repositories.RoleRepository, ur *repositories.UserRepository, or *repositories.OrganizationRepository, as *AuditService) *RoleService {
+	return &RoleService{RoleRepository: rr, UserRepository: ur, OrganizationRepository: or, AuditService: as}
+}
+
+// EnsureDefaults seeds the permissions and built-in roles and converts the
+// role column of older databases. It runs on startup after migrations.
+func (rs *RoleService) EnsureDefaults() error {
+	if err := rs.RoleRepository.SeedDefaults(); err != nil {
+		return err
+	}
+	return rs.RoleRepository.MigrateLegacyRoles()
+}
+
+// ListRoles returns the roles of the active organization, preceded by the
+// global roles when the scope allows them.
+func (rs *RoleService) ListRoles(scope OrgScope) ([]models.RoleResponse, error) {
+	var roles []models.Role
+	if scope.All {
+		global, err := rs.RoleRepository.List(nil)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, global...)
+	}
+	if scope.OrganizationID != 0 {
+		orgRoles, err := rs.RoleRepository.List(&scope.OrganizationID)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, orgRoles...)
+	}
+	return newRoleResponses(roles), nil
+}
+
+func (rs *RoleService) ListPermissions() ([]models.Permission, error) {
+	return rs.RoleRepository.ListPermissions()
+}
+
+// CreateRole creates a role in the active organization, or a global role
+// when input.Global is set or a caller managing all organizations has none
+// active.
+func (rs *RoleService) CreateRole(scope OrgScope, input models.CreateRoleInput, info RequestInfo) (*models.RoleResponse, error) {
+	var organizationID *uint
+	switch {
+	case input.Global && !scope.All:
+		return nil, ErrGlobalRolesNotAllowed
+	case input.Global, scope.OrganizationID == 0 && scope.All:
+	case scope.OrganizationID == 0:
+		return nil, ErrNoActiveOrganization
+	default:
+		organizationID = &scope.OrganizationID
+	}
+	if _, err := rs.RoleRepository.GetByName(organizationID, input.Name); err == nil {
+		return nil, ErrRoleExists
+	}
+	permissions, err := rs.permissions(organizationID, input.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	role := models.Role{OrganizationID: organizationID, Name: input.Name, Description: input.Description, Permissions: permissions}
+	if err := rs.RoleRepository.Create(&role); err != nil {
+		return nil, err
+	}
+	response := newRoleResponse(role)
+	rs.AuditService.Record(info, models.AuditRoleCreated, models.AuditTargetRole, role.ID, map[string]interface{}{
+		"name":            role.Name,
+		"organization_id": role.OrganizationID,
+		"permissions":     models.AuditChange{To: response.Permissions},
+	})
+	return &response, nil
+}
+
+// UpdateRole changes a role's description and, when given, replaces its
+// permissions. The admin and owner roles always keep every permission.
+func (rs *RoleService) UpdateRole(scope OrgScope, name string, input models.UpdateRoleInput, info RequestInfo) (*models.RoleResponse, error) {
+	role, err := rs.findRole(scope, name)
+	if err != nil {
+		return nil, err
+	}
+	if role.System && (role.Name == models.AdminRole || role.Name == models.OrgOwnerRole) {
+		return nil, ErrSystemRole
+	}
+	var permissions []models.Permission
+	if input.Permissions != nil {
+		if permissions, err = rs.permissions(role.OrganizationID, input.Permissions); err != nil {
+			return nil, err
+		}
+	}
+	before := newRoleResponse(*role)
+	if input.Description != nil {
+		role.Description = *input.Description
+	}
+	if err := rs.RoleRepository.Update(role, permissions); err != nil {
+		return nil, err
+	}
+	if permissions != nil {
+		role.Permissions = permissions
+	}
+	response := newRoleResponse(*role)
+	changes := map[string]interface{}{"name": role.Name, "organization_id": role.OrganizationID}
+	if before.Description != response.Description {
+		changes["description"] = models.AuditChange{From: before.Description, To: response.Description}
+	}
+	if permissions != nil {
+		changes["permissions"] = models.AuditChange{From: before.Permissions, To: response.Permissions}
+	}
+	rs.AuditService.Record(info, models.AuditRoleUpdated, models.AuditTargetRole, role.ID, changes)
+	return &response, nil
+}
+
+func (rs *RoleService) DeleteRole(scope OrgScope, name string, info RequestInfo) error {
+	role, err := rs.findRole(scope, name)
+	if err != nil {
+		return err
+	}
+	if role.System {
+		return ErrSystemRole
+	}
+	if err := rs.RoleRepository.Delete(role); err != nil {
+		return err
+	}
+	rs.AuditService.Record(info, models.AuditRoleDeleted, models.AuditTargetRole, role.ID, map[string]interface{}{
+		"name":            role.Name,
+		"organization_id": role.OrganizationID,
+	})
+	return nil
+}
+
+// ListUserRoles returns the user's roles in the active organization, and
+// their global roles when the scope allows them.
+func (rs *RoleService) ListUserRoles(scope OrgScope, userID uint) ([]models.RoleResponse, error) {
+	if _, err := rs.UserRepository.GetByID(userID); err != nil {
+		return nil, ErrUserNotFound
+	}
+	var roles []models.Role
+	if scope.All {
+		global, err := rs.RoleRepository.ListUserRoles(userID)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, global...)
+	}
+	if scope.OrganizationID != 0 {
+		orgRoles, err := rs.RoleRepository.ListMembershipRoles(scope.OrganizationID, userID)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, orgRoles...)
+	}
+	return newRoleResponses(roles), nil
+}
+
+// AssignRole gives a role to a user: a global role directly, an
+// organization role through the user's membership.
+func (rs *RoleService) AssignRole(scope OrgScope, info RequestInfo, userID uint, roleName string) error {
+	if _, err := rs.UserRepository.GetByID(userID); err != nil {
+		return ErrUserNotFound
+	}
+	role, err := rs.findRole(scope, roleName)
+	if err != nil {
+		return err
+	}
+	if role.OrganizationID == nil {
+		err = rs.RoleRepository.AssignRole(userID, role.ID)
+	} else {
+		var membership *models.Membership
+		membership, err = rs.OrganizationRepository.GetMembership(*role.OrganizationID, userID)
+		if err != nil {
+			return ErrNotMember
+		}
+		err = rs.RoleRepository.AssignMembershipRole(membership.ID, role.ID)
+	}
+	if err != nil {
+		return err
+	}
+	rs.AuditService.Record(info, models.AuditRoleAssigned, models.AuditTargetUser, userID, roleChange(role, nil, role.Name))
+	return nil
+}
+
+// RemoveRole takes a role from a user. The admin role cannot be taken from
+// its last holder, nor an organization's owner role from its last owner, so
+// nobody is locked out of administration.
+func (rs *RoleService) RemoveRole(scope OrgScope, info RequestInfo, userID uint, roleName string) error {
+	role, err := rs.findRole(scope, roleName)
+	if err != nil {
+		return err
+	}
+	if role.OrganizationID == nil {
+		held, err := rs.RoleRepository.ListUserRoles(userID)
+		if err != nil {
+			return err
+		}
+		if !hasRole(held, role.ID) {
+			return ErrRoleNotAssigned
+		}
+		if role.Name == models.AdminRole {
+			if err := ensureNotLastHolder(rs.RoleRepository, role, ErrLastAdmin); err != nil {
+				return err
+			}
+		}
+		if _, err := rs.RoleRepository.RemoveRole(userID, role.ID); err != nil {
+			return err
+		}
+		rs.AuditService.Record(info, models.AuditRoleRemoved, models.AuditTargetUser, userID, roleChange(role, role.Name, nil))
+		return nil
+	}
+
+	membership, err := rs.OrganizationRepository.GetMembership(*role.OrganizationID, userID)
+	if err != nil {
+		return ErrRoleNotAssigned
+	}
+	held, err := rs.RoleRepository.ListMembershipRoles(*role.OrganizationID, userID)
+	if err != nil {
+		return err
+	}
+	if !hasRole(held, role.ID) {
+		return ErrRoleNotAssigned
+	}
+	if role.Name == models.OrgOwnerRole && role.System {
+		if err := ensureNotLastHolder(rs.RoleRepository, role, ErrLastOwner); err != nil {
+			return err
+		}
+	}
+	if _, err := rs.RoleRepository.RemoveMembershipRole(membership.ID, role.ID); err != nil {
+		return err
+	}
+	rs.AuditService.Record(info, models.AuditRoleRemoved, models.AuditTargetUser, userID, roleChange(role, role.Name, nil))
+	return nil
+}
+
+// roleChange describes a role assignment for the audit log.
+func roleChange(role *models.Role, from, to interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"role":            models.AuditChange{From: from, To: to},
+		"organization_id": role.OrganizationID,
+	}
+}
+
+func hasRole(roles []models.Role, roleID uint) bool {
+	for _, role := range roles {
+		if role.ID == roleID {
+			return true
+		}
+	}
+	return false
+}
+
+func (rs *RoleService) findRole(scope OrgScope, name string) (*models.Role, error) {
+	return findRole(rs.RoleRepository, scope, name)
+}
+
+// findRole looks a role up in the active organization first and then, when
+// the scope allows it, among the global roles.
+func findRole(rr *repositories.RoleRepository, scope OrgScope, name string) (*models.Role, error) {
+	if scope.OrganizationID != 0 {
+		if role, err := rr.GetByName(&scope.OrganizationID, name); err == nil {
+			return role, nil
+		}
+	}
+	if scope.All {
+		if role, err := rr.GetByName(nil, name); err == nil {
+			return role, nil
+		}
+	}
+	return nil, ErrRoleNotFound
+}
+
+// permissions loads the named permissions, rejecting names that are not in
+// the catalog and, for organization roles, organizations:manage.
+func (rs *RoleService) permissions(organizationID *uint, names []string) ([]models.Permission, error) {
+	permissions, err := rs.RoleRepository.GetPermissionsByNames(names)
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]bool{}
+	for _, permission := range permissions {
+		found[permission.Name] = true
+	}
+	for _, name := range names {
+		if !found[name] {
+			return nil, ErrUnknownPermission
+		}
+		if organizationID != nil && name == models.PermOrganizationsManage {
+			return nil, ErrPermissionNotAllowed
+		}
+	}
+	return permissions, nil
+}
+
+func newRoleResponse(role models.Role) models.RoleResponse {
+	permissions := make([]string, 0, len(role.Permissions))
+	for _, permission := range role.Permissions {
+		permissions = append(permissions, permission.Name)
+	}
+	return models.RoleResponse{
+		ID:             role.ID,
+		OrganizationID: role.OrganizationID,
+		Name:           role.Name,
+		Description:    role.Description,
+		System:         role.System,
+		Permissions:    permissions,
+		CreatedAt:      role.CreatedAt,
+		UpdatedAt:      role.UpdatedAt,
+	}
+}
+
+func newRoleResponses(roles []models.Role) []models.RoleResponse {
+	responses := make([]models.RoleResponse, 0, len(roles))
+	for _, role := range roles {
+		responses = append(responses, newRoleResponse(role))
+	}
+	return responses
+}
@@ -0,0 +1,127 @@
+package services
+
+import "user-service/internal/models"
+
+// SCIMServiceProviderConfig describes the SCIM features the service
+// supports (RFC 7643 section 5).
+func SCIMServiceProviderConfig(baseURL string) map[string]interface{} {
+	return map[string]interface{}{
+		"schemas":          []string{models.SCIMServiceConfigSchema},
+		"documentationUri": baseURL + "/swagger/index.html",
+		"patch":            map[string]bool{"supported": true},
+		"bulk":             map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           map[string]interface{}{"supported": true, "maxResults": SCIMMaxCount},
+		"changePassword":   map[string]bool{"supported": true},
+		"sort":             map[string]bool{"supported": false},
+		"etag":             map[string]bool{"supported": false},
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "A SCIM token created by an organization owner",
+			"primary":     true,
+		}},
+		"meta": map[string]string{"resourceType": "ServiceProviderConfig", "location": baseURL + "/scim/v2/ServiceProviderConfig"},
+	}
+}
+
+// SCIMResourceTypes lists the User and Group resource types (RFC 7643
+// section 6).
+func SCIMResourceTypes(baseURL string) []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"schemas":     []string{models.SCIMResourceTypeSchema},
+			"id":          "User",
+			"name":        "User",
+			"endpoint":    "/Users",
+			"description": "Organization members",
+			"schema":      models.SCIMUserSchema,
+			"meta":        map[string]string{"resourceType": "ResourceType", "location": baseURL + "/scim/v2/ResourceTypes/User"},
+		},
+		{
+			"schemas":     []string{models.SCIMResourceTypeSchema},
+			"id":          "Group",
+			"name":        "Group",
+			"endpoint":    "/Groups",
+			"description": "Organization roles",
+			"schema":      models.SCIMGroupSchema,
+			"meta":        map[string]string{"resourceType": "ResourceType", "location": baseURL + "/scim/v2/ResourceTypes/Group"},
+		},
+	}
+}
+
+// SCIMSchemas describes the attributes of the User and Group resources as
+// the service supports them (RFC 7643 section 7).
+func SCIMSchemas(baseURL string) []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"schemas":     []string{models.SCIMSchemaDefinitionURN},
+			"id":          models.SCIMUserSchema,
+			"name":        "User",
+			"description": "Organization member",
+			"attributes": []map[string]interface{}{
+				scimAttribute("userName", "string", true, "readWrite", "server"),
+				{
+					"name": "name", "type": "complex", "multiValued": false, "required": false, "mutability": "readWrite", "returned": "default",
+					"subAttributes": []map[string]interface{}{
+						scimAttribute("formatted", "string", false, "readWrite", "none"),
+						scimAttribute("givenName", "string", false, "writeOnly", "none"),
+						scimAttribute("familyName", "string", false, "writeOnly", "none"),
+					},
+				},
+				scimAttribute("displayName", "string", false, "readWrite", "none"),
+				{
+					"name": "emails", "type": "complex", "multiValued": true, "required": false, "mutability": "readWrite", "returned": "default",
+					"subAttributes": []map[string]interface{}{
+						scimAttribute("value", "string", false, "readWrite", "server"),
+						scimAttribute("type", "string", false, "readWrite", "none"),
+						scimAttribute("primary", "boolean", false, "readWrite", "none"),
+					},
+				},
+				scimAttribute("active", "boolean", false, "readWrite", "none"),
+				scimAttribute("password", "string", false, "writeOnly", "none"),
+				{
+					"name": "groups", "type": "complex", "multiValued": true, "required": false, "mutability": "readOnly", "returned": "default",
+					"subAttributes": []map[string]interface{}{
+						scimAttribute("value", "string", false, "readOnly", "none"),
+						scimAttribute("display", "string", false, "readOnly", "none"),
+					},
+				},
+			},
+			"meta": map[string]string{"resourceType": "Schema", "location": baseURL + "/scim/v2/Schemas/" + models.SCIMUserSchema},
+		},
+		{
+			"schemas":     []string{models.SCIMSchemaDefinitionURN},
+			"id":          models.SCIMGroupSchema,
+			"name":        "Group",
+			"description": "Organization role",
+			"attributes": []map[string]interface{}{
+				scimAttribute("displayName", "string", true, "readWrite", "server"),
+				{
+					"name": "members", "type": "complex", "multiValued": true, "required": false, "mutability": "readWrite", "returned": "default",
+					"subAttributes": []map[string]interface{}{
+						scimAttribute("value", "string", false, "immutable", "none"),
+						scimAttribute("display", "string", false, "readOnly", "none"),
+					},
+				},
+			},
+			"meta": map[string]string{"resourceType": "Schema", "location": baseURL + "/scim/v2/Schemas/" + models.SCIMGroupSchema},
+		},
+	}
+}
+
+func scimAttribute(name, kind string, required bool, mutability, uniqueness string) map[string]interface{} {
+	returned := "default"
+	if mutability == "writeOnly" {
+		returned = "never"
+	}
+	return map[string]interface{}{
+		"name":        name,
+		"type":        kind,
+		"multiValued": false,
+		"required":    required,
+		"caseExact":   false,
+		"mutability":  mutability,
+		"returned":    returned,
+		"uniqueness":  uniqueness,
+	}
+}
@@ -0,0 +1,875 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+	"user-service/utils"
+)
+
+const (
+	SCIMDefaultCount = 100
+	SCIMMaxCount     = 200
+)
+
+var (
+	ErrInvalidSCIMToken  = errors.New("invalid scim token")
+	ErrSCIMTokenNotFound = errors.New("scim token not found")
+)
+
+// SCIMError is reported to SCIM clients in the error format of RFC 7644
+// section 3.12. Type is the scimType of 400 errors.
+type SCIMError struct {
+	Status int
+	Type   string
+	Detail string
+}
+
+func (e *SCIMError) Error() string {
+	return e.Detail
+}
+
+func newSCIMError(status int, scimType, detail string) *SCIMError {
+	return &SCIMError{Status: status, Type: scimType, Detail: detail}
+}
+
+var (
+	errSCIMUserNotFound  = newSCIMError(http.StatusNotFound, "", "User not found")
+	errSCIMGroupNotFound = newSCIMError(http.StatusNotFound, "", "Group not found")
+	errSCIMNotManaged    = newSCIMError(http.StatusBadRequest, "mutability", "The account was not provisioned by this organization; only externalId, active and groups can be changed")
+	errSCIMLastOwner     = newSCIMError(http.StatusBadRequest, "mutability", "The organization must keep an active owner")
+)
+
+// scimFilterPattern matches the only filter form supported: an attribute
+// compared with "eq" to a string.
+var scimFilterPattern = regexp.MustCompile(`(?i)^\s*([a-z.]+)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// SCIMService implements SCIM 2.0 provisioning for an organization. Users
+// are the organization's members and groups are its roles. Deleting a user
+// only ends the membership; the account itself is kept.
+type SCIMService struct {
+	SCIMRepository         *repositories.SCIMRepository
+	OrganizationRepository *repositories.OrganizationRepository
+	RoleRepository         *repositories.RoleRepository
+	UserRepository         *repositories.UserRepository
+	AuditService           *AuditService
+}
+
+func NewSCIMService(sr *repositories.SCIMRepository, or *repositories.OrganizationRepository, rr *repositories.RoleRepository, ur *repositories.UserRepository, as *AuditService) *SCIMService {
+	return &SCIMService{SCIMRepository: sr, OrganizationRepository: or, RoleRepository: rr, UserRepository: ur, AuditService: as}
+}
+
+// CreateToken creates a bearer token for the organization's identity
+// provider. The plain token is only returned here.
+func (scs *SCIMService) CreateToken(orgID uint, name string, info RequestInfo) (*models.SCIMTokenResponse, error) {
+	raw, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	token := models.SCIMToken{OrganizationID: orgID, Name: name, TokenHash: utils.HashToken(raw)}
+	if err := scs.SCIMRepository.CreateToken(&token); err != nil {
+		return nil, err
+	}
+	info.OrganizationID = orgID
+	scs.AuditService.Record(info, models.AuditSCIMTokenCreated, models.AuditTargetSCIMToken, token.ID, map[string]string{"name": name})
+	response := newSCIMTokenResponse(&token)
+	response.Token = raw
+	return &response, nil
+}
+
+func (scs *SCIMService) ListTokens(orgID uint) ([]models.SCIMTokenResponse, error) {
+	tokens, err := scs.SCIMRepository.ListTokens(orgID)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]models.SCIMTokenResponse, 0, len(tokens))
+	for i := range tokens {
+		responses = append(responses, newSCIMTokenResponse(&tokens[i]))
+	}
+	return responses, nil
+}
+
+func (scs *SCIMService) DeleteToken(orgID, id uint, info RequestInfo) error {
+	deleted, err := scs.SCIMRepository.DeleteToken(orgID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrSCIMTokenNotFound
+	}
+	info.OrganizationID = orgID
+	scs.AuditService.Record(info, models.AuditSCIMTokenDeleted, models.AuditTargetSCIMToken, id, nil)
+	return nil
+}
+
+// Authenticate returns the organization a SCIM bearer token belongs to.
+func (scs *SCIMService) Authenticate(raw string) (uint, error) {
+	token, err := scs.SCIMRepository.GetTokenByHash(utils.HashToken(raw))
+	if err != nil {
+		return 0, ErrInvalidSCIMToken
+	}
+	if err := scs.SCIMRepository.TouchToken(token.ID); err != nil {
+		return 0, err
+	}
+	return token.OrganizationID, nil
+}
+
+// ListUsers lists the organization's members. Filters compare userName,
+// emails.value, externalId or id with "eq".
+func (scs *SCIMService) ListUsers(orgID uint, filter string, startIndex, count int) (*models.SCIMListResponse, error) {
+	where, err := parseSCIMFilter(filter, map[string]string{
+		"id":           "memberships.user_id",
+		"username":     "User.email",
+		"emails":       "User.email",
+		"emails.value": "User.email",
+		"externalid":   "memberships.external_id",
+	})
+	if err != nil {
+		return nil, err
+	}
+	startIndex, count = scimPage(startIndex, count)
+	memberships, total, err := scs.SCIMRepository.ListMembers(orgID, where, startIndex-1, count)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]models.SCIMUser, 0, len(memberships))
+	for i := range memberships {
+		users = append(users, newSCIMUser(&memberships[i]))
+	}
+	return newSCIMListResponse(users, len(users), total, startIndex), nil
+}
+
+func (scs *SCIMService) GetUser(orgID uint, id string) (*models.SCIMUser, error) {
+	membership, err := scs.member(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	user := newSCIMUser(membership)
+	return &user, nil
+}
+
+// CreateUser provisions a member by creating a new account, which the
+// organization then manages. An account that already exists with the email
+// belongs to its user and is refused; it joins through an invitation.
+func (scs *SCIMService) CreateUser(orgID uint, input models.SCIMUser, info RequestInfo) (*models.SCIMUser, error) {
+	email, err := scimUserEmail(input)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := scs.SCIMRepository.GetMembershipByUserEmail(orgID, email); err == nil {
+		return nil, newSCIMError(http.StatusConflict, "uniqueness", "A user with this userName already exists")
+	}
+	memberRole, err := scs.RoleRepository.GetByName(&orgID, models.OrgMemberRole)
+	if err != nil {
+		return nil, err
+	}
+
+	membership := models.Membership{OrganizationID: orgID, ExternalID: input.ExternalID}
+	if input.Active != nil && !*input.Active {
+		now := time.Now()
+		membership.DeactivatedAt = &now
+	}
+	if _, err := scs.UserRepository.GetByEmail(email); err == nil {
+		return nil, newSCIMError(http.StatusConflict, "uniqueness", "An account with this userName already exists; invite it to the organization instead")
+	}
+	user := &models.User{Email: email, Name: scimDisplayName(input, email)}
+	if input.Password != "" {
+		if user.Password, err = utils.HashPassword(input.Password); err != nil {
+			return nil, err
+		}
+	}
+	membership.Provisioned = true
+	if err := scs.SCIMRepository.Provision(user, &membership, []uint{memberRole.ID}); err != nil {
+		return nil, err
+	}
+	scs.AuditService.Record(info, models.AuditSCIMUserCreated, models.AuditTargetUser, user.ID, map[string]interface{}{
+		"organization_id": orgID,
+		"email":           models.AuditChange{To: user.Email},
+		"active":          membership.DeactivatedAt == nil,
+	})
+	return scs.GetUser(orgID, strconv.FormatUint(uint64(user.ID), 10))
+}
+
+// ReplaceUser replaces a member's attributes. Omitting active reactivates
+// the member.
+func (scs *SCIMService) ReplaceUser(orgID uint, id string, input models.SCIMUser, info RequestInfo) (*models.SCIMUser, error) {
+	membership, err := scs.member(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	return scs.updateUser(membership, input, info)
+}
+
+// PatchUser applies PATCH operations to a member. Attributes the service
+// does not store are ignored.
+func (scs *SCIMService) PatchUser(orgID uint, id string, request models.SCIMPatchRequest, info RequestInfo) (*models.SCIMUser, error) {
+	membership, err := scs.member(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	user := newSCIMUser(membership)
+	for _, operation := range request.Operations {
+		if err := patchSCIMUser(&user, operation); err != nil {
+			return nil, err
+		}
+	}
+	return scs.updateUser(membership, user, info)
+}
+
+// DeleteUser removes the member from the organization.
+func (scs *SCIMService) DeleteUser(orgID uint, id string, info RequestInfo) error {
+	membership, err := scs.member(orgID, id)
+	if err != nil {
+		return err
+	}
+	if err := scs.ensureOwnerRemains(membership); err != nil {
+		return err
+	}
+	if err := scs.SCIMRepository.RemoveMember(membership); err != nil {
+		return err
+	}
+	scs.AuditService.Record(info, models.AuditSCIMUserRemoved, models.AuditTargetUser, membership.UserID, map[string]interface{}{
+		"organization_id": orgID,
+	})
+	return nil
+}
+
+// updateUser applies the attributes to the member and audits what changed.
+func (scs *SCIMService) updateUser(membership *models.Membership, input models.SCIMUser, info RequestInfo) (*models.SCIMUser, error) {
+	email, err := scimUserEmail(input)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	if !strings.EqualFold(email, membership.User.Email) {
+		if err := scs.UserRepository.CheckEmailExist(&models.User{Email: email}); err != nil {
+			return nil, newSCIMError(http.StatusConflict, "uniqueness", "A user with this userName already exists")
+		}
+		values["email"] = email
+		values["email_verified_at"] = nil
+	}
+	if name := scimDisplayName(input, email); name != membership.User.Name {
+		values["name"] = name
+	}
+	if input.Password != "" {
+		hashedPassword, err := utils.HashPassword(input.Password)
+		if err != nil {
+			return nil, err
+		}
+		values["password"] = hashedPassword
+	}
+	if len(values) > 0 && !membership.Provisioned {
+		return nil, errSCIMNotManaged
+	}
+
+	changes := map[string]interface{}{}
+	if email, ok := values["email"]; ok {
+		changes["email"] = models.AuditChange{From: membership.User.Email, To: email}
+	}
+	if name, ok := values["name"]; ok {
+		changes["name"] = models.AuditChange{From: membership.User.Name, To: name}
+	}
+	if _, ok := values["password"]; ok {
+		changes["password"] = "changed"
+	}
+	if input.ExternalID != membership.ExternalID {
+		changes["external_id"] = models.AuditChange{From: membership.ExternalID, To: input.ExternalID}
+	}
+	wasActive := membership.DeactivatedAt == nil
+
+	membership.ExternalID = input.ExternalID
+	active := input.Active == nil || *input.Active
+	switch {
+	case active:
+		membership.DeactivatedAt = nil
+	case membership.DeactivatedAt == nil:
+		if err := scs.ensureOwnerRemains(membership); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		membership.DeactivatedAt = &now
+	}
+	if err := scs.SCIMRepository.UpdateMember(membership, values); err != nil {
+		return nil, err
+	}
+	if active != wasActive {
+		changes["active"] = models.AuditChange{From: wasActive, To: active}
+	}
+	if len(changes) > 0 {
+		changes["organization_id"] = membership.OrganizationID
+		scs.AuditService.Record(info, models.AuditSCIMUserUpdated, models.AuditTargetUser, membership.UserID, changes)
+	}
+	return scs.GetUser(membership.OrganizationID, strconv.FormatUint(uint64(membership.UserID), 10))
+}
+
+// ensureOwnerRemains fails when the membership is the organization's last
+// active owner.
+func (scs *SCIMService) ensureOwnerRemains(membership *models.Membership) error {
+	if membership.DeactivatedAt != nil {
+		return nil
+	}
+	for _, role := range membership.Roles {
+		if role.System && role.Name == models.OrgOwnerRole {
+			if err := ensureNotLastHolder(scs.RoleRepository, &role, errSCIMLastOwner); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (scs *SCIMService) member(orgID uint, id string) (*models.Membership, error) {
+	userID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, errSCIMUserNotFound
+	}
+	membership, err := scs.SCIMRepository.GetMember(orgID, uint(userID))
+	if err != nil {
+		return nil, errSCIMUserNotFound
+	}
+	return membership, nil
+}
+
+// ListGroups lists the organization's roles. Filters compare displayName or
+// id with "eq".
+func (scs *SCIMService) ListGroups(orgID uint, filter string, startIndex, count int) (*models.SCIMListResponse, error) {
+	where, err := parseSCIMFilter(filter, map[string]string{"id": "id", "displayname": "name"})
+	if err != nil {
+		return nil, err
+	}
+	startIndex, count = scimPage(startIndex, count)
+	roles, total, err := scs.SCIMRepository.ListRoles(orgID, where, startIndex-1, count)
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]models.SCIMGroup, 0, len(roles))
+	for i := range roles {
+		group, err := scs.group(&roles[i])
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *group)
+	}
+	return newSCIMListResponse(groups, len(groups), total, startIndex), nil
+}
+
+func (scs *SCIMService) GetGroup(orgID uint, id string) (*models.SCIMGroup, error) {
+	role, err := scs.role(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	return scs.group(role)
+}
+
+// CreateGroup creates an organization role without permissions and gives
+// it to the listed members.
+func (scs *SCIMService) CreateGroup(orgID uint, input models.SCIMGroup, info RequestInfo) (*models.SCIMGroup, error) {
+	if err := validateSCIMGroupName(input.DisplayName); err != nil {
+		return nil, err
+	}
+	if _, err := scs.RoleRepository.GetByName(&orgID, input.DisplayName); err == nil {
+		return nil, newSCIMError(http.StatusConflict, "uniqueness", "A group with this displayName already exists")
+	}
+	userIDs, err := scs.memberIDs(orgID, input.Members)
+	if err != nil {
+		return nil, err
+	}
+	role := models.Role{OrganizationID: &orgID, Name: input.DisplayName}
+	if err := scs.SCIMRepository.SaveRole(&role, userIDs, nil, true); err != nil {
+		return nil, err
+	}
+	scs.AuditService.Record(info, models.AuditSCIMGroupCreated, models.AuditTargetRole, role.ID, map[string]interface{}{
+		"organization_id": orgID,
+		"name":            role.Name,
+		"members":         models.AuditChange{To: userIDs},
+	})
+	return scs.group(&role)
+}
+
+// ReplaceGroup renames a role and replaces its members. Built-in roles
+// cannot be renamed.
+func (scs *SCIMService) ReplaceGroup(orgID uint, id string, input models.SCIMGroup, info RequestInfo) (*models.SCIMGroup, error) {
+	role, err := scs.role(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	userIDs, err := scs.memberIDs(orgID, input.Members)
+	if err != nil {
+		return nil, err
+	}
+	return scs.saveGroup(role, input.DisplayName, userIDs, info)
+}
+
+// PatchGroup renames a role or adds, removes and replaces its members.
+func (scs *SCIMService) PatchGroup(orgID uint, id string, request models.SCIMPatchRequest, info RequestInfo) (*models.SCIMGroup, error) {
+	role, err := scs.role(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	current, err := scs.SCIMRepository.ListRoleMembers(role.ID)
+	if err != nil {
+		return nil, err
+	}
+	members := map[uint]bool{}
+	for _, membership := range current {
+		members[membership.UserID] = true
+	}
+	name := role.Name
+	for _, operation := range request.Operations {
+		if err := patchSCIMGroup(&name, members, operation); err != nil {
+			return nil, err
+		}
+	}
+	refs := make([]models.SCIMReference, 0, len(members))
+	for userID := range members {
+		refs = append(refs, models.SCIMReference{Value: strconv.FormatUint(uint64(userID), 10)})
+	}
+	userIDs, err := scs.memberIDs(orgID, refs)
+	if err != nil {
+		return nil, err
+	}
+	return scs.saveGroup(role, name, userIDs, info)
+}
+
+func (scs *SCIMService) DeleteGroup(orgID uint, id string, info RequestInfo) error {
+	role, err := scs.role(orgID, id)
+	if err != nil {
+		return err
+	}
+	if role.System {
+		return newSCIMError(http.StatusBadRequest, "mutability", "Built-in groups cannot be deleted")
+	}
+	if err := scs.RoleRepository.Delete(role); err != nil {
+		return err
+	}
+	scs.AuditService.Record(info, models.AuditSCIMGroupDeleted, models.AuditTargetRole, role.ID, map[string]interface{}{
+		"organization_id": orgID,
+		"name":            role.Name,
+	})
+	return nil
+}
+
+// saveGroup renames the role and replaces its members, auditing the
+// members it added and removed.
+func (scs *SCIMService) saveGroup(role *models.Role, name string, userIDs []uint, info RequestInfo) (*models.SCIMGroup, error) {
+	changes := map[string]interface{}{}
+	if name != role.Name {
+		changes["name"] = models.AuditChange{From: role.Name, To: name}
+		if role.System {
+			return nil, newSCIMError(http.StatusBadRequest, "mutability", "Built-in groups cannot be renamed")
+		}
+		if err := validateSCIMGroupName(name); err != nil {
+			return nil, err
+		}
+		if _, err := scs.RoleRepository.GetByName(role.OrganizationID, name); err == nil {
+			return nil, newSCIMError(http.StatusConflict, "uniqueness", "A group with this displayName already exists")
+		}
+		role.Name = name
+	}
+	if role.System && role.Name == models.OrgOwnerRole && len(userIDs) == 0 {
+		return nil, errSCIMLastOwner
+	}
+	current, err := scs.SCIMRepository.ListRoleMembers(role.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := scs.SCIMRepository.SaveRole(role, userIDs, nil, true); err != nil {
+		return nil, err
+	}
+
+	kept := map[uint]bool{}
+	for _, userID := range userIDs {
+		kept[userID] = true
+	}
+	added, removed := []uint{}, []uint{}
+	for _, membership := range current {
+		if kept[membership.UserID] {
+			delete(kept, membership.UserID)
+		} else {
+			removed = append(removed, membership.UserID)
+		}
+	}
+	for _, userID := range userIDs {
+		if kept[userID] {
+			added = append(added, userID)
+		}
+	}
+	if len(added) > 0 {
+		changes["members_added"] = added
+	}
+	if len(removed) > 0 {
+		changes["members_removed"] = removed
+	}
+	if len(changes) > 0 {
+		changes["organization_id"] = role.OrganizationID
+		scs.AuditService.Record(info, models.AuditSCIMGroupUpdated, models.AuditTargetRole, role.ID, changes)
+	}
+	return scs.group(role)
+}
+
+func (scs *SCIMService) role(orgID uint, id string) (*models.Role, error) {
+	roleID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, errSCIMGroupNotFound
+	}
+	role, err := scs.SCIMRepository.GetRole(orgID, uint(roleID))
+	if err != nil {
+		return nil, errSCIMGroupNotFound
+	}
+	return role, nil
+}
+
+func (scs *SCIMService) group(role *models.Role) (*models.SCIMGroup, error) {
+	memberships, err := scs.SCIMRepository.ListRoleMembers(role.ID)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]models.SCIMReference, 0, len(memberships))
+	for _, membership := range memberships {
+		members = append(members, models.SCIMReference{
+			Value:   strconv.FormatUint(uint64(membership.UserID), 10),
+			Display: membership.User.Email,
+		})
+	}
+	return &models.SCIMGroup{
+		Schemas:     []string{models.SCIMGroupSchema},
+		ID:          strconv.FormatUint(uint64(role.ID), 10),
+		DisplayName: role.Name,
+		Members:     members,
+		Meta:        &models.SCIMMeta{ResourceType: "Group", Created: role.CreatedAt, LastModified: role.UpdatedAt},
+	}, nil
+}
+
+// memberIDs reads the user IDs of group member references, all of which
+// must be members of the organization.
+func (scs *SCIMService) memberIDs(orgID uint, refs []models.SCIMReference) ([]uint, error) {
+	seen := map[uint]bool{}
+	userIDs := make([]uint, 0, len(refs))
+	for _, ref := range refs {
+		userID, err := strconv.ParseUint(ref.Value, 10, 64)
+		if err != nil {
+			return nil, newSCIMError(http.StatusBadRequest, "invalidValue", "Unknown member "+ref.Value)
+		}
+		if !seen[uint(userID)] {
+			seen[uint(userID)] = true
+			userIDs = append(userIDs, uint(userID))
+		}
+	}
+	if len(userIDs) == 0 {
+		return userIDs, nil
+	}
+	count, err := scs.SCIMRepository.CountMembers(orgID, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	if count != int64(len(userIDs)) {
+		return nil, newSCIMError(http.StatusBadRequest, "invalidValue", "Group members must be users of the organization")
+	}
+	return userIDs, nil
+}
+
+// patchSCIMUser applies one PATCH operation to a user representation.
+func patchSCIMUser(user *models.SCIMUser, operation models.SCIMPatchOperation) error {
+	op := strings.ToLower(operation.Op)
+	if op != "add" && op != "replace" && op != "remove" {
+		return newSCIMError(http.StatusBadRequest, "invalidSyntax", "Unsupported operation "+operation.Op)
+	}
+	if operation.Path != "" {
+		return patchSCIMUserAttribute(user, strings.ToLower(operation.Path), operation.Value, op == "remove")
+	}
+	if op == "remove" {
+		return newSCIMError(http.StatusBadRequest, "noTarget", "Remove operations need a path")
+	}
+	var attributes map[string]json.RawMessage
+	if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+		return newSCIMError(http.StatusBadRequest, "invalidValue", "Operations without a path need an object value")
+	}
+	for attribute, value := range attributes {
+		if err := patchSCIMUserAttribute(user, strings.ToLower(attribute), value, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func patchSCIMUserAttribute(user *models.SCIMUser, path string, value json.RawMessage, remove bool) error {
+	if strings.HasPrefix(path, "emails") {
+		path = "emails"
+	}
+	if remove {
+		switch path {
+		case "externalid":
+			user.ExternalID = ""
+		case "username", "emails", "active":
+			return newSCIMError(http.StatusBadRequest, "mutability", "The "+path+" attribute cannot be removed")
+		}
+		return nil
+	}
+
+	if user.Name == nil {
+		user.Name = &models.SCIMName{}
+	}
+	switch path {
+	case "active":
+		active, err := scimBool(value)
+		if err != nil {
+			return err
+		}
+		user.Active = &active
+	case "externalid":
+		return scimString(value, &user.ExternalID)
+	case "username":
+		user.Emails = nil
+		return scimString(value, &user.UserName)
+	case "emails":
+		var email string
+		var emails []models.SCIMEmail
+		if err := json.Unmarshal(value, &emails); err == nil {
+			user.Emails = emails
+		} else if err := scimString(value, &email); err == nil {
+			user.Emails = []models.SCIMEmail{{Value: email, Primary: true}}
+		} else {
+			return err
+		}
+		user.UserName = ""
+	case "displayname":
+		return scimString(value, &user.DisplayName)
+	case "name":
+		var name models.SCIMName
+		if err := json.Unmarshal(value, &name); err != nil {
+			return newSCIMError(http.StatusBadRequest, "invalidValue", "name must be an object")
+		}
+		if name.GivenName != "" {
+			user.Name.GivenName = name.GivenName
+		}
+		if name.FamilyName != "" {
+			user.Name.FamilyName = name.FamilyName
+		}
+		user.Name.Formatted = name.Formatted
+		user.DisplayName = ""
+	case "name.formatted":
+		user.DisplayName = ""
+		return scimString(value, &user.Name.Formatted)
+	case "name.givenname", "name.familyname":
+		target := &user.Name.GivenName
+		if path == "name.familyname" {
+			target = &user.Name.FamilyName
+		}
+		if err := scimString(value, target); err != nil {
+			return err
+		}
+		user.Name.Formatted = ""
+		user.DisplayName = ""
+	}
+	return nil
+}
+
+// patchSCIMGroup applies one PATCH operation to a group's name and member
+// set.
+func patchSCIMGroup(name *string, members map[uint]bool, operation models.SCIMPatchOperation) error {
+	op := strings.ToLower(operation.Op)
+	path := strings.ToLower(operation.Path)
+	switch {
+	case op != "add" && op != "replace" && op != "remove":
+		return newSCIMError(http.StatusBadRequest, "invalidSyntax", "Unsupported operation "+operation.Op)
+	case path == "" && op != "remove":
+		var attributes map[string]json.RawMessage
+		if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+			return newSCIMError(http.StatusBadRequest, "invalidValue", "Operations without a path need an object value")
+		}
+		for attribute, value := range attributes {
+			if err := patchSCIMGroup(name, members, models.SCIMPatchOperation{Op: op, Path: attribute, Value: value}); err != nil {
+				return err
+			}
+		}
+		return nil
+	case path == "displayname" && op != "remove":
+		return scimString(operation.Value, name)
+	case path == "members":
+		var refs []models.SCIMReference
+		if len(operation.Value) > 0 {
+			if err := json.Unmarshal(operation.Value, &refs); err != nil {
+				return newSCIMError(http.StatusBadRequest, "invalidValue", "members must be a list")
+			}
+		}
+		if op == "replace" || (op == "remove" && len(refs) == 0) {
+			for userID := range members {
+				delete(members, userID)
+			}
+		}
+		for _, ref := range refs {
+			userID, err := strconv.ParseUint(ref.Value, 10, 64)
+			if err != nil {
+				return newSCIMError(http.StatusBadRequest, "invalidValue", "Unknown member "+ref.Value)
+			}
+			if op == "remove" {
+				delete(members, uint(userID))
+			} else {
+				members[uint(userID)] = true
+			}
+		}
+		return nil
+	case op == "remove" && strings.HasPrefix(path, "members["):
+		where, err := parseSCIMFilter(strings.TrimSuffix(operation.Path[len("members["):], "]"), map[string]string{"value": "value"})
+		if err != nil || where.Column == "" {
+			return newSCIMError(http.StatusBadRequest, "invalidPath", "Unsupported path "+operation.Path)
+		}
+		userID, err := strconv.ParseUint(where.Value, 10, 64)
+		if err == nil {
+			delete(members, uint(userID))
+		}
+		return nil
+	}
+	return newSCIMError(http.StatusBadRequest, "invalidPath", "Unsupported path "+operation.Path)
+}
+
+// parseSCIMFilter reads a filter of the form `attribute eq "value"`.
+// columns maps the lowercased attributes that can be filtered on to
+// database columns.
+func parseSCIMFilter(filter string, columns map[string]string) (repositories.SCIMFilter, error) {
+	if strings.TrimSpace(filter) == "" {
+		return repositories.SCIMFilter{}, nil
+	}
+	match := scimFilterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return repositories.SCIMFilter{}, newSCIMError(http.StatusBadRequest, "invalidFilter", `Only filters of the form attribute eq "value" are supported`)
+	}
+	column, ok := columns[strings.ToLower(match[1])]
+	if !ok {
+		return repositories.SCIMFilter{}, newSCIMError(http.StatusBadRequest, "invalidFilter", "Filtering on "+match[1]+" is not supported")
+	}
+	value, err := strconv.Unquote(`"` + match[2] + `"`)
+	if err != nil {
+		return repositories.SCIMFilter{}, newSCIMError(http.StatusBadRequest, "invalidFilter", "Invalid filter value")
+	}
+	return repositories.SCIMFilter{Column: column, Value: value}, nil
+}
+
+// scimPage applies the defaults and limits of startIndex and count.
+func scimPage(startIndex, count int) (int, int) {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > SCIMMaxCount {
+		count = SCIMMaxCount
+	}
+	return startIndex, count
+}
+
+// scimUserEmail returns the user's email: the primary email, else the first
+// one, else the userName.
+func scimUserEmail(user models.SCIMUser) (string, error) {
+	email := user.UserName
+	for i, candidate := range user.Emails {
+		if candidate.Primary || i == 0 {
+			email = candidate.Value
+		}
+		if candidate.Primary {
+			break
+		}
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", newSCIMError(http.StatusBadRequest, "invalidValue", "userName must be an email address")
+	}
+	return email, nil
+}
+
+// scimDisplayName picks the name to store for a user.
+func scimDisplayName(user models.SCIMUser, email string) string {
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+	if user.Name != nil {
+		if user.Name.Formatted != "" {
+			return user.Name.Formatted
+		}
+		if name := strings.TrimSpace(user.Name.GivenName + " " + user.Name.FamilyName); name != "" {
+			return name
+		}
+	}
+	return email
+}
+
+func validateSCIMGroupName(name string) error {
+	if name == "" || len(name) > 64 || strings.Contains(name, "/") {
+		return newSCIMError(http.StatusBadRequest, "invalidValue", "displayName must be 1 to 64 characters without slashes")
+	}
+	return nil
+}
+
+// scimBool reads a boolean, also accepting the "True" and "False" strings
+// some identity providers send.
+func scimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		if parsed, err := strconv.ParseBool(strings.ToLower(s)); err == nil {
+			return parsed, nil
+		}
+	}
+	return false, newSCIMError(http.StatusBadRequest, "invalidValue", "Expected a boolean")
+}
+
+func scimString(value json.RawMessage, target *string) error {
+	if err := json.Unmarshal(value, target); err != nil {
+		return newSCIMError(http.StatusBadRequest, "invalidValue", "Expected a string")
+	}
+	return nil
+}
+
+func newSCIMUser(membership *models.Membership) models.SCIMUser {
+	active := membership.DeactivatedAt == nil
+	groups := make([]models.SCIMReference, 0, len(membership.Roles))
+	for _, role := range membership.Roles {
+		groups = append(groups, models.SCIMReference{Value: strconv.FormatUint(uint64(role.ID), 10), Display: role.Name})
+	}
+	lastModified := membership.UpdatedAt
+	if membership.User.UpdatedAt.After(lastModified) {
+		lastModified = membership.User.UpdatedAt
+	}
+	return models.SCIMUser{
+		Schemas:     []string{models.SCIMUserSchema},
+		ID:          strconv.FormatUint(uint64(membership.UserID), 10),
+		ExternalID:  membership.ExternalID,
+		UserName:    membership.User.Email,
+		Name:        &models.SCIMName{Formatted: membership.User.Name},
+		DisplayName: membership.User.Name,
+		Emails:      []models.SCIMEmail{{Value: membership.User.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Groups:      groups,
+		Meta:        &models.SCIMMeta{ResourceType: "User", Created: membership.CreatedAt, LastModified: lastModified},
+	}
+}
+
+func newSCIMListResponse(resources interface{}, items int, total int64, startIndex int) *models.SCIMListResponse {
+	return &models.SCIMListResponse{
+		Schemas:      []string{models.SCIMListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: items,
+		Resources:    resources,
+	}
+}
+
+func newSCIMTokenResponse(token *models.SCIMToken) models.SCIMTokenResponse {
+	return models.SCIMTokenResponse{
+		ID:         token.ID,
+		Name:       token.Name,
+		LastUsedAt: token.LastUsedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
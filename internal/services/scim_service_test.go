@@ -0,0 +1,135 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+)
+
+func TestParseSCIMFilter(t *testing.T) {
+	columns := map[string]string{"username": "User.email", "emails.value": "User.email", "externalid": "memberships.external_id"}
+	tests := []struct {
+		filter   string
+		want     repositories.SCIMFilter
+		wantType string
+	}{
+		{``, repositories.SCIMFilter{}, ""},
+		{`   `, repositories.SCIMFilter{}, ""},
+		{`userName eq "bjensen@example.com"`, repositories.SCIMFilter{Column: "User.email", Value: "bjensen@example.com"}, ""},
+		{`USERNAME EQ "a@example.com"`, repositories.SCIMFilter{Column: "User.email", Value: "a@example.com"}, ""},
+		{`  emails.value eq "a@example.com"  `, repositories.SCIMFilter{Column: "User.email", Value: "a@example.com"}, ""},
+		{`externalId eq ""`, repositories.SCIMFilter{Column: "memberships.external_id", Value: ""}, ""},
+		{`externalId eq "a \"quoted\" id"`, repositories.SCIMFilter{Column: "memberships.external_id", Value: `a "quoted" id`}, ""},
+		{`externalId eq "back\\slash"`, repositories.SCIMFilter{Column: "memberships.external_id", Value: `back\slash`}, ""},
+		{`externalId eq "a" or userName eq "b"`, repositories.SCIMFilter{}, "invalidFilter"},
+		{`externalId eq "unterminated`, repositories.SCIMFilter{}, "invalidFilter"},
+		{`externalId eq "a"b"`, repositories.SCIMFilter{}, "invalidFilter"},
+		{`externalId eq a`, repositories.SCIMFilter{}, "invalidFilter"},
+		{`externalId co "a"`, repositories.SCIMFilter{}, "invalidFilter"},
+		{`externalId eq "bad \q escape"`, repositories.SCIMFilter{}, "invalidFilter"},
+		{`displayName eq "a"`, repositories.SCIMFilter{}, "invalidFilter"},
+	}
+	for _, tt := range tests {
+		got, err := parseSCIMFilter(tt.filter, columns)
+		if got != tt.want || scimErrorType(err) != tt.wantType {
+			t.Errorf("parseSCIMFilter(%q) = (%+v, %q), want (%+v, %q)", tt.filter, got, scimErrorType(err), tt.want, tt.wantType)
+		}
+	}
+}
+
+func TestPatchSCIMUser(t *testing.T) {
+	active := false
+	tests := []struct {
+		name      string
+		operation models.SCIMPatchOperation
+		want      models.SCIMUser
+		wantType  string
+	}{
+		{"replace active", models.SCIMPatchOperation{Op: "replace", Path: "active", Value: json.RawMessage(`false`)},
+			models.SCIMUser{UserName: "a@example.com", ExternalID: "ext", Active: &active, Name: &models.SCIMName{GivenName: "Ann"}}, ""},
+		{"replace active as string", models.SCIMPatchOperation{Op: "Replace", Path: "active", Value: json.RawMessage(`"False"`)},
+			models.SCIMUser{UserName: "a@example.com", ExternalID: "ext", Active: &active, Name: &models.SCIMName{GivenName: "Ann"}}, ""},
+		{"replace without path", models.SCIMPatchOperation{Op: "replace", Value: json.RawMessage(`{"active":false,"externalId":"new"}`)},
+			models.SCIMUser{UserName: "a@example.com", ExternalID: "new", Active: &active, Name: &models.SCIMName{GivenName: "Ann"}}, ""},
+		{"replace email", models.SCIMPatchOperation{Op: "replace", Path: `emails[type eq "work"].value`, Value: json.RawMessage(`"b@example.com"`)},
+			models.SCIMUser{ExternalID: "ext", Emails: []models.SCIMEmail{{Value: "b@example.com", Primary: true}}, Name: &models.SCIMName{GivenName: "Ann"}}, ""},
+		{"replace family name", models.SCIMPatchOperation{Op: "add", Path: "name.familyName", Value: json.RawMessage(`"Smith"`)},
+			models.SCIMUser{UserName: "a@example.com", ExternalID: "ext", Name: &models.SCIMName{GivenName: "Ann", FamilyName: "Smith"}}, ""},
+		{"remove externalId", models.SCIMPatchOperation{Op: "remove", Path: "externalId"},
+			models.SCIMUser{UserName: "a@example.com", Name: &models.SCIMName{GivenName: "Ann"}}, ""},
+		{"remove userName", models.SCIMPatchOperation{Op: "remove", Path: "userName"}, models.SCIMUser{}, "mutability"},
+		{"remove without path", models.SCIMPatchOperation{Op: "remove"}, models.SCIMUser{}, "noTarget"},
+		{"unsupported op", models.SCIMPatchOperation{Op: "move", Path: "active"}, models.SCIMUser{}, "invalidSyntax"},
+		{"non-object value", models.SCIMPatchOperation{Op: "replace", Value: json.RawMessage(`"x"`)}, models.SCIMUser{}, "invalidValue"},
+	}
+	for _, tt := range tests {
+		user := models.SCIMUser{UserName: "a@example.com", ExternalID: "ext", Name: &models.SCIMName{GivenName: "Ann"}}
+		err := patchSCIMUser(&user, tt.operation)
+		if scimErrorType(err) != tt.wantType {
+			t.Errorf("%s: patchSCIMUser error = %v, want type %q", tt.name, err, tt.wantType)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(user, tt.want) {
+			t.Errorf("%s: patchSCIMUser = %+v, want %+v", tt.name, user, tt.want)
+		}
+	}
+}
+
+func TestPatchSCIMGroup(t *testing.T) {
+	tests := []struct {
+		name        string
+		operation   models.SCIMPatchOperation
+		wantName    string
+		wantMembers []uint
+		wantType    string
+	}{
+		{"rename", models.SCIMPatchOperation{Op: "replace", Path: "displayName", Value: json.RawMessage(`"Admins"`)}, "Admins", []uint{1, 2}, ""},
+		{"rename without path", models.SCIMPatchOperation{Op: "replace", Value: json.RawMessage(`{"displayName":"Admins"}`)}, "Admins", []uint{1, 2}, ""},
+		{"add members", models.SCIMPatchOperation{Op: "add", Path: "members", Value: json.RawMessage(`[{"value":"3"},{"value":"1"}]`)}, "Staff", []uint{1, 2, 3}, ""},
+		{"replace members", models.SCIMPatchOperation{Op: "replace", Path: "members", Value: json.RawMessage(`[{"value":"3"}]`)}, "Staff", []uint{3}, ""},
+		{"remove listed members", models.SCIMPatchOperation{Op: "remove", Path: "members", Value: json.RawMessage(`[{"value":"2"}]`)}, "Staff", []uint{1}, ""},
+		{"remove all members", models.SCIMPatchOperation{Op: "remove", Path: "members"}, "Staff", []uint{}, ""},
+		{"remove filtered member", models.SCIMPatchOperation{Op: "remove", Path: `members[value eq "2"]`}, "Staff", []uint{1}, ""},
+		{"remove filtered member case", models.SCIMPatchOperation{Op: "Remove", Path: `Members[Value EQ "1"]`}, "Staff", []uint{2}, ""},
+		{"remove filtered unknown member", models.SCIMPatchOperation{Op: "remove", Path: `members[value eq "9"]`}, "Staff", []uint{1, 2}, ""},
+		{"remove filtered non-numeric member", models.SCIMPatchOperation{Op: "remove", Path: `members[value eq "x\"y"]`}, "Staff", []uint{1, 2}, ""},
+		{"remove by other attribute", models.SCIMPatchOperation{Op: "remove", Path: `members[display eq "Ann"]`}, "", nil, "invalidPath"},
+		{"remove with empty filter", models.SCIMPatchOperation{Op: "remove", Path: `members[]`}, "", nil, "invalidPath"},
+		{"add unknown member", models.SCIMPatchOperation{Op: "add", Path: "members", Value: json.RawMessage(`[{"value":"x"}]`)}, "", nil, "invalidValue"},
+		{"remove displayName", models.SCIMPatchOperation{Op: "remove", Path: "displayName"}, "", nil, "invalidPath"},
+		{"unsupported op", models.SCIMPatchOperation{Op: "copy", Path: "members"}, "", nil, "invalidSyntax"},
+	}
+	for _, tt := range tests {
+		name := "Staff"
+		members := map[uint]bool{1: true, 2: true}
+		err := patchSCIMGroup(&name, members, tt.operation)
+		if scimErrorType(err) != tt.wantType {
+			t.Errorf("%s: patchSCIMGroup error = %v, want type %q", tt.name, err, tt.wantType)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		want := map[uint]bool{}
+		for _, id := range tt.wantMembers {
+			want[id] = true
+		}
+		if name != tt.wantName || !reflect.DeepEqual(members, want) {
+			t.Errorf("%s: patchSCIMGroup = (%q, %v), want (%q, %v)", tt.name, name, members, tt.wantName, want)
+		}
+	}
+}
+
+func scimErrorType(err error) string {
+	var scimErr *SCIMError
+	if errors.As(err, &scimErr) {
+		return scimErr.Type
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
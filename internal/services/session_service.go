@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"time"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionRevoked  = errors.New("session revoked")
+)
+
+// lastSeenInterval limits how often an authenticated request writes the
+// session's last-seen timestamp.
+const lastSeenInterval = time.Minute
+
+type SessionService struct {
+	SessionRepository *repositories.SessionRepository
+	TokenRepository   *repositories.TokenRepository
+	UserRepository    *repositories.UserRepository
+}
+
+func NewSessionService(sr *repositories.SessionRepository, tr *repositories.TokenRepository, ur *repositories.UserRepository) *SessionService {
+	return &SessionService{SessionRepository: sr, TokenRepository: tr, UserRepository: ur}
+}
+
+// ValidateSession checks that the session behind a token is still active and
+// belongs to the token's user, whose account must be active too, refreshing
+// the session's last-seen time along the way.
+func (ss *SessionService) ValidateSession(sessionID string, userID uint) error {
+	if sessionID == "" {
+		return ErrSessionNotFound
+	}
+	session, err := ss.SessionRepository.GetBySessionID(sessionID)
+	if err != nil || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+	now := time.Now()
+	if session.RevokedAt != nil || now.After(session.ExpiresAt) {
+		return ErrSessionRevoked
+	}
+	user, err := ss.UserRepository.GetStatus(userID)
+	if err != nil {
+		return ErrSessionNotFound
+	}
+	if err := CheckAccountStatus(user); err != nil {
+		return err
+	}
+	if now.Sub(session.LastSeenAt) > lastSeenInterval {
+		return ss.SessionRepository.Touch(sessionID, now)
+	}
+	return nil
+}
+
+func (ss *SessionService) ListSessions(userID uint, currentSessionID string) ([]models.SessionResponse, error) {
+	sessions, err := ss.SessionRepository.ListActiveByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]models.SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		response = append(response, models.SessionResponse{
+			ID:         s.SessionID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			Current:    s.SessionID == currentSessionID,
+		})
+	}
+	return response, nil
+}
+
+// RevokeSession revokes one of the user's sessions together with its refresh tokens.
+func (ss *SessionService) RevokeSession(userID uint, sessionID string) error {
+	session, err := ss.SessionRepository.GetBySessionID(sessionID)
+	if err != nil || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+	if err := ss.SessionRepository.Revoke(sessionID); err != nil {
+		return err
+	}
+	return ss.TokenRepository.RevokeRefreshTokenFamily(sessionID)
+}
+
+// RevokeAllSessions revokes every session of the user except exceptSessionID;
+// pass an empty string to sign the user out everywhere.
+func (ss *SessionService) RevokeAllSessions(userID uint, exceptSessionID string) error {
+	ids, err := ss.SessionRepository.RevokeAllByUserID(userID, exceptSessionID)
+	if err != nil {
+		return err
+	}
+	return ss.TokenRepository.RevokeRefreshTokenFamilies(ids)
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+	"user-service/config"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+	"user-service/pkg/social"
+	"user-service/utils"
+)
+
+// GoogleProvider is the AuthProvider.Provider value of Google logins.
+const GoogleProvider = "google"
+
+// OAuthStateExpiry is how long a user has to finish logging in at the provider.
+const OAuthStateExpiry = time.Minute * 10
+
+var (
+	ErrAccountLinkRequired = errors.New("an account with this email already exists")
+	ErrInvalidOAuthState   = errors.New("invalid or expired login state")
+	ErrInvalidReturnTo     = errors.New("return_to is not an allowed redirect target")
+)
+
+// SocialAuthService signs users in through the configured external login
+// providers.
+type SocialAuthService struct {
+	Registry            *social.Registry
+	UserRepository      *repositories.UserRepository
+	AuditService        *AuditService
+	LoginHistoryService *LoginHistoryService
+}
+
+func NewSocialAuthService(registry *social.Registry, ur *repositories.UserRepository, as *AuditService, lhs *LoginHistoryService) *SocialAuthService {
+	return &SocialAuthService{Registry: registry, UserRepository: ur, AuditService: as, LoginHistoryService: lhs}
+}
+
+func (sas *SocialAuthService) ListProviders() []string {
+	return sas.Registry.Names()
+}
+
+// StartLogin returns the provider's authorization URL and a signed state
+// token, which the caller must store in a cookie for the callback.
+func (sas *SocialAuthService) StartLogin(ctx context.Context, providerName, returnTo string) (string, string, error) {
+	provider, err := sas.Registry.Get(providerName)
+	if err != nil {
+		return "", "", err
+	}
+	return startAuthorization(ctx, provider, utils.OAuthStateClaims{Provider: providerName, ReturnTo: returnTo})
+}
+
+// startAuthorization creates the state, nonce and PKCE verifier of a new
+// provider redirect and returns the authorization URL with the signed state
+// token holding them.
+func startAuthorization(ctx context.Context, provider social.Provider, claims utils.OAuthStateClaims) (string, string, error) {
+	if !validReturnTo(claims.ReturnTo) {
+		return "", "", ErrInvalidReturnTo
+	}
+	req, err := social.NewAuthRequest()
+	if err != nil {
+		return "", "", err
+	}
+	authURL, err := provider.AuthCodeURL(ctx, req)
+	if err != nil {
+		return "", "", err
+	}
+	claims.State, claims.Nonce, claims.CodeVerifier = req.State, req.Nonce, req.CodeVerifier
+	stateToken, err := utils.GenerateOAuthStateToken(claims, OAuthStateExpiry)
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, stateToken, nil
+}
+
+// authRequest is the request a verified callback's code was issued for.
+func authRequest(state *utils.OAuthStateClaims) social.AuthRequest {
+	return social.AuthRequest{State: state.State, Nonce: state.Nonce, CodeVerifier: state.CodeVerifier}
+}
+
+// VerifyState checks that a callback belongs to the login started in this
+// browser: the state cookie must be valid, for the same provider, and carry
+// the state the provider sent back. This is what stops login CSRF.
+func (sas *SocialAuthService) VerifyState(providerName, stateToken, state string) (*utils.OAuthStateClaims, error) {
+	claims, err := utils.ParseOAuthStateToken(stateToken)
+	if err != nil || claims.Provider != providerName || state == "" ||
+		subtle.ConstantTimeCompare([]byte(claims.State), []byte(state)) != 1 {
+		return nil, ErrInvalidOAuthState
+	}
+	return claims, nil
+}
+
+// Login redeems the authorization code from a verified provider callback
+// and returns the local user for that provider account.
+func (sas *SocialAuthService) Login(ctx context.Context, code string, state *utils.OAuthStateClaims, info RequestInfo) (*models.User, error) {
+	provider, err := sas.Registry.Get(state.Provider)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := provider.Exchange(ctx, code, authRequest(state))
+	if err != nil {
+		return nil, err
+	}
+	return sas.signIn(state.Provider, identity, info)
+}
+
+// LoginWithIDToken signs in with an ID token the client obtained from the
+// provider itself, as mobile apps do with Google Sign-In.
+func (sas *SocialAuthService) LoginWithIDToken(ctx context.Context, providerName, idToken, nonce string, info RequestInfo) (*models.User, error) {
+	provider, err := sas.Registry.Get(providerName)
+	if err != nil {
+		return nil, err
+	}
+	verifier, ok := provider.(social.IDTokenVerifier)
+	if !ok {
+		return nil, social.ErrIDTokenNotSupported
+	}
+	identity, err := verifier.VerifyIDToken(ctx, idToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return sas.signIn(providerName, identity, info)
+}
+
+// signIn returns the local user for a verified provider identity. Refused
+// sign-ins are recorded in the login history under the provider's name.
+func (sas *SocialAuthService) signIn(provider string, identity *social.Identity, info RequestInfo) (*models.User, error) {
+	user, err := sas.resolveUser(provider, identity, info)
+	if err != nil {
+		if errors.Is(err, ErrAccountLinkRequired) {
+			existing, _ := sas.UserRepository.GetByEmail(identity.Email)
+			sas.LoginHistoryService.RecordFailure(existing, identity.Email, provider, err, info)
+		}
+		return nil, err
+	}
+	if err := CheckAccountStatus(user); err != nil {
+		sas.LoginHistoryService.RecordFailure(user, user.Email, provider, err, info)
+		return nil, err
+	}
+	if config.AppConfig.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		sas.LoginHistoryService.RecordFailure(user, user.Email, provider, ErrEmailNotVerified, info)
+		return nil, ErrEmailNotVerified
+	}
+	return user, nil
+}
+
+// resolveUser finds the user for an external identity: first by an existing
+// link, then by email, and otherwise by creating a new account.
+func (sas *SocialAuthService) resolveUser(provider string, identity *social.Identity, info RequestInfo) (*models.User, error) {
+	if user, err := sas.UserRepository.GetUserByProviderID(provider, identity.ProviderID); err == nil {
+		return user, nil
+	}
+
+	link := models.AuthProvider{Provider: provider, ProviderID: identity.ProviderID, Email: identity.Email}
+	user, err := sas.UserRepository.GetByEmail(identity.Email)
+	if err != nil {
+		// If user does not exist, create a new user
+		var verifiedAt *time.Time
+		if identity.EmailVerified {
+			now := time.Now()
+			verifiedAt = &now
+		}
+		newUser := models.User{
+			Email:           identity.Email,
+			Name:            identity.Name,
+			AvatarURL:       identity.AvatarURL,
+			Password:        "",
+			EmailVerifiedAt: verifiedAt,
+		}
+		if err := sas.UserRepository.CreateWithAuthProvider(&newUser, &link); err != nil {
+			return nil, err
+		}
+		info.UserID = newUser.ID
+		sas.AuditService.Record(info, models.AuditSocialSignUp, models.AuditTargetUser, newUser.ID, map[string]models.AuditChange{
+			"email":    {To: newUser.Email},
+			"provider": {To: provider},
+		})
+		return &newUser, nil
+	}
+
+	// An account with this email already exists. It is only linked
+	// automatically when both sides have proven they own the address;
+	// otherwise someone who registered the email without verifying it could
+	// take over the provider login, so the owner has to link it themselves.
+	if !identity.EmailVerified {
+		return nil, ErrAccountLinkRequired
+	}
+	if user.EmailVerifiedAt == nil {
+		// Accounts created by the old Google login have neither a password
+		// nor a link, so their owner cannot sign in to link the provider.
+		// Nobody else can sign in to them either; the provider's proof of
+		// the address is taken for the account.
+		legacy, err := sas.isPasswordlessWithoutLinks(user)
+		if err != nil {
+			return nil, err
+		}
+		if !legacy {
+			return nil, ErrAccountLinkRequired
+		}
+	}
+	link.UserID = user.ID
+	if err := sas.UserRepository.CreateAuthProvider(&link); err != nil {
+		return nil, ErrAccountLinkRequired
+	}
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		if err := sas.UserRepository.UpdateColumns(user.ID, map[string]interface{}{"email_verified_at": now}); err != nil {
+			return nil, err
+		}
+		user.EmailVerifiedAt = &now
+	}
+	return user, nil
+}
+
+func (sas *SocialAuthService) isPasswordlessWithoutLinks(user *models.User) (bool, error) {
+	if user.Password != "" {
+		return false, nil
+	}
+	links, err := sas.UserRepository.ListAuthProviders(user.ID)
+	if err != nil {
+		return false, err
+	}
+	return len(links) == 0, nil
+}
+
+// validReturnTo allows relative paths on this host and absolute URLs on one
+// of the configured origins, so return_to cannot be used as an open redirect.
+func validReturnTo(returnTo string) bool {
+	if returnTo == "" {
+		return true
+	}
+	if strings.HasPrefix(returnTo, "/") {
+		// "//host" and "/\host" are treated as absolute URLs by browsers.
+		return !strings.HasPrefix(returnTo, "//") && !strings.HasPrefix(returnTo, "/\\")
+	}
+	u, err := url.Parse(returnTo)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil {
+		return false
+	}
+	origin := u.Scheme + "://" + u.Host
+	for _, allowed := range config.AppConfig.SocialReturnOrigins {
+		if strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
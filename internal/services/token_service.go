@@ -0,0 +1,220 @@
+package services
+
+import (
+	"errors"
+	"time"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+	"user-service/utils"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+type TokenService struct {
+	TokenRepository        *repositories.TokenRepository
+	UserRepository         *repositories.UserRepository
+	SessionRepository      *repositories.SessionRepository
+	RoleRepository         *repositories.RoleRepository
+	OrganizationRepository *repositories.OrganizationRepository
+	LoginHistoryService    *LoginHistoryService
+}
+
+func NewTokenService(tr *repositories.TokenRepository, ur *repositories.UserRepository, sr *repositories.SessionRepository, rr *repositories.RoleRepository, or *repositories.OrganizationRepository, lhs *LoginHistoryService) *TokenService {
+	return &TokenService{TokenRepository: tr, UserRepository: ur, SessionRepository: sr, RoleRepository: rr, OrganizationRepository: or, LoginHistoryService: lhs}
+}
+
+// IssueTokens starts a new session for a fresh login and returns its
+// access/refresh token pair. The session ID is also the refresh token family.
+// The login is recorded in the login history under the given method.
+func (ts *TokenService) IssueTokens(user *models.User, method string, info RequestInfo) (string, string, error) {
+	sessionID, err := ts.StartSession(user, "", "", info.UserAgent, info.IP)
+	if err != nil {
+		if isAccountStatusError(err) {
+			ts.LoginHistoryService.RecordFailure(user, user.Email, method, err, info)
+		}
+		return "", "", err
+	}
+	ts.LoginHistoryService.RecordSuccess(user, method, info)
+	return ts.IssueSessionTokens(user, sessionID)
+}
+
+// StartSession records a new session for the user and returns its ID. The
+// session starts in the user's oldest organization. clientID and scope are
+// empty for first-party logins.
+func (ts *TokenService) StartSession(user *models.User, clientID, scope, userAgent, ip string) (string, error) {
+	if err := CheckAccountStatus(user); err != nil {
+		return "", err
+	}
+	sessionID, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+	memberships, err := ts.OrganizationRepository.ListMemberships(user.ID)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	session := models.Session{
+		SessionID:  sessionID,
+		UserID:     user.ID,
+		ClientID:   clientID,
+		Scope:      scope,
+		UserAgent:  userAgent,
+		IP:         ip,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(utils.RefreshTokenExpiry()),
+	}
+	if len(memberships) > 0 {
+		session.OrganizationID = &memberships[0].OrganizationID
+	}
+	if err := ts.SessionRepository.Create(&session); err != nil {
+		return "", err
+	}
+	return sessionID, nil
+}
+
+// RefreshTokens exchanges a refresh token for a new token pair. Every refresh
+// token can be used once; presenting a used token again revokes its family
+// and the session it belongs to. clientID is the OAuth client redeeming the
+// token, empty on the first-party endpoint; it must be the client the
+// session was started by.
+func (ts *TokenService) RefreshTokens(refreshToken, clientID string) (string, string, error) {
+	claims, err := utils.ParseToken(refreshToken)
+	if err != nil || claims.TokenType != utils.RefreshTokenType {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	stored, err := ts.TokenRepository.GetRefreshTokenByHash(utils.HashToken(refreshToken))
+	if err != nil {
+		return "", "", ErrInvalidRefreshToken
+	}
+	session, err := ts.SessionRepository.GetBySessionID(stored.FamilyID)
+	if err != nil {
+		return "", "", ErrInvalidRefreshToken
+	}
+	if err := checkRefreshToken(stored, session, clientID, time.Now()); err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			return "", "", ts.revokeFamily(stored.FamilyID)
+		}
+		return "", "", err
+	}
+
+	ok, err := ts.TokenRepository.MarkRefreshTokenUsed(stored.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		return "", "", ts.revokeFamily(stored.FamilyID)
+	}
+
+	user, err := ts.UserRepository.GetByID(stored.UserID)
+	if err != nil {
+		return "", "", ErrInvalidRefreshToken
+	}
+	if err := CheckAccountStatus(user); err != nil {
+		return "", "", err
+	}
+	if err := ts.SessionRepository.Extend(session.SessionID, time.Now().Add(utils.RefreshTokenExpiry())); err != nil {
+		return "", "", err
+	}
+	return ts.IssueSessionTokens(user, stored.FamilyID)
+}
+
+// checkRefreshToken decides whether clientID may redeem a stored refresh
+// token of session. A token that was already used is reported as
+// ErrRefreshTokenReused; the caller revokes its family.
+func checkRefreshToken(stored *models.RefreshToken, session *models.Session, clientID string, now time.Time) error {
+	if stored.RevokedAt != nil || now.After(stored.ExpiresAt) {
+		return ErrInvalidRefreshToken
+	}
+	if session.RevokedAt != nil || session.ClientID != clientID {
+		return ErrInvalidRefreshToken
+	}
+	if stored.UsedAt != nil {
+		return ErrRefreshTokenReused
+	}
+	return nil
+}
+
+func (ts *TokenService) revokeFamily(familyID string) error {
+	if err := ts.TokenRepository.RevokeRefreshTokenFamily(familyID); err != nil {
+		return err
+	}
+	if err := ts.SessionRepository.Revoke(familyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// IssueSessionTokens issues an access/refresh token pair bound to an existing
+// session. The access token carries the session's organization and the
+// user's current roles and permissions there, or for an OAuth client's
+// session the client and its scopes.
+func (ts *TokenService) IssueSessionTokens(user *models.User, sessionID string) (string, string, error) {
+	grant, err := ts.accessGrant(user.ID, sessionID)
+	if err != nil {
+		return "", "", err
+	}
+	accessToken, err := utils.GenerateToken(user.ID, grant, sessionID, false)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := utils.GenerateToken(user.ID, utils.AccessGrant{}, sessionID, true)
+	if err != nil {
+		return "", "", err
+	}
+
+	stored := models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  sessionID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(utils.RefreshTokenExpiry()),
+	}
+	if err := ts.TokenRepository.CreateRefreshToken(&stored); err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
+
+// accessGrant resolves what the session's access tokens allow. A session
+// whose user has left its organization continues without one. Sessions of
+// OAuth clients never get the user's roles, whatever the user may do.
+func (ts *TokenService) accessGrant(userID uint, sessionID string) (utils.AccessGrant, error) {
+	session, err := ts.SessionRepository.GetBySessionID(sessionID)
+	if err != nil {
+		return utils.AccessGrant{}, err
+	}
+	if session.ClientID != "" {
+		return utils.AccessGrant{ClientID: session.ClientID, Scope: session.Scope}, nil
+	}
+	var orgID uint
+	if session.OrganizationID != nil {
+		orgID = *session.OrganizationID
+		if _, err := ts.OrganizationRepository.GetMembership(orgID, userID); err != nil {
+			roles, permissions, err := ts.RoleRepository.UserPermissions(userID, 0)
+			if err != nil {
+				return utils.AccessGrant{}, err
+			}
+			// Holders of organizations:manage may work in any organization.
+			if !contains(permissions, models.PermOrganizationsManage) {
+				return utils.AccessGrant{Roles: roles, Permissions: permissions}, nil
+			}
+		}
+	}
+	roles, permissions, err := ts.RoleRepository.UserPermissions(userID, orgID)
+	if err != nil {
+		return utils.AccessGrant{}, err
+	}
+	return utils.AccessGrant{OrgID: orgID, Roles: roles, Permissions: permissions}, nil
+}
+
+// RevokeSession revokes a session and every refresh token issued for it.
+func (ts *TokenService) RevokeSession(sessionID string) error {
+	if err := ts.SessionRepository.Revoke(sessionID); err != nil {
+		return err
+	}
+	return ts.TokenRepository.RevokeRefreshTokenFamily(sessionID)
+}
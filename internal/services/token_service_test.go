@@ -0,0 +1,36 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"user-service/internal/models"
+)
+
+func TestCheckRefreshToken(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Minute)
+	tests := []struct {
+		name     string
+		stored   models.RefreshToken
+		session  models.Session
+		clientID string
+		want     error
+	}{
+		{"unused", models.RefreshToken{ExpiresAt: now.Add(time.Hour)}, models.Session{}, "", nil},
+		{"oauth client", models.RefreshToken{ExpiresAt: now.Add(time.Hour)}, models.Session{ClientID: "app"}, "app", nil},
+		{"reused", models.RefreshToken{ExpiresAt: now.Add(time.Hour), UsedAt: &earlier}, models.Session{}, "", ErrRefreshTokenReused},
+		{"expired", models.RefreshToken{ExpiresAt: earlier}, models.Session{}, "", ErrInvalidRefreshToken},
+		{"revoked", models.RefreshToken{ExpiresAt: now.Add(time.Hour), RevokedAt: &earlier}, models.Session{}, "", ErrInvalidRefreshToken},
+		// Once reuse has revoked the session, presenting the token again
+		// is no longer reported as reuse.
+		{"reused after revocation", models.RefreshToken{ExpiresAt: now.Add(time.Hour), UsedAt: &earlier}, models.Session{RevokedAt: &earlier}, "", ErrInvalidRefreshToken},
+		{"other client", models.RefreshToken{ExpiresAt: now.Add(time.Hour)}, models.Session{ClientID: "app"}, "other", ErrInvalidRefreshToken},
+		{"first party token at client", models.RefreshToken{ExpiresAt: now.Add(time.Hour)}, models.Session{}, "app", ErrInvalidRefreshToken},
+	}
+	for _, tt := range tests {
+		if got := checkRefreshToken(&tt.stored, &tt.session, tt.clientID, now); !errors.Is(got, tt.want) {
+			t.Errorf("%s: checkRefreshToken = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
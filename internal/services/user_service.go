@@ -1,25 +1,40 @@
 package services
 
 import (
+	"errors"
+	"time"
+	"user-service/config"
 	"user-service/internal/models"
 	"user-service/internal/repositories"
 	"user-service/utils"
 )
 
+var ErrEmailNotVerified = errors.New("email not verified")
+
 type UserService struct {
-	UserRepository *repositories.UserRepository
+	UserRepository      *repositories.UserRepository
+	RoleRepository      *repositories.RoleRepository
+	AuditService        *AuditService
+	LoginHistoryService *LoginHistoryService
 }
 
-func NewUserService(ur *repositories.UserRepository) *UserService {
-	return &UserService{UserRepository: ur}
+func NewUserService(ur *repositories.UserRepository, rr *repositories.RoleRepository, as *AuditService, lhs *LoginHistoryService) *UserService {
+	return &UserService{UserRepository: ur, RoleRepository: rr, AuditService: as, LoginHistoryService: lhs}
 }
 
-func (us *UserService) RegisterUser(user *models.User) error {
+func (us *UserService) RegisterUser(user *models.User, info RequestInfo) error {
 	err := us.UserRepository.CheckEmailExist(user)
 	if err != nil {
 		return err
 	}
-	return us.UserRepository.Create(user)
+	if err := us.UserRepository.Create(user); err != nil {
+		return err
+	}
+	info.UserID = user.ID
+	us.AuditService.Record(info, models.AuditRegister, models.AuditTargetUser, user.ID, map[string]models.AuditChange{
+		"email": {To: user.Email},
+	})
+	return nil
 }
 
 func (us *UserService) GetUserByEmail(email string) (*models.User, error) {
@@ -39,61 +54,88 @@ func (us *UserService) CreateUser(user *models.User) error {
 	return us.UserRepository.Create(user)
 }
 
-func (us *UserService) CreateSuperUser(email, password, name string) error {
+func (us *UserService) CreateSuperUser(email, password, name string, info RequestInfo) error {
 	hashedPassword, err := utils.HashPassword(password)
 	if err != nil {
 		return err
 	}
+	adminRole, err := us.RoleRepository.GetByName(nil, models.AdminRole)
+	if err != nil {
+		return errors.New("admin role is missing")
+	}
+	verifiedAt := time.Now()
 	superUser := models.User{
-		Email:    email,
-		Password: hashedPassword,
-		Name:     name,
-		Role:     "admin",
+		Email:           email,
+		Password:        hashedPassword,
+		Name:            name,
+		Roles:           []models.Role{*adminRole},
+		EmailVerifiedAt: &verifiedAt,
 	}
-	return us.UserRepository.Create(&superUser)
+	if err := us.UserRepository.Create(&superUser); err != nil {
+		return err
+	}
+	us.AuditService.Record(info, models.AuditSuperUserCreated, models.AuditTargetUser, superUser.ID, map[string]models.AuditChange{
+		"email": {To: email},
+		"roles": {To: []string{models.AdminRole}},
+	})
+	return nil
 }
 
 func (us *UserService) CreateAuthProvider(authProvider *models.AuthProvider) error {
 	return us.UserRepository.CreateAuthProvider(authProvider)
 }
 
-func (us *UserService) GetUserByProviderID(providerID string) (*models.User, error) {
-	return us.UserRepository.GetUserByProviderID(providerID)
+func (us *UserService) GetUserByProviderID(provider, providerID string) (*models.User, error) {
+	return us.UserRepository.GetUserByProviderID(provider, providerID)
 }
 
-func (us *UserService) AuthenticateUser(email string, password string) (*models.User, error) {
+// AuthenticateUser checks a password login. Failed attempts are recorded
+// in the login history; the successful login is recorded once tokens are
+// issued for it.
+func (us *UserService) AuthenticateUser(email string, password string, info RequestInfo) (*models.User, error) {
 	user, err := us.GetUserByEmail(email)
 	if err != nil {
+		us.LoginHistoryService.RecordFailure(nil, email, models.LoginMethodPassword, ErrUserNotFound, info)
 		return nil, err
 	}
-	if !utils.CheckPasswordHash(password, user.Password) {
-		return nil, utils.ErrInvalidCredentials
+	if err := us.checkLogin(user, password); err != nil {
+		us.LoginHistoryService.RecordFailure(user, email, models.LoginMethodPassword, err, info)
+		return nil, err
 	}
 	return user, nil
 }
 
-func (us *UserService) HandleGoogleCallback(code string) (*models.User, error) {
-	googleUser, err := utils.GetGoogleUserInfo(code)
-	if err != nil {
-		return nil, err
+func (us *UserService) checkLogin(user *models.User, password string) error {
+	if !utils.CheckPasswordHash(password, user.Password) {
+		return utils.ErrInvalidCredentials
 	}
+	if err := CheckAccountStatus(user); err != nil {
+		return err
+	}
+	if config.AppConfig.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
 
-	user, err := us.GetUserByEmail(googleUser.Email)
-	if err != nil {
-		// If user does not exist, create a new user
-		newUser := models.User{
-			Email:    googleUser.Email,
-			Name:     googleUser.Name,
-			Role:     "user",
-			Password: "",
-		}
-		if err := us.UserRepository.Create(&newUser); err != nil {
-			return nil, err
-		}
-		return &newUser, nil
+// CheckAccountStatus fails with the matching error when the account is not
+// active.
+func CheckAccountStatus(user *models.User) error {
+	switch user.CurrentStatus() {
+	case models.UserStatusSuspended:
+		return utils.ErrAccountSuspended
+	case models.UserStatusBanned:
+		return utils.ErrAccountBanned
+	case models.UserStatusPending:
+		return utils.ErrAccountPending
 	}
+	return nil
+}
 
-	return user, nil
+// isAccountStatusError reports whether err is one of the errors of
+// CheckAccountStatus.
+func isAccountStatusError(err error) bool {
+	return errors.Is(err, utils.ErrAccountSuspended) || errors.Is(err, utils.ErrAccountBanned) || errors.Is(err, utils.ErrAccountPending)
 }
 
 func (us *UserService) GetUserByID(id uint) (*models.User, error) {
@@ -107,3 +149,94 @@ func (us *UserService) UpdateUser(user *models.User) error {
 	}
 	return nil
 }
+
+// ChangePassword replaces the user's password after checking the current
+// one.
+func (us *UserService) ChangePassword(userID uint, oldPassword, newPassword string, info RequestInfo) error {
+	user, err := us.UserRepository.GetByID(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if !utils.CheckPasswordHash(oldPassword, user.Password) {
+		return utils.ErrInvalidCredentials
+	}
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := us.UserRepository.UpdateColumns(userID, map[string]interface{}{"password": hashedPassword}); err != nil {
+		return err
+	}
+	us.AuditService.Record(info, models.AuditPasswordChanged, models.AuditTargetUser, userID, nil)
+	return nil
+}
+
+// GetProfile returns the public view of the user's own account.
+func (us *UserService) GetProfile(userID uint) (*models.UserResponse, error) {
+	user, err := us.UserRepository.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	response := NewUserResponse(user)
+	return &response, nil
+}
+
+// UpdateProfile changes the profile fields set in input and leaves the nil
+// ones alone.
+func (us *UserService) UpdateProfile(userID uint, input models.UpdateProfileInput) (*models.UserResponse, error) {
+	values := map[string]interface{}{}
+	if input.Name != nil {
+		values["name"] = *input.Name
+	}
+	if input.AvatarURL != nil {
+		values["avatar_url"] = *input.AvatarURL
+	}
+	if input.Locale != nil {
+		values["locale"] = *input.Locale
+	}
+	if input.Timezone != nil {
+		values["timezone"] = *input.Timezone
+	}
+	if len(values) > 0 {
+		if err := us.UserRepository.UpdateColumns(userID, values); err != nil {
+			return nil, err
+		}
+	}
+	return us.GetProfile(userID)
+}
+
+// NewUserResponse converts a user to the representation returned by the API.
+func NewUserResponse(user *models.User) models.UserResponse {
+	response := models.UserResponse{
+		ID:            user.ID,
+		Email:         user.Email,
+		Name:          user.Name,
+		AvatarURL:     user.AvatarURL,
+		Locale:        user.Locale,
+		Timezone:      user.Timezone,
+		Roles:         roleNames(user.Roles),
+		MFAEnabled:    user.MFAEnabled,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		HasPassword:   user.Password != "",
+		Status:        user.CurrentStatus(),
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+	}
+	if user.DeletedAt.Valid {
+		deletedAt := user.DeletedAt.Time
+		response.DeletedAt = &deletedAt
+	}
+	if !user.LastLogin.IsZero() {
+		lastLogin := user.LastLogin
+		response.LastLogin = &lastLogin
+	}
+	return response
+}
+
+func roleNames(roles []models.Role) []string {
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
@@ -0,0 +1,491 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"user-service/config"
+	"user-service/internal/models"
+	"user-service/internal/repositories"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	ceremonyRegistration = "registration"
+	ceremonyMFA          = "mfa"
+	ceremonyPasskey      = "passkey"
+	ceremonyReauth       = "reauth"
+)
+
+var (
+	ErrWebAuthnNoCredentials      = errors.New("no webauthn credentials registered")
+	ErrWebAuthnCredentialNotFound = errors.New("webauthn credential not found")
+	ErrWebAuthnVerification       = errors.New("webauthn verification failed")
+	ErrWebAuthnNotConfigured      = errors.New("webauthn is not configured")
+)
+
+// webAuthnUser adapts a user and their credentials to webauthn.User.
+type webAuthnUser struct {
+	user        *models.User
+	credentials []models.WebAuthnCredential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return userHandle(u.user.ID)
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Name
+}
+
+func (u *webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, c := range u.credentials {
+		id, _ := base64.RawURLEncoding.DecodeString(c.CredentialID)
+		var transports []protocol.AuthenticatorTransport
+		for _, t := range strings.Split(c.Transports, ",") {
+			if t != "" {
+				transports = append(transports, protocol.AuthenticatorTransport(t))
+			}
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              id,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{AAGUID: c.AAGUID, SignCount: c.SignCount},
+		})
+	}
+	return credentials
+}
+
+func (u *webAuthnUser) findCredential(id []byte) *models.WebAuthnCredential {
+	encoded := base64.RawURLEncoding.EncodeToString(id)
+	for i := range u.credentials {
+		if u.credentials[i].CredentialID == encoded {
+			return &u.credentials[i]
+		}
+	}
+	return nil
+}
+
+// userHandle is the WebAuthn user handle of a user: its ID as 8 big-endian bytes.
+func userHandle(userID uint) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+func userIDFromHandle(handle []byte) (uint, bool) {
+	if len(handle) != 8 {
+		return 0, false
+	}
+	return uint(binary.BigEndian.Uint64(handle)), true
+}
+
+type WebAuthnService struct {
+	WebAuthn            *webauthn.WebAuthn
+	UserRepository      *repositories.UserRepository
+	WebAuthnRepository  *repositories.WebAuthnRepository
+	MFAService          *MFAService
+	LoginHistoryService *LoginHistoryService
+	AuditService        *AuditService
+}
+
+// NewWebAuthnService configures the relying party from WEBAUTHN_RP_*. It
+// returns ErrWebAuthnNotConfigured when the relying party ID or name is
+// unset, in which case passkeys and security keys are unavailable.
+func NewWebAuthnService(ur *repositories.UserRepository, wr *repositories.WebAuthnRepository, ms *MFAService, lhs *LoginHistoryService, as *AuditService) (*WebAuthnService, error) {
+	cfg := config.AppConfig
+	if cfg.WebAuthnRPID == "" || cfg.WebAuthnRPName == "" {
+		return nil, ErrWebAuthnNotConfigured
+	}
+	var origins []string
+	for _, origin := range strings.Split(cfg.WebAuthnRPOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthnRPID,
+		RPDisplayName: cfg.WebAuthnRPName,
+		RPOrigins:     origins,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("configure webauthn: %w", err)
+	}
+	return &WebAuthnService{WebAuthn: wa, UserRepository: ur, WebAuthnRepository: wr, MFAService: ms, LoginHistoryService: lhs, AuditService: as}, nil
+}
+
+// BeginRegistration starts registering a new passkey or security key for
+// the user once they have re-authenticated. FinishRegistration only accepts
+// the challenge issued here, so the check covers the whole registration.
+func (ws *WebAuthnService) BeginRegistration(userID uint, input models.ReauthenticationInput) (*protocol.CredentialCreation, error) {
+	user, err := ws.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ws.MFAService.Reauthenticate(user.user, input); err != nil {
+		return nil, err
+	}
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, c := range user.WebAuthnCredentials() {
+		exclusions = append(exclusions, c.Descriptor())
+	}
+
+	creation, session, err := ws.WebAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := ws.saveChallenge(session, userID, ceremonyRegistration); err != nil {
+		return nil, err
+	}
+	return creation, nil
+}
+
+// FinishRegistration verifies the authenticator's attestation and stores the
+// credential. Registering the first second factor turns MFA on.
+func (ws *WebAuthnService) FinishRegistration(userID uint, name string, body io.Reader, info RequestInfo) (*models.WebAuthnRegistrationResponse, error) {
+	parsed, err := protocol.ParseCredentialCreationResponseBody(body)
+	if err != nil {
+		return nil, ErrWebAuthnVerification
+	}
+	session, err := ws.takeChallenge(parsed.Response.CollectedClientData.Challenge, ceremonyRegistration, userID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := ws.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := ws.WebAuthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return nil, ErrWebAuthnVerification
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+	if name == "" {
+		name = "Security key"
+	}
+	stored := models.WebAuthnCredential{
+		UserID:          userID,
+		CredentialID:    base64.RawURLEncoding.EncodeToString(credential.ID),
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		Transports:      strings.Join(transports, ","),
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		Name:            name,
+	}
+	if err := ws.WebAuthnRepository.CreateCredential(&stored); err != nil {
+		return nil, err
+	}
+	ws.AuditService.Record(info, models.AuditPasskeyAdded, models.AuditTargetUser, userID, map[string]interface{}{
+		"credential_id": stored.ID,
+		"name":          stored.Name,
+	})
+
+	response := &models.WebAuthnRegistrationResponse{Credential: toWebAuthnCredentialResponse(&stored)}
+	if !user.user.MFAEnabled {
+		if response.RecoveryCodes, err = ws.MFAService.EnableMFA(userID, info); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// BeginReauthentication starts an assertion with which a signed-in user
+// confirms a sensitive change to their account.
+func (ws *WebAuthnService) BeginReauthentication(userID uint) (*protocol.CredentialAssertion, error) {
+	user, err := ws.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.credentials) == 0 {
+		return nil, ErrWebAuthnNoCredentials
+	}
+	assertion, session, err := ws.WebAuthn.BeginLogin(user)
+	if err != nil {
+		return nil, err
+	}
+	if err := ws.saveChallenge(session, userID, ceremonyReauth); err != nil {
+		return nil, err
+	}
+	return assertion, nil
+}
+
+// VerifyReauthentication verifies an assertion for a challenge issued to
+// the user by BeginReauthentication.
+func (ws *WebAuthnService) VerifyReauthentication(userID uint, assertion []byte) error {
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(assertion))
+	if err != nil {
+		return ErrWebAuthnVerification
+	}
+	session, err := ws.takeChallenge(parsed.Response.CollectedClientData.Challenge, ceremonyReauth, userID)
+	if err != nil {
+		return err
+	}
+	user, err := ws.loadUser(userID)
+	if err != nil {
+		return err
+	}
+	credential, err := ws.WebAuthn.ValidateLogin(user, *session, parsed)
+	if err != nil {
+		return ErrWebAuthnVerification
+	}
+	return ws.recordUsage(user, credential)
+}
+
+// BeginMFALogin starts an assertion for a login that returned an MFA challenge.
+func (ws *WebAuthnService) BeginMFALogin(mfaToken string) (*protocol.CredentialAssertion, error) {
+	mfaUser, err := ws.MFAService.ParseMFAToken(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	user, err := ws.loadUser(mfaUser.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.credentials) == 0 {
+		return nil, ErrWebAuthnNoCredentials
+	}
+	assertion, session, err := ws.WebAuthn.BeginLogin(user)
+	if err != nil {
+		return nil, err
+	}
+	if err := ws.saveChallenge(session, user.user.ID, ceremonyMFA); err != nil {
+		return nil, err
+	}
+	return assertion, nil
+}
+
+// FinishMFALogin verifies the assertion of an MFA login and returns the user.
+// Failed assertions are recorded in the user's login history.
+func (ws *WebAuthnService) FinishMFALogin(body io.Reader, info RequestInfo) (*models.User, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return nil, ErrWebAuthnVerification
+	}
+	session, err := ws.takeChallenge(parsed.Response.CollectedClientData.Challenge, ceremonyMFA, 0)
+	if err != nil {
+		return nil, err
+	}
+	userID, ok := userIDFromHandle(session.UserID)
+	if !ok {
+		return nil, ErrWebAuthnVerification
+	}
+	user, err := ws.loadUser(userID)
+	if err != nil {
+		return nil, ErrWebAuthnVerification
+	}
+	credential, err := ws.WebAuthn.ValidateLogin(user, *session, parsed)
+	if err != nil {
+		ws.LoginHistoryService.RecordFailure(user.user, user.user.Email, models.LoginMethodSecurityKey, ErrWebAuthnVerification, info)
+		return nil, ErrWebAuthnVerification
+	}
+	if err := ws.recordUsage(user, credential); err != nil {
+		return nil, err
+	}
+	return user.user, nil
+}
+
+// BeginPasskeyLogin starts a passwordless login with a discoverable credential.
+func (ws *WebAuthnService) BeginPasskeyLogin() (*protocol.CredentialAssertion, error) {
+	assertion, session, err := ws.WebAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := ws.saveChallenge(session, 0, ceremonyPasskey); err != nil {
+		return nil, err
+	}
+	return assertion, nil
+}
+
+// FinishPasskeyLogin verifies a passkey assertion and returns the user it
+// belongs to. A user-verified passkey satisfies MFA on its own. Failed
+// assertions for a known user are recorded in their login history.
+func (ws *WebAuthnService) FinishPasskeyLogin(body io.Reader, info RequestInfo) (*models.User, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return nil, ErrWebAuthnVerification
+	}
+	session, err := ws.takeChallenge(parsed.Response.CollectedClientData.Challenge, ceremonyPasskey, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *webAuthnUser
+	credential, err := ws.WebAuthn.ValidateDiscoverableLogin(func(rawID, handle []byte) (webauthn.User, error) {
+		userID, ok := userIDFromHandle(handle)
+		if !ok {
+			return nil, ErrWebAuthnVerification
+		}
+		u, err := ws.loadUser(userID)
+		if err != nil {
+			return nil, err
+		}
+		user = u
+		return u, nil
+	}, *session, parsed)
+	if err != nil {
+		if user != nil {
+			ws.LoginHistoryService.RecordFailure(user.user, user.user.Email, models.LoginMethodPasskey, ErrWebAuthnVerification, info)
+		}
+		return nil, ErrWebAuthnVerification
+	}
+	if err := ws.recordUsage(user, credential); err != nil {
+		return nil, err
+	}
+	return user.user, nil
+}
+
+func (ws *WebAuthnService) ListCredentials(userID uint) ([]models.WebAuthnCredentialResponse, error) {
+	credentials, err := ws.WebAuthnRepository.ListCredentialsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]models.WebAuthnCredentialResponse, 0, len(credentials))
+	for i := range credentials {
+		response = append(response, toWebAuthnCredentialResponse(&credentials[i]))
+	}
+	return response, nil
+}
+
+// DeleteCredential removes a credential once the user has re-authenticated.
+// If it was the user's only second factor, MFA is turned off.
+func (ws *WebAuthnService) DeleteCredential(userID, credentialID uint, input models.ReauthenticationInput, info RequestInfo) error {
+	user, err := ws.UserRepository.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := ws.MFAService.Reauthenticate(user, input); err != nil {
+		return err
+	}
+	deleted, err := ws.WebAuthnRepository.DeleteCredential(userID, credentialID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrWebAuthnCredentialNotFound
+	}
+	ws.AuditService.Record(info, models.AuditPasskeyRemoved, models.AuditTargetUser, userID, map[string]interface{}{
+		"credential_id": credentialID,
+	})
+
+	remaining, err := ws.loadUser(userID)
+	if err != nil {
+		return err
+	}
+	if remaining.user.MFAEnabled && remaining.user.TOTPSecret == "" && len(remaining.credentials) == 0 {
+		if err := ws.MFAService.turnOffMFA(userID); err != nil {
+			return err
+		}
+		ws.MFAService.recordMFAChange(info, userID, false, models.LoginMethodSecurityKey)
+	}
+	return nil
+}
+
+func (ws *WebAuthnService) loadUser(userID uint) (*webAuthnUser, error) {
+	user, err := ws.UserRepository.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := ws.WebAuthnRepository.ListCredentialsByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &webAuthnUser{user: user, credentials: credentials}, nil
+}
+
+// recordUsage stores the new signature counter. A counter that did not
+// increase points to a cloned authenticator and fails the login.
+func (ws *WebAuthnService) recordUsage(user *webAuthnUser, credential *webauthn.Credential) error {
+	if credential.Authenticator.CloneWarning {
+		return ErrWebAuthnVerification
+	}
+	stored := user.findCredential(credential.ID)
+	if stored == nil {
+		return ErrWebAuthnVerification
+	}
+	return ws.WebAuthnRepository.UpdateCredentialUsage(stored.ID, credential.Authenticator.SignCount, credential.Flags.BackupState)
+}
+
+func (ws *WebAuthnService) saveChallenge(session *webauthn.SessionData, userID uint, ceremony string) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	expiresAt := session.Expires
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(time.Minute * 5)
+	}
+	return ws.WebAuthnRepository.CreateChallenge(&models.WebAuthnChallenge{
+		Challenge:   session.Challenge,
+		UserID:      userID,
+		Ceremony:    ceremony,
+		SessionData: string(data),
+		ExpiresAt:   expiresAt,
+	})
+}
+
+// takeChallenge loads the session data of a ceremony. For registrations and
+// re-authentications the challenge must have been issued to userID.
+func (ws *WebAuthnService) takeChallenge(challenge, ceremony string, userID uint) (*webauthn.SessionData, error) {
+	stored, err := ws.WebAuthnRepository.TakeChallenge(challenge, ceremony)
+	if err != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, ErrWebAuthnVerification
+	}
+	if userID != 0 && stored.UserID != userID {
+		return nil, ErrWebAuthnVerification
+	}
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(stored.SessionData), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func toWebAuthnCredentialResponse(c *models.WebAuthnCredential) models.WebAuthnCredentialResponse {
+	transports := []string{}
+	if c.Transports != "" {
+		transports = strings.Split(c.Transports, ",")
+	}
+	return models.WebAuthnCredentialResponse{
+		ID:             c.ID,
+		Name:           c.Name,
+		Transports:     transports,
+		BackupEligible: c.BackupEligible,
+		CreatedAt:      c.CreatedAt,
+		LastUsedAt:     c.LastUsedAt,
+	}
+}
@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"user-service/config"
+)
+
+// Message is a single outgoing email. HTML is optional; when it is set the
+// message is sent as multipart/alternative with Text as the plain part.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers email. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New returns the mailer selected by MAIL_DRIVER: "smtp", "file" or "log"
+// (the default).
+func New() (Mailer, error) {
+	cfg := config.AppConfig
+	switch strings.ToLower(cfg.MailDriver) {
+	case "smtp":
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom), nil
+	case "file":
+		return NewFileMailer(cfg.MailFileDir, cfg.MailFrom)
+	case "", "log":
+		return NewLogMailer(), nil
+	}
+	return nil, fmt.Errorf("unknown mail driver %q", cfg.MailDriver)
+}
+
+// LogMailer writes messages to the application log instead of sending them.
+// It is meant for local development.
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("mail to=%q subject=%q\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
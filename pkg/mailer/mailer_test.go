@@ -0,0 +1,153 @@
+package mailer
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type resetData struct {
+	Name             string
+	Link             string
+	ExpiresInMinutes int
+}
+
+func TestRenderLocaleFallback(t *testing.T) {
+	data := resetData{Name: "Alice", Link: "https://app.example/reset?token=t", ExpiresInMinutes: 30}
+	tests := []struct {
+		locale  string
+		subject string
+	}{
+		{"", "Reset your password"},
+		{"en", "Reset your password"},
+		{"vi", "Đặt lại mật khẩu"},
+		{"vi_VN", "Đặt lại mật khẩu"},
+		{"VI-vn", "Đặt lại mật khẩu"},
+		{"fr-FR", "Reset your password"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			msg, err := Render("password_reset", tt.locale, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Subject != tt.subject {
+				t.Fatalf("subject %q, want %q", msg.Subject, tt.subject)
+			}
+			if !strings.Contains(msg.Text, data.Link) || msg.HTML == "" {
+				t.Fatalf("text or HTML part missing: %+v", msg)
+			}
+		})
+	}
+
+	if _, err := Render("no_such_template", "en", data); err == nil {
+		t.Fatal("missing template rendered")
+	}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	msg, err := Render("password_reset", "en", resetData{Name: "<script>x</script>", Link: "https://app.example/reset"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(msg.HTML, "<script>") {
+		t.Fatalf("HTML part is not escaped: %s", msg.HTML)
+	}
+	if !strings.Contains(msg.Text, "<script>x</script>") {
+		t.Fatalf("text part should be left as is: %s", msg.Text)
+	}
+}
+
+func TestBuildMessage(t *testing.T) {
+	raw, err := buildMessage("Accounts <no-reply@example.com>", Message{
+		To:      "Alice <alice@example.com>",
+		Subject: "Đặt lại mật khẩu\r\nBcc: evil@example.com",
+		Text:    "Xin chào Alice,\nline two",
+		HTML:    "<p>Xin chào Alice</p>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("Bcc") != "" {
+		t.Fatal("subject injected a header")
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || !strings.HasPrefix(subject, "Đặt lại mật khẩu") {
+		t.Fatalf("subject %q: %v", subject, err)
+	}
+	if to, err := mail.ParseAddress(msg.Header.Get("To")); err != nil || to.Address != "alice@example.com" {
+		t.Fatalf("to %q: %v", msg.Header.Get("To"), err)
+	}
+	if !strings.HasSuffix(msg.Header.Get("Message-ID"), "@example.com>") {
+		t.Fatalf("message ID %q", msg.Header.Get("Message-ID"))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type %q: %v", msg.Header.Get("Content-Type"), err)
+	}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, part.Header.Get("Content-Type")+"|"+string(body))
+	}
+	want := []string{
+		"text/plain; charset=utf-8|Xin chào Alice,\r\nline two",
+		"text/html; charset=utf-8|<p>Xin chào Alice</p>",
+	}
+	if strings.Join(parts, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("parts %q, want %q", parts, want)
+	}
+}
+
+func TestBuildMessageRejectsBadRecipient(t *testing.T) {
+	if _, err := buildMessage("no-reply@example.com", Message{To: "alice@example.com\r\nBcc: evil@example.com", Subject: "s", Text: "t"}); err == nil {
+		t.Fatal("recipient with a header break was accepted")
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewFileMailer(dir, "no-reply@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send(Message{To: "alice@example.com", Subject: "Hello", Text: "Hi"}); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "new", "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("delivered files %v: %v", files, err)
+	}
+	if tmp, _ := os.ReadDir(filepath.Join(dir, "tmp")); len(tmp) != 0 {
+		t.Fatalf("files left in tmp: %v", tmp)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "To: <alice@example.com>") {
+		t.Fatalf("unexpected message:\n%s", data)
+	}
+}
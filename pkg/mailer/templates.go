@@ -0,0 +1,86 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	texttemplate "text/template"
+)
+
+// DefaultLocale is used when a template has no variant for the requested
+// locale.
+const DefaultLocale = "en"
+
+// Templates live in templates/<locale>/<name>.{subject.txt,txt,html}. The
+// subject and text parts are required, the HTML part is optional.
+//
+//go:embed templates
+var templateFS embed.FS
+
+// Render builds a message (without recipient) from the named template in the
+// closest available locale: "vi-VN" falls back to "vi" and then to
+// DefaultLocale.
+func Render(name, locale string, data interface{}) (Message, error) {
+	dir, err := resolveLocale(name, locale)
+	if err != nil {
+		return Message{}, err
+	}
+	base := "templates/" + dir + "/" + name
+
+	subject, err := renderText(base+".subject.txt", data)
+	if err != nil {
+		return Message{}, err
+	}
+	text, err := renderText(base+".txt", data)
+	if err != nil {
+		return Message{}, err
+	}
+	msg := Message{Subject: strings.TrimSpace(subject), Text: text}
+
+	if _, err := fs.Stat(templateFS, base+".html"); err == nil {
+		tmpl, err := htmltemplate.ParseFS(templateFS, base+".html")
+		if err != nil {
+			return Message{}, err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return Message{}, err
+		}
+		msg.HTML = buf.String()
+	}
+	return msg, nil
+}
+
+func resolveLocale(name, locale string) (string, error) {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	candidates := []string{locale}
+	if i := strings.Index(locale, "-"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	candidates = append(candidates, DefaultLocale)
+
+	for _, candidate := range candidates {
+		if candidate == "" {
+			continue
+		}
+		if _, err := fs.Stat(templateFS, "templates/"+candidate+"/"+name+".txt"); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("mail template %q not found", name)
+}
+
+func renderText(path string, data interface{}) (string, error) {
+	tmpl, err := texttemplate.ParseFS(templateFS, path)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,123 @@
+package social
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// idTokenLeeway tolerates clock skew between us and the provider.
+const idTokenLeeway = time.Minute
+
+// tenantPlaceholder stands for the tenant in the issuer published by
+// multi-tenant providers such as Microsoft's "common" endpoint. The tenant of
+// a token is its "tid" claim.
+const tenantPlaceholder = "{tenantid}"
+
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// verifyIDToken checks the signature of an OpenID Connect ID token against
+// the provider's keys, and its issuer, audience, expiry and (when nonce is
+// not empty) nonce. It returns the token's claims.
+func verifyIDToken(ctx context.Context, raw string, keys *KeySet, issuers, audiences []string, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	_, err := parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := keys.Key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		switch key.(type) {
+		case *rsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+			}
+		case *ecdsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+				return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+			}
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	now := time.Now()
+	if iss, _ := claims["iss"].(string); !issuerMatches(issuers, iss, claims["tid"]) {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, iss)
+	}
+	if !audienceMatches(claims["aud"], audiences) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidIDToken)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(idTokenLeeway)) {
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidIDToken)
+	}
+	if iat, ok := claims["iat"].(float64); ok && time.Unix(int64(iat), 0).After(now.Add(idTokenLeeway)) {
+		return nil, fmt.Errorf("%w: token issued in the future", ErrInvalidIDToken)
+	}
+	if nonce != "" {
+		got, _ := claims["nonce"].(string)
+		if subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+			return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+		}
+	}
+	return claims, nil
+}
+
+// issuerMatches compares iss with the expected issuers, filling in the
+// token's tenant for tenantPlaceholder.
+func issuerMatches(issuers []string, iss string, tid interface{}) bool {
+	tenant, _ := tid.(string)
+	for _, issuer := range issuers {
+		if strings.Contains(issuer, tenantPlaceholder) {
+			if tenant == "" || strings.ContainsAny(tenant, "/?#") {
+				continue
+			}
+			issuer = strings.ReplaceAll(issuer, tenantPlaceholder, tenant)
+		}
+		if issuer == iss {
+			return true
+		}
+	}
+	return false
+}
+
+// audienceMatches accepts "aud" as a string or an array of strings.
+func audienceMatches(aud interface{}, audiences []string) bool {
+	var values []string
+	switch v := aud.(type) {
+	case string:
+		values = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	for _, value := range values {
+		if contains(audiences, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+package social
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// testKeys serves a JWKS document for RSA keys that can be rotated while
+// the test runs.
+type testKeys struct {
+	t   *testing.T
+	srv *httptest.Server
+
+	mu      sync.Mutex
+	keys    map[string]*rsa.PrivateKey
+	fetches int
+}
+
+func newTestKeys(t *testing.T, kids ...string) *testKeys {
+	t.Helper()
+	tk := &testKeys{t: t, keys: map[string]*rsa.PrivateKey{}}
+	for _, kid := range kids {
+		tk.add(kid)
+	}
+	tk.srv = httptest.NewServer(http.HandlerFunc(tk.serveJWKS))
+	t.Cleanup(tk.srv.Close)
+	return tk
+}
+
+func (tk *testKeys) add(kid string) {
+	tk.t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		tk.t.Fatal(err)
+	}
+	tk.mu.Lock()
+	tk.keys[kid] = key
+	tk.mu.Unlock()
+}
+
+func (tk *testKeys) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+	tk.fetches++
+	var keys []jsonWebKey
+	for kid, key := range tk.keys {
+		keys = append(keys, jsonWebKey{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+}
+
+func (tk *testKeys) remove(kid string) {
+	tk.mu.Lock()
+	delete(tk.keys, kid)
+	tk.mu.Unlock()
+}
+
+func (tk *testKeys) fetchCount() int {
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+	return tk.fetches
+}
+
+func (tk *testKeys) keySet() *KeySet {
+	return NewKeySet(tk.srv.URL, tk.srv.Client())
+}
+
+// sign returns an RS256 token signed with the key named kid.
+func (tk *testKeys) sign(kid string, claims jwt.MapClaims) string {
+	tk.t.Helper()
+	tk.mu.Lock()
+	key := tk.keys[kid]
+	tk.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(key)
+	if err != nil {
+		tk.t.Fatal(err)
+	}
+	return raw
+}
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testClientID = "client-1"
+)
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":   testIssuer,
+		"aud":   testClientID,
+		"sub":   "user-1",
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"nonce": "n-1",
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	tk := newTestKeys(t, "k1")
+	other := newTestKeys(t, "k1")
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		edit  func(jwt.MapClaims)
+		keys  *testKeys
+		nonce string
+		ok    bool
+	}{
+		{name: "valid", edit: func(jwt.MapClaims) {}, ok: true},
+		{name: "audience in list", edit: func(c jwt.MapClaims) { c["aud"] = []interface{}{"other", testClientID} }, ok: true},
+		{name: "no nonce expected", edit: func(c jwt.MapClaims) { delete(c, "nonce") }, nonce: "-", ok: true},
+		{name: "expired within leeway", edit: func(c jwt.MapClaims) { c["exp"] = now.Add(-idTokenLeeway / 2).Unix() }, ok: true},
+		{name: "wrong issuer", edit: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "missing issuer", edit: func(c jwt.MapClaims) { delete(c, "iss") }},
+		{name: "wrong audience", edit: func(c jwt.MapClaims) { c["aud"] = "client-2" }},
+		{name: "missing audience", edit: func(c jwt.MapClaims) { delete(c, "aud") }},
+		{name: "expired", edit: func(c jwt.MapClaims) { c["exp"] = now.Add(-2 * idTokenLeeway).Unix() }},
+		{name: "missing expiry", edit: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "issued in the future", edit: func(c jwt.MapClaims) { c["iat"] = now.Add(2 * idTokenLeeway).Unix() }},
+		{name: "wrong nonce", edit: func(c jwt.MapClaims) { c["nonce"] = "n-2" }},
+		{name: "missing nonce", edit: func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{name: "signed by another key", edit: func(jwt.MapClaims) {}, keys: other},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.edit(claims)
+			signer := tk
+			if tt.keys != nil {
+				signer = tt.keys
+			}
+			nonce := "n-1"
+			if tt.nonce == "-" {
+				nonce = ""
+			}
+			got, err := verifyIDToken(context.Background(), signer.sign("k1", claims), tk.keySet(), []string{testIssuer}, []string{testClientID}, nonce)
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got["sub"] != "user-1" {
+					t.Fatalf("sub = %v", got["sub"])
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("want ErrInvalidIDToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	tk := newTestKeys(t, "k1")
+	keys := tk.keySet()
+	verify := func(kid string) error {
+		_, err := verifyIDToken(ctx, tk.sign(kid, validClaims()), keys, []string{testIssuer}, []string{testClientID}, "n-1")
+		return err
+	}
+
+	if err := verify("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := tk.fetchCount(); n != 1 {
+		t.Fatalf("known key fetched the JWKS %d times, want 1", n)
+	}
+
+	// The provider starts signing with a new key. Unknown keys are looked
+	// up at most once per minJWKSRefresh.
+	tk.add("k2")
+	if err := verify("k2"); err == nil {
+		t.Fatal("new key accepted before the JWKS could be refetched")
+	}
+	keys.mu.Lock()
+	keys.fetchedAt = keys.fetchedAt.Add(-2 * minJWKSRefresh)
+	keys.mu.Unlock()
+	if err := verify("k2"); err != nil {
+		t.Fatalf("rotated key: %v", err)
+	}
+	if n := tk.fetchCount(); n != 2 {
+		t.Fatalf("JWKS fetched %d times, want 2", n)
+	}
+
+	// Keys dropped from the set stop verifying once the cache expires.
+	retired := tk.sign("k1", validClaims())
+	tk.remove("k1")
+	keys.mu.Lock()
+	keys.expiresAt = time.Now().Add(-time.Second)
+	keys.mu.Unlock()
+	if _, err := verifyIDToken(ctx, retired, keys, []string{testIssuer}, []string{testClientID}, "n-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("removed key: want ErrInvalidIDToken, got %v", err)
+	}
+	if err := verify("k2"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyIDTokenTenantIssuer(t *testing.T) {
+	tk := newTestKeys(t, "k1")
+	issuers := []string{"https://login.microsoftonline.com/{tenantid}/v2.0"}
+
+	tests := []struct {
+		name string
+		iss  string
+		tid  interface{}
+		ok   bool
+	}{
+		{"tenant filled in", "https://login.microsoftonline.com/t1/v2.0", "t1", true},
+		{"other tenant", "https://login.microsoftonline.com/t2/v2.0", "t1", false},
+		{"no tenant claim", "https://login.microsoftonline.com/t1/v2.0", nil, false},
+		{"placeholder literal", "https://login.microsoftonline.com/{tenantid}/v2.0", nil, false},
+		{"tenant with path", "https://evil.example.com/v2.0", "../../evil.example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			claims["iss"] = tt.iss
+			if tt.tid != nil {
+				claims["tid"] = tt.tid
+			}
+			_, err := verifyIDToken(context.Background(), tk.sign("k1", claims), tk.keySet(), issuers, []string{testClientID}, "n-1")
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("want ErrInvalidIDToken, got %v", err)
+			}
+		})
+	}
+}
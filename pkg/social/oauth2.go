@@ -0,0 +1,352 @@
+package social
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"user-service/config"
+
+	"golang.org/x/oauth2"
+)
+
+const httpTimeout = time.Second * 10
+
+// Discovery is the part of an OpenID Connect discovery document we use.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OAuth2Provider logs users in with the authorization code flow and reads
+// their identity from the user info endpoint. OIDC providers have their
+// endpoints discovered on first use, and their ID token is verified.
+type OAuth2Provider struct {
+	cfg        config.SocialProviderConfig
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	oauthConfig *oauth2.Config
+	keys        *KeySet
+}
+
+func NewOAuth2Provider(cfg config.SocialProviderConfig) (*OAuth2Provider, error) {
+	cfg = withPreset(cfg)
+	switch cfg.Type {
+	case "oidc":
+		if cfg.DiscoveryURL == "" && (cfg.AuthURL == "" || cfg.TokenURL == "" || cfg.UserInfoURL == "" || cfg.JWKSURL == "" || cfg.Issuer == "") {
+			return nil, errors.New("an OIDC provider needs a discovery URL, or all endpoints, a JWKS URL and an issuer")
+		}
+		defaultClaims(&cfg, "sub", "email", "email_verified", "name", "picture")
+		if len(cfg.Scopes) == 0 {
+			cfg.Scopes = []string{"openid", "email", "profile"}
+		}
+	case "oauth2":
+		if cfg.AuthURL == "" || cfg.TokenURL == "" || cfg.UserInfoURL == "" {
+			return nil, errors.New("an OAuth2 provider needs auth, token and user info URLs")
+		}
+		defaultClaims(&cfg, "id", "email", "", "name", "picture")
+	default:
+		return nil, fmt.Errorf("unknown provider type %q", cfg.Type)
+	}
+	if cfg.ClientID == "" {
+		return nil, errors.New("client ID is not configured")
+	}
+	if cfg.RedirectURL == "" {
+		cfg.RedirectURL = strings.TrimRight(config.AppConfig.OIDCIssuer, "/") + "/auth/" + cfg.Name + "/callback"
+	}
+	return &OAuth2Provider{cfg: cfg, httpClient: &http.Client{Timeout: httpTimeout}}, nil
+}
+
+func defaultClaims(cfg *config.SocialProviderConfig, id, email, emailVerified, name, picture string) {
+	if cfg.ClaimID == "" {
+		cfg.ClaimID = id
+	}
+	if cfg.ClaimEmail == "" {
+		cfg.ClaimEmail = email
+	}
+	if cfg.ClaimEmailVerified == "" {
+		cfg.ClaimEmailVerified = emailVerified
+	}
+	if cfg.ClaimName == "" {
+		cfg.ClaimName = name
+	}
+	if cfg.ClaimPicture == "" {
+		cfg.ClaimPicture = picture
+	}
+}
+
+func (p *OAuth2Provider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *OAuth2Provider) AuthCodeURL(ctx context.Context, req AuthRequest) (string, error) {
+	oauthConfig, err := p.config(ctx)
+	if err != nil {
+		return "", err
+	}
+	var opts []oauth2.AuthCodeOption
+	if req.CodeVerifier != "" {
+		opts = append(opts, oauth2.S256ChallengeOption(req.CodeVerifier))
+	}
+	if p.cfg.Type == "oidc" && req.Nonce != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", req.Nonce))
+	}
+	return oauthConfig.AuthCodeURL(req.State, opts...), nil
+}
+
+func (p *OAuth2Provider) Exchange(ctx context.Context, code string, req AuthRequest) (*Identity, error) {
+	oauthConfig, err := p.config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.httpClient)
+	var opts []oauth2.AuthCodeOption
+	if req.CodeVerifier != "" {
+		opts = append(opts, oauth2.VerifierOption(req.CodeVerifier))
+	}
+	token, err := oauthConfig.Exchange(ctx, code, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code for token: %v", err)
+	}
+	client := oauthConfig.Client(ctx, token)
+
+	// The ID token proves the response was issued for this client and, via
+	// the nonce, for this login attempt.
+	var subject string
+	if p.cfg.Type == "oidc" {
+		rawIDToken, _ := token.Extra("id_token").(string)
+		if rawIDToken == "" {
+			return nil, fmt.Errorf("%w: token response has no ID token", ErrInvalidIDToken)
+		}
+		keys, issuers, err := p.verifier(ctx)
+		if err != nil {
+			return nil, err
+		}
+		idClaims, err := verifyIDToken(ctx, rawIDToken, keys, issuers, []string{p.cfg.ClientID}, req.Nonce)
+		if err != nil {
+			return nil, err
+		}
+		subject, _ = idClaims["sub"].(string)
+	}
+
+	var claims map[string]interface{}
+	if err := getJSON(ctx, client, p.cfg.UserInfoURL, &claims); err != nil {
+		return nil, fmt.Errorf("failed to get user info: %v", err)
+	}
+	identity := &Identity{
+		ProviderID: claimString(claims, p.cfg.ClaimID),
+		Email:      claimString(claims, p.cfg.ClaimEmail),
+		Name:       claimString(claims, p.cfg.ClaimName),
+		AvatarURL:  claimString(claims, p.cfg.ClaimPicture),
+	}
+	if p.cfg.ClaimEmailVerified != "" {
+		identity.EmailVerified = claimBool(claims, p.cfg.ClaimEmailVerified)
+	} else {
+		identity.EmailVerified = p.cfg.TrustEmail && identity.Email != ""
+	}
+	if p.cfg.EmailsURL != "" && (identity.Email == "" || !identity.EmailVerified) {
+		if email, verified, err := p.primaryEmail(ctx, client); err == nil && email != "" {
+			identity.Email, identity.EmailVerified = email, verified
+		}
+	}
+	if identity.ProviderID == "" {
+		return nil, errors.New("user info has no account ID")
+	}
+	if subject != "" && identity.ProviderID != subject {
+		return nil, errors.New("user info does not belong to the ID token subject")
+	}
+	if identity.Name == "" {
+		identity.Name = identity.Email
+	}
+	return identity, nil
+}
+
+// VerifyIDToken signs in with an ID token issued to this provider's client
+// ID or one of its extra audiences. The identity is read from the token's
+// claims, so the user info endpoint is not called.
+func (p *OAuth2Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*Identity, error) {
+	if p.cfg.Type != "oidc" {
+		return nil, ErrIDTokenNotSupported
+	}
+	keys, issuers, err := p.verifier(ctx)
+	if err != nil {
+		return nil, err
+	}
+	audiences := append([]string{p.cfg.ClientID}, p.cfg.Audiences...)
+	claims, err := verifyIDToken(ctx, rawIDToken, keys, issuers, audiences, nonce)
+	if err != nil {
+		return nil, err
+	}
+	identity := &Identity{
+		ProviderID:    claimString(claims, p.cfg.ClaimID),
+		Email:         claimString(claims, p.cfg.ClaimEmail),
+		EmailVerified: claimBool(claims, p.cfg.ClaimEmailVerified),
+		Name:          claimString(claims, p.cfg.ClaimName),
+		AvatarURL:     claimString(claims, p.cfg.ClaimPicture),
+	}
+	if identity.ProviderID == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalidIDToken)
+	}
+	if identity.Email == "" {
+		return nil, fmt.Errorf("%w: token has no email; request the email scope", ErrInvalidIDToken)
+	}
+	if identity.Name == "" {
+		identity.Name = identity.Email
+	}
+	return identity, nil
+}
+
+// verifier returns the keys and issuers ID tokens are checked against.
+// Discovery only runs when they are not configured.
+func (p *OAuth2Provider) verifier(ctx context.Context) (*KeySet, []string, error) {
+	p.mu.Lock()
+	ready := p.cfg.JWKSURL != "" && p.cfg.Issuer != ""
+	p.mu.Unlock()
+	if !ready {
+		if _, err := p.config(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.keys == nil {
+		p.keys = NewKeySet(p.cfg.JWKSURL, p.httpClient)
+	}
+	return p.keys, append([]string{p.cfg.Issuer}, issuerAliases[p.cfg.Issuer]...), nil
+}
+
+// primaryEmail reads the primary address from a GitHub style emails
+// endpoint, which also reports whether it is verified.
+func (p *OAuth2Provider) primaryEmail(ctx context.Context, client *http.Client) (string, bool, error) {
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, client, p.cfg.EmailsURL, &emails); err != nil {
+		return "", false, err
+	}
+	for _, e := range emails {
+		if e.Primary {
+			return e.Email, e.Verified, nil
+		}
+	}
+	return "", false, nil
+}
+
+// config returns the oauth2 configuration, running OIDC discovery the first
+// time it is needed. A failed discovery is retried on the next call.
+func (p *OAuth2Provider) config(ctx context.Context) (*oauth2.Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oauthConfig != nil {
+		return p.oauthConfig, nil
+	}
+
+	authURL, tokenURL := p.cfg.AuthURL, p.cfg.TokenURL
+	if p.cfg.Type == "oidc" && p.cfg.DiscoveryURL != "" {
+		var discovery Discovery
+		if err := getJSON(ctx, p.httpClient, p.cfg.DiscoveryURL, &discovery); err != nil {
+			return nil, fmt.Errorf("OIDC discovery failed: %v", err)
+		}
+		if p.cfg.Issuer == "" {
+			p.cfg.Issuer = discovery.Issuer
+		}
+		if p.cfg.JWKSURL == "" {
+			p.cfg.JWKSURL = discovery.JWKSURI
+		}
+		if authURL == "" {
+			authURL = discovery.AuthorizationEndpoint
+		}
+		if tokenURL == "" {
+			tokenURL = discovery.TokenEndpoint
+		}
+		if p.cfg.UserInfoURL == "" {
+			p.cfg.UserInfoURL = discovery.UserInfoEndpoint
+		}
+		if authURL == "" || tokenURL == "" || p.cfg.UserInfoURL == "" || p.cfg.JWKSURL == "" || p.cfg.Issuer == "" {
+			return nil, errors.New("OIDC discovery document is missing endpoints")
+		}
+	}
+	p.oauthConfig = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Scopes:       p.cfg.Scopes,
+		Endpoint:     oauth2.Endpoint{AuthURL: authURL, TokenURL: tokenURL},
+	}
+	return p.oauthConfig, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return decodeJSON(resp.Body, v)
+}
+
+// decodeJSON decodes at most 1 MiB, keeping numbers as json.Number so large
+// account IDs are not rounded.
+func decodeJSON(r io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(io.LimitReader(r, 1<<20))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// claim looks up a dotted path such as "picture.data.url".
+func claim(claims map[string]interface{}, path string) interface{} {
+	if path == "" {
+		return nil
+	}
+	var value interface{} = claims
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+func claimString(claims map[string]interface{}, path string) string {
+	switch v := claim(claims, path).(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	return ""
+}
+
+// claimBool accepts booleans and the string form some providers send.
+func claimBool(claims map[string]interface{}, path string) bool {
+	switch v := claim(claims, path).(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	}
+	return false
+}
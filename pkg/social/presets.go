@@ -0,0 +1,91 @@
+package social
+
+import "user-service/config"
+
+// presets hold the well-known settings of supported providers. Configured
+// values always take precedence.
+var presets = map[string]config.SocialProviderConfig{
+	"google": {
+		Type:         "oidc",
+		DiscoveryURL: "https://accounts.google.com/.well-known/openid-configuration",
+		Issuer:       "https://accounts.google.com",
+		JWKSURL:      "https://www.googleapis.com/oauth2/v3/certs",
+		Scopes:       []string{"openid", "email", "profile"},
+	},
+	"microsoft": {
+		Type:         "oidc",
+		DiscoveryURL: "https://login.microsoftonline.com/common/v2.0/.well-known/openid-configuration",
+		Scopes:       []string{"openid", "email", "profile"},
+	},
+	"gitlab": {
+		Type:         "oidc",
+		DiscoveryURL: "https://gitlab.com/.well-known/openid-configuration",
+		Scopes:       []string{"openid", "email", "profile"},
+	},
+	"github": {
+		Type:         "oauth2",
+		AuthURL:      "https://github.com/login/oauth/authorize",
+		TokenURL:     "https://github.com/login/oauth/access_token",
+		UserInfoURL:  "https://api.github.com/user",
+		EmailsURL:    "https://api.github.com/user/emails",
+		Scopes:       []string{"read:user", "user:email"},
+		ClaimID:      "id",
+		ClaimName:    "name",
+		ClaimPicture: "avatar_url",
+	},
+	"facebook": {
+		Type:         "oauth2",
+		AuthURL:      "https://www.facebook.com/v19.0/dialog/oauth",
+		TokenURL:     "https://graph.facebook.com/v19.0/oauth/access_token",
+		UserInfoURL:  "https://graph.facebook.com/me?fields=id,name,email,picture",
+		Scopes:       []string{"email", "public_profile"},
+		ClaimID:      "id",
+		ClaimPicture: "picture.data.url",
+		// Facebook only returns email addresses the user has confirmed.
+		TrustEmail: true,
+	},
+}
+
+// issuerAliases are other issuer values a provider puts in its ID tokens.
+var issuerAliases = map[string][]string{
+	// Google Sign-In on Android still issues tokens without the scheme.
+	"https://accounts.google.com": {"accounts.google.com"},
+}
+
+// withPreset fills the empty settings of cfg from its preset.
+func withPreset(cfg config.SocialProviderConfig) config.SocialProviderConfig {
+	presetName := cfg.Type
+	if presetName == "" {
+		presetName = cfg.Name
+	}
+	preset, ok := presets[presetName]
+	if !ok {
+		return cfg
+	}
+	cfg.Type = preset.Type
+	fill := func(value *string, fallback string) {
+		if *value == "" {
+			*value = fallback
+		}
+	}
+	// The preset's issuer and keys only go with its own discovery document.
+	if cfg.DiscoveryURL == "" {
+		fill(&cfg.Issuer, preset.Issuer)
+		fill(&cfg.JWKSURL, preset.JWKSURL)
+	}
+	fill(&cfg.DiscoveryURL, preset.DiscoveryURL)
+	fill(&cfg.AuthURL, preset.AuthURL)
+	fill(&cfg.TokenURL, preset.TokenURL)
+	fill(&cfg.UserInfoURL, preset.UserInfoURL)
+	fill(&cfg.EmailsURL, preset.EmailsURL)
+	fill(&cfg.ClaimID, preset.ClaimID)
+	fill(&cfg.ClaimEmail, preset.ClaimEmail)
+	fill(&cfg.ClaimEmailVerified, preset.ClaimEmailVerified)
+	fill(&cfg.ClaimName, preset.ClaimName)
+	fill(&cfg.ClaimPicture, preset.ClaimPicture)
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = preset.Scopes
+	}
+	cfg.TrustEmail = cfg.TrustEmail || preset.TrustEmail
+	return cfg
+}
@@ -0,0 +1,121 @@
+// Package social implements login through external OAuth2 and OpenID
+// Connect providers such as Google or GitHub.
+package social
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"user-service/config"
+
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrUnknownProvider     = errors.New("unknown login provider")
+	ErrIDTokenNotSupported = errors.New("login provider does not support ID token sign-in")
+)
+
+// Identity is the user as described by a login provider.
+type Identity struct {
+	// ProviderID is the stable account ID at the provider (the OIDC "sub").
+	ProviderID    string
+	Email         string
+	EmailVerified bool
+	Name          string
+	AvatarURL     string
+}
+
+// AuthRequest holds the per-login secrets that bind a provider callback to
+// the browser that started the login: the OAuth state, the OIDC nonce and
+// the PKCE code verifier.
+type AuthRequest struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+// NewAuthRequest generates fresh random values for a login.
+func NewAuthRequest() (AuthRequest, error) {
+	state, err := randomString()
+	if err != nil {
+		return AuthRequest{}, err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return AuthRequest{}, err
+	}
+	return AuthRequest{State: state, Nonce: nonce, CodeVerifier: oauth2.GenerateVerifier()}, nil
+}
+
+// Provider is an external login provider.
+type Provider interface {
+	Name() string
+	// AuthCodeURL returns the provider's authorization URL for the request,
+	// including the PKCE challenge and, for OIDC providers, the nonce.
+	AuthCodeURL(ctx context.Context, req AuthRequest) (string, error)
+	// Exchange redeems an authorization code and returns the user it
+	// belongs to. Values of req that are empty are not checked, which is
+	// only appropriate for codes obtained outside of AuthCodeURL.
+	Exchange(ctx context.Context, code string, req AuthRequest) (*Identity, error)
+}
+
+// IDTokenVerifier is implemented by providers that can sign users in with
+// an ID token the client obtained itself, as mobile apps do with Google
+// Sign-In, instead of going through the redirect.
+type IDTokenVerifier interface {
+	// VerifyIDToken checks the token and returns the user it identifies.
+	// An empty nonce is not checked.
+	VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*Identity, error)
+}
+
+// Registry holds the configured providers by name.
+type Registry struct {
+	providers map[string]Provider
+}
+
+// NewRegistry builds a provider for every configured entry.
+func NewRegistry(configs []config.SocialProviderConfig) (*Registry, error) {
+	registry := &Registry{providers: map[string]Provider{}}
+	for _, cfg := range configs {
+		provider, err := NewOAuth2Provider(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("login provider %q: %v", cfg.Name, err)
+		}
+		registry.Register(provider)
+	}
+	return registry, nil
+}
+
+func (r *Registry) Register(provider Provider) {
+	r.providers[provider.Name()] = provider
+}
+
+func (r *Registry) Get(name string) (Provider, error) {
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// Names returns the registered provider names in alphabetical order.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
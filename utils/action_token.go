@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"time"
+)
+
+const (
+	EmailVerificationPurpose = "email_verification"
+	DataExportPurpose        = "data_export"
+)
+
+var ErrInvalidActionToken = errors.New("invalid action token")
+
+// ActionClaims are the claims of a signed link token that authorizes a single
+// kind of action, such as verifying an email address. Email binds the token
+// to the address it was sent to.
+type ActionClaims struct {
+	UserID  uint   `json:"user_id"`
+	Email   string `json:"email"`
+	Purpose string `json:"purpose"`
+	jwt.StandardClaims
+}
+
+// GenerateActionToken signs an action token valid for ttl.
+func GenerateActionToken(purpose string, userID uint, email string, ttl time.Duration) (string, error) {
+	jti, err := GenerateRandomString(16)
+	if err != nil {
+		return "", err
+	}
+	claims := &ActionClaims{
+		UserID:  userID,
+		Email:   email,
+		Purpose: purpose,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+		},
+	}
+	return signToken(claims)
+}
+
+// ParseActionToken verifies an action token and checks its purpose.
+func ParseActionToken(tokenStr, purpose string) (*ActionClaims, error) {
+	claims := &ActionClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, verificationKey)
+	if err != nil || !token.Valid || claims.Purpose != purpose {
+		return nil, ErrInvalidActionToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"time"
+)
+
+var idTokenExpiry = time.Hour
+
+// IDTokenClaims are the claims of an OpenID Connect ID token.
+type IDTokenClaims struct {
+	Nonce    string `json:"nonce,omitempty"`
+	AuthTime int64  `json:"auth_time,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Name     string `json:"name,omitempty"`
+	jwt.StandardClaims
+}
+
+// GenerateIDToken signs an ID token with the current signing key. Issuer,
+// subject and audience must be set by the caller.
+func GenerateIDToken(claims *IDTokenClaims) (string, error) {
+	now := time.Now()
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(idTokenExpiry).Unix()
+	return signToken(claims)
+}
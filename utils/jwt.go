@@ -1,59 +1,123 @@
 package utils
 
 import (
-	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	"time"
 )
 
-var jwtKey = []byte("your_secret_key")
-
 var (
-	jwtSecret          = []byte("your_secret_key")
 	accessTokenExpiry  = time.Minute * 15
 	refreshTokenExpiry = time.Hour * 24 * 7
+	mfaTokenExpiry     = time.Minute * 5
+)
+
+const (
+	AccessTokenType  = "access"
+	RefreshTokenType = "refresh"
+	MFATokenType     = "mfa"
 )
 
+// Claims are the claims of our access, refresh and MFA tokens. OrgID (the
+// active organization), Roles and Permissions are only set on access tokens,
+// so a change to a user's roles takes effect at the latest when the access
+// token is refreshed. Access tokens issued to an OAuth client carry its
+// ClientID and the granted Scope instead of a role grant.
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Role   string `json:"role"`
+	UserID      uint     `json:"user_id"`
+	OrgID       uint     `json:"org_id,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	Scope       string   `json:"scope,omitempty"`
+	TokenType   string   `json:"token_type"`
+	SessionID   string   `json:"sid"`
 	jwt.StandardClaims
 }
 
-func GenerateToken(userID uint, role string, isRefreshToken bool) (string, error) {
+// AccessGrant is what an access token allows: the active organization and
+// the roles and permissions the user has there, or for an OAuth client only
+// the scopes the user consented to.
+type AccessGrant struct {
+	OrgID       uint
+	Roles       []string
+	Permissions []string
+	ClientID    string
+	Scope       string
+}
+
+func GenerateToken(userID uint, grant AccessGrant, sessionID string, isRefreshToken bool) (string, error) {
 	var expiryTime time.Duration
+	tokenType := AccessTokenType
 	if isRefreshToken {
 		expiryTime = refreshTokenExpiry
+		tokenType = RefreshTokenType
+		grant = AccessGrant{}
 	} else {
 		expiryTime = accessTokenExpiry
 	}
 
+	// A random ID keeps two tokens issued in the same second distinct,
+	// which matters for refresh tokens that are stored by hash.
+	jti, err := GenerateRandomString(16)
+	if err != nil {
+		return "", err
+	}
+
 	claims := &Claims{
-		UserID: userID,
-		Role:   role,
+		UserID:      userID,
+		OrgID:       grant.OrgID,
+		Roles:       grant.Roles,
+		Permissions: grant.Permissions,
+		ClientID:    grant.ClientID,
+		Scope:       grant.Scope,
+		TokenType:   tokenType,
+		SessionID:   sessionID,
 		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			IssuedAt:  time.Now().Unix(),
 			ExpiresAt: time.Now().Add(expiryTime).Unix(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return signToken(claims)
+}
+
+// GenerateMFAToken issues the short-lived token returned by a login that
+// still has to pass a second factor. It cannot be used as an access token.
+func GenerateMFAToken(userID uint) (string, error) {
+	jti, err := GenerateRandomString(16)
+	if err != nil {
+		return "", err
+	}
+	claims := &Claims{
+		UserID:    userID,
+		TokenType: MFATokenType,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(mfaTokenExpiry).Unix(),
+		},
+	}
+	return signToken(claims)
+}
+
+// AccessTokenExpiry returns how long a newly issued access token stays valid.
+func AccessTokenExpiry() time.Duration {
+	return accessTokenExpiry
+}
+
+// RefreshTokenExpiry returns how long a newly issued refresh token stays valid.
+func RefreshTokenExpiry() time.Duration {
+	return refreshTokenExpiry
 }
 
 func ValidateToken(tokenString string) (*jwt.Token, error) {
-	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return jwtKey, nil
-	})
+	return jwt.Parse(tokenString, verificationKey)
 }
 
 func ParseToken(tokenStr string) (*Claims, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, claims, verificationKey)
 	if err != nil {
 		return nil, err
 	}
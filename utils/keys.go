@@ -0,0 +1,298 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"user-service/config"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// signingKey is a key pair used to sign tokens, or a public key kept around
+// only to verify tokens signed before a rotation.
+type signingKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+type keySet struct {
+	mu      sync.RWMutex
+	current *signingKey
+	keys    map[string]*signingKey
+}
+
+var keys = &keySet{keys: map[string]*signingKey{}}
+
+// JWK is the JSON Web Key representation of a public verification key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served from /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadSigningKeys loads the token signing key and any additional verification
+// keys from the application config. The algorithm (RS256, ES256/ES384 or
+// EdDSA) follows from the key type. Without a configured signing key an
+// ephemeral ES256 key is generated, so tokens do not survive a restart.
+func LoadSigningKeys() error {
+	cfg := config.AppConfig
+
+	var signer crypto.Signer
+	var err error
+	switch {
+	case cfg.JWTSigningKey != "":
+		signer, err = parsePrivateKey([]byte(cfg.JWTSigningKey))
+	case cfg.JWTSigningKeyFile != "":
+		var data []byte
+		if data, err = os.ReadFile(cfg.JWTSigningKeyFile); err == nil {
+			signer, err = parsePrivateKey(data)
+		}
+	default:
+		log.Println("JWT signing key is not configured, generating an ephemeral key")
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load JWT signing key: %v", err)
+	}
+
+	current, err := newSigningKey(cfg.JWTSigningKeyID, signer.Public())
+	if err != nil {
+		return err
+	}
+	current.PrivateKey = signer
+
+	loaded := map[string]*signingKey{current.ID: current}
+	for _, entry := range strings.Split(cfg.JWTVerificationKeys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		// Entries are either "kid=path" or a bare path, in which case the
+		// key ID is derived from the key itself.
+		kid, path := "", entry
+		if i := strings.Index(entry, "="); i >= 0 {
+			kid, path = entry[:i], entry[i+1:]
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read JWT verification key %s: %v", path, err)
+		}
+		publicKey, err := parsePublicKey(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse JWT verification key %s: %v", path, err)
+		}
+		key, err := newSigningKey(kid, publicKey)
+		if err != nil {
+			return err
+		}
+		if _, exists := loaded[key.ID]; !exists {
+			loaded[key.ID] = key
+		}
+	}
+
+	keys.mu.Lock()
+	defer keys.mu.Unlock()
+	keys.current = current
+	keys.keys = loaded
+	return nil
+}
+
+// GetJWKS returns the public half of every key that tokens may be verified with.
+func GetJWKS() JWKSet {
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+
+	set := JWKSet{Keys: make([]JWK, 0, len(keys.keys))}
+	if keys.current != nil {
+		set.Keys = append(set.Keys, keys.current.jwk())
+	}
+	for id, key := range keys.keys {
+		if keys.current != nil && id == keys.current.ID {
+			continue
+		}
+		set.Keys = append(set.Keys, key.jwk())
+	}
+	return set
+}
+
+// SigningAlgorithm returns the JWS algorithm of the current signing key.
+func SigningAlgorithm() string {
+	key, err := currentSigningKey()
+	if err != nil {
+		return ""
+	}
+	return key.Method.Alg()
+}
+
+func currentSigningKey() (*signingKey, error) {
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+	if keys.current == nil {
+		return nil, errors.New("JWT signing key is not loaded")
+	}
+	return keys.current, nil
+}
+
+// signToken signs the claims with the current key and sets the kid header.
+func signToken(claims jwt.Claims) (string, error) {
+	key, err := currentSigningKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// verificationKey is a jwt.Keyfunc that resolves the key named by the token's
+// kid header and refuses any algorithm other than the one bound to that key.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	keys.mu.RLock()
+	key, ok := keys.keys[kid]
+	keys.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.PublicKey, nil
+}
+
+func newSigningKey(kid string, publicKey crypto.PublicKey) (*signingKey, error) {
+	key := &signingKey{ID: kid, PublicKey: publicKey}
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			key.Method = jwt.SigningMethodES256
+		case elliptic.P384():
+			key.Method = jwt.SigningMethodES384
+		default:
+			return nil, fmt.Errorf("unsupported elliptic curve %s", k.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		key.Method = signingMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", publicKey)
+	}
+	if key.ID == "" {
+		key.ID = key.thumbprint()
+	}
+	return key, nil
+}
+
+func (k *signingKey) jwk() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+	switch pub := k.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return jwk
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint used as the default kid.
+func (k *signingKey) thumbprint() string {
+	jwk := k.jwk()
+	var members map[string]string
+	switch jwk.Kty {
+	case "RSA":
+		members = map[string]string{"e": jwk.E, "kty": jwk.Kty, "n": jwk.N}
+	case "EC":
+		members = map[string]string{"crv": jwk.Crv, "kty": jwk.Kty, "x": jwk.X, "y": jwk.Y}
+	default:
+		members = map[string]string{"crv": jwk.Crv, "kty": jwk.Kty, "x": jwk.X}
+	}
+	// encoding/json sorts map keys, which gives the required member order.
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+}
+
+func parsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	// Accept private keys too, so a retired key file can be reused as is.
+	signer, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Public(), nil
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"time"
+)
+
+const OAuthStateTokenType = "oauth_state"
+
+var ErrInvalidOAuthState = errors.New("invalid OAuth state")
+
+// OAuthStateClaims are kept in a signed cookie between starting a social
+// login and its callback. The cookie is HttpOnly and only sent back to us,
+// so the PKCE verifier and nonce never reach the provider or other sites.
+type OAuthStateClaims struct {
+	Provider     string `json:"provider"`
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	ReturnTo     string `json:"return_to,omitempty"`
+	// LinkUserID and LinkSessionID are set when a signed-in user is linking
+	// the provider to their account instead of logging in.
+	LinkUserID    uint   `json:"link_user_id,omitempty"`
+	LinkSessionID string `json:"link_session_id,omitempty"`
+	TokenType     string `json:"token_type"`
+	jwt.StandardClaims
+}
+
+// GenerateOAuthStateToken signs the claims for ttl.
+func GenerateOAuthStateToken(claims OAuthStateClaims, ttl time.Duration) (string, error) {
+	claims.TokenType = OAuthStateTokenType
+	claims.StandardClaims = jwt.StandardClaims{
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	}
+	return signToken(&claims)
+}
+
+// ParseOAuthStateToken verifies a state cookie.
+func ParseOAuthStateToken(tokenStr string) (*OAuthStateClaims, error) {
+	claims := &OAuthStateClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, verificationKey)
+	if err != nil || !token.Valid || claims.TokenType != OAuthStateTokenType {
+		return nil, ErrInvalidOAuthState
+	}
+	return claims, nil
+}
@@ -6,7 +6,12 @@ import (
 	"net/http"
 )
 
-var ErrInvalidCredentials = errors.New("invalid credentials")
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrAccountSuspended   = errors.New("account suspended")
+	ErrAccountBanned      = errors.New("account banned")
+	ErrAccountPending     = errors.New("account pending activation")
+)
 
 // ErrorResponse struct
 type ErrorResponse struct {
@@ -25,6 +30,20 @@ func SendErrorResponse(c *gin.Context, status int, message string) {
 	c.JSON(status, ErrorResponse{Status: status, Message: message})
 }
 
+// AccountStatusMessage describes the errors returned for accounts that are
+// not active.
+func AccountStatusMessage(err error) (string, bool) {
+	switch {
+	case errors.Is(err, ErrAccountSuspended):
+		return "Account is suspended", true
+	case errors.Is(err, ErrAccountBanned):
+		return "Account is banned", true
+	case errors.Is(err, ErrAccountPending):
+		return "Account is pending activation", true
+	}
+	return "", false
+}
+
 // SendTokenResponse sends a token response
 func SendTokenResponse(c *gin.Context, accessToken string, refreshToken string) {
 	c.JSON(http.StatusOK, TokenResponse{
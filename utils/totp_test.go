@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 key of the RFC 6238 test vectors,
+// "12345678901234567890", base32 encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	key := []byte("12345678901234567890")
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode(T=%d) = %q, want %q", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	const unix = 1111111111
+	step := int64(unix / totpPeriod)
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		now      int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfc6238Secret, "050471", unix, step, true},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "050471", unix, step, true},
+		{"one step behind", rfc6238Secret, "050471", unix + totpPeriod, step, true},
+		{"one step ahead", rfc6238Secret, "050471", unix - totpPeriod, step, true},
+		{"two steps behind", rfc6238Secret, "050471", unix + 2*totpPeriod, 0, false},
+		{"two steps ahead", rfc6238Secret, "050471", unix - 2*totpPeriod, 0, false},
+		{"wrong code", rfc6238Secret, "050472", unix, 0, false},
+		{"short code", rfc6238Secret, "05047", unix, 0, false},
+		{"long code", rfc6238Secret, "0504710", unix, 0, false},
+		{"invalid secret", "not base32!", "050471", unix, 0, false},
+	}
+	for _, tt := range tests {
+		gotStep, gotOK := ValidateTOTP(tt.secret, tt.code, time.Unix(tt.now, 0))
+		if gotStep != tt.wantStep || gotOK != tt.wantOK {
+			t.Errorf("%s: ValidateTOTP = (%d, %v), want (%d, %v)", tt.name, gotStep, gotOK, tt.wantStep, tt.wantOK)
+		}
+	}
+}
+
+// TestValidateTOTPReplay checks that a code accepted again later in its skew
+// window reports the same step, which is what lets callers reject it as a
+// replay.
+func TestValidateTOTPReplay(t *testing.T) {
+	const unix = 1111111111
+	first, ok := ValidateTOTP(rfc6238Secret, "050471", time.Unix(unix, 0))
+	if !ok {
+		t.Fatal("ValidateTOTP rejected the RFC 6238 code")
+	}
+	again, ok := ValidateTOTP(rfc6238Secret, "050471", time.Unix(unix+totpPeriod, 0))
+	if !ok || again != first {
+		t.Errorf("replayed code matched step (%d, %v), want (%d, true)", again, ok, first)
+	}
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// ValidationErrorResponse is an ErrorResponse with one message per invalid
+// field, keyed by the field's JSON name.
+type ValidationErrorResponse struct {
+	Status  int               `json:"status"`
+	Message string            `json:"message"`
+	Errors  map[string]string `json:"errors"`
+}
+
+func init() {
+	// Report fields by their JSON name rather than the Go struct field name.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// SendValidationErrorResponse answers a failed ShouldBind call. Validation
+// failures are reported per field; anything else (e.g. malformed JSON) gets
+// a plain ErrorResponse.
+func SendValidationErrorResponse(c *gin.Context, err error) {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		SendErrorResponse(c, http.StatusBadRequest, "Invalid input data")
+		return
+	}
+	fields := make(map[string]string, len(validationErrors))
+	for _, fe := range validationErrors {
+		fields[fe.Field()] = validationMessage(fe)
+	}
+	c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+		Status:  http.StatusBadRequest,
+		Message: "Invalid input data",
+		Errors:  fields,
+	})
+}
+
+func validationMessage(fe validator.FieldError) string {
+	// For alternatives such as "len=0|url" the last one is the meaningful rule.
+	tag := fe.Tag()
+	if i := strings.LastIndex(tag, "|"); i >= 0 {
+		tag = tag[i+1:]
+	}
+	switch tag {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "url":
+		return "must be a valid URL"
+	case "min":
+		if fe.Param() == "1" {
+			return "must not be empty"
+		}
+		return fmt.Sprintf("must be at least %s characters long", fe.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s characters long", fe.Param())
+	case "bcp47_language_tag":
+		return "must be a valid locale such as \"en\" or \"vi-VN\""
+	case "timezone":
+		return "must be a valid IANA time zone such as \"Asia/Ho_Chi_Minh\""
+	case "oneof":
+		return "must be one of: " + fe.Param()
+	}
+	return "is invalid"
+}